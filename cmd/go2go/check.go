@@ -0,0 +1,31 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/tdakkota/go2go/golib/go2go"
+	"os"
+)
+
+// check type checks the .go2 packages in dirs, and reports every
+// error found. It reports whether there were none.
+func check(importer *go2go.Importer, dirs []string) bool {
+	ok := true
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		errs, err := go2go.Check(importer, dir)
+		if err != nil {
+			die(err.Error())
+		}
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+			ok = false
+		}
+	}
+	return ok
+}
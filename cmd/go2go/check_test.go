@@ -0,0 +1,126 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+	buildGo2go(t)
+
+	gopath, err := ioutil.TempDir("", "go2go-check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	testFiles{
+		{
+			"lib/lib.go2",
+			`package lib
+
+func Max(type T)(a, b T) T {
+	if a > b {
+		return a
+	}
+	return b
+}
+`,
+		},
+		{
+			"app/main.go2",
+			`package main
+
+import "lib"
+
+func first(type T)(s []T) T { return s[0] }
+
+func main() {
+	var s string = first([]int{1})
+	println(s, lib.Max(1, 2), undefined)
+}
+`,
+		},
+		{
+			"app/main_test.go2",
+			`package main
+
+func init() { first(1) }
+`,
+		},
+		{
+			"ok/ok.go2",
+			`package ok
+
+func Min(type T)(s []T, less func(T, T) bool) T { return s[0] }
+`,
+		},
+		{
+			"syntax/syntax.go2",
+			`package syntax
+
+func F( {
+`,
+		},
+	}.create(t, gopath)
+
+	for _, test := range []struct {
+		dir  string
+		want []string // lines of output, in order; nil for success
+	}{
+		{
+			"app",
+			[]string{
+				"main.go2:3:8: could not import lib",
+				"lib.go2:4:5: cannot compare a > b",
+				"main.go2:8:17: cannot use first",
+				"main.go2:9:28: undeclared name: undefined",
+				"main_test.go2:3:22: cannot infer T",
+			},
+		},
+		{"ok", nil},
+		{"syntax", []string{"syntax.go2:3:9: expected )"}},
+	} {
+		dir := filepath.Join(gopath, "src", test.dir)
+		cmd := exec.Command(testGo2go, "check")
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GO2PATH="+gopath, "GO111MODULE=off")
+		out, err := cmd.CombinedOutput()
+		if test.want == nil {
+			if err != nil || len(out) > 0 {
+				t.Errorf("go2go check in %s: %v\n%s", test.dir, err, out)
+			}
+		} else if err == nil {
+			t.Errorf("go2go check in %s succeeded unexpectedly\n%s", test.dir, out)
+		}
+		rest := string(out)
+		for _, want := range test.want {
+			i := strings.Index(rest, want)
+			if i < 0 {
+				t.Errorf("go2go check in %s: output does not contain %q after the earlier lines:\n%s", test.dir, want, out)
+				break
+			}
+			rest = rest[i+len(want):]
+		}
+
+		// Nothing is written next to the sources.
+		names, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, fi := range names {
+			if filepath.Ext(fi.Name()) != ".go2" {
+				t.Errorf("go2go check wrote %s", filepath.Join(test.dir, fi.Name()))
+			}
+		}
+	}
+}
@@ -7,16 +7,43 @@
 //
 // Usage:
 //
-//	go2go <command> [arguments]
+//	go2go [-p n] [-names mangled|readable] [-tags tag,list] <command> [arguments]
 //
 // The commands are:
 //
 //	build      translate and then run "go build packages"
+//	check      parse and type check listed packages, writing nothing
+//	clean      with -cache, remove the translation cache
+//	doc        show documentation for a package or symbol ([pkg] [sym])
+//	fmt        format .go2 files, as gofmt does for .go files
+//	list       list packages, or describe them as JSON with -json
+//	lsp        run a language server for .go2 files over stdin and stdout
+//	migrate    convert .go2 files into Go 1.18 .go files for listed packages
 //	run        translate and then run a list of files
+//	serve      run a local playground web server
 //      test       translate and then run "go test packages"
 //      translate  translate .go2 files into .go files for listed packages
+//                 (translate -o dir writes a separate Go 1 source tree)
+//	vet        report likely mistakes in the .go2 files of listed packages
 //
-// A package is expected to contain .go2 files but no .go files.
+// A package is expected to contain .go2 files. It may also contain
+// hand-written .go files, so that generics can be adopted gradually
+// in an existing package. The .go files are type checked along with the
+// .go2 files, and are left untouched: only the .go2 files are translated.
+// As they are not translated, the .go files may not declare or use
+// generic functions, types or contracts. A .go file is taken to be
+// hand-written unless it starts with the comment that go2go writes at
+// the start of each translated file; translating a .go2 file that would
+// overwrite a hand-written .go file of the same name is an error.
+//
+// The files of a package are selected as the go command selects .go
+// files: a .go2 or .go file whose name ends in a GOOS or GOARCH suffix,
+// such as _linux.go2, or whose // +build lines are not satisfied, is
+// left out. GOOS and GOARCH are taken from the environment, and the
+// -tags flag lists further build tags to consider satisfied; the build,
+// run and test commands pass it on to the go command. The // +build
+// lines of a .go2 file are copied to its translation, so that the
+// translated files may be built for another GOOS or GOARCH.
 //
 // Non-local imported packages will be first looked up using the GO2PATH
 // environment variable, which should point to a GOPATH-like directory.
@@ -25,14 +52,191 @@
 // imports will be looked up in the usual way. If an import includes
 // .go2 files, they will be translated into .go files.
 //
+// If the current directory is inside a module, that is, there is a go.mod
+// file in it or in one of its parents, and GO111MODULE is not "off",
+// go2go works in module mode. Imports of packages in the main module,
+// and in modules that the main module replaces with a local directory,
+// are looked up in those directories, and their .go2 files are translated
+// into a temporary directory rather than next to the sources. The build,
+// test and run commands then pass the translated files to the go command
+// using its -overlay flag, so the module source trees are left untouched.
+// Packages named on the command line are still translated in place.
+//
+// The translations of imported packages are cached in the directory
+// named by the GO2CACHE environment variable, or by default in the go2go
+// subdirectory of the user's cache directory. An imported package is
+// translated again only if its .go2 files, the .go2 packages that it
+// imports, directly or indirectly, or the go2go executable change.
+// Cached packages are still type checked. Setting GO2CACHE=off disables
+// the cache, and "go2go clean -cache" removes it.
+//
+// The packages listed on the command line, and the .go2 packages that
+// they import, are translated in parallel where they do not depend on
+// each other. The -p flag sets the number of packages that may be
+// translated at once; the default is the number of CPUs. An import
+// cycle among the packages is reported before anything is translated.
+//
 // There is a sample GO2PATH in cmd/go2go/testdata/go2path. It provides
 // several packages that serve as examples of using generics, and may
 // be useful in experimenting with your own generic code.
 //
+// The generated .go files contain //line directives that refer back to
+// the .go2 sources, so compiler errors, panics and coverage reports
+// show .go2 file positions. Code in an instantiated function or type is
+// reported at the position of the generic declaration.
+//
+// Each instantiation of a generic function or type is written once per
+// package, to the file instantiations.go. Instantiations needed only by
+// the tests of a package are written to instantiations_test.go, or to
+// instantiations_x_test.go for an external test package. A package uses
+// the instantiations written for the packages that it imports, rather
+// than writing its own copies. Do not name a .go2 file instantiations.go2.
+//
+// A generic function preceded by the comment
+//
+//	//go2go:dictionary
+//
+// is translated once rather than once per list of type arguments.
+// Values of type parameter type are held in interface{} values, and
+// operators and methods on them are called through a dictionary of
+// functions built for each list of type arguments. The same comment
+// before the package clause of any file of a package selects this
+// translation for every generic function of the package. Only functions
+// whose type parameters are used as plain values, with operators and
+// with methods whose parameters and results are type parameters or
+// predeclared types, can be translated this way. Pointer methods,
+// required by a contract as in *T m(), are not supported, as they would
+// modify a copy of the value. For other functions,
+// a comment on the function is reported as an error, while a comment on
+// the package falls back to instantiating the function. Generic types
+// and their methods are always instantiated.
+//
+// The translate command normally writes the .go files next to the .go2
+// files of each listed package. With the -o flag, as in
+// "go2go translate -o dir ./...", it leaves the source tree untouched and
+// writes a separate tree of Go 1 sources instead: the translation of the
+// package with import path p goes into dir/src/p. The .go2 packages that
+// the listed packages import, directly or indirectly, are translated into
+// the tree too, and the Go 1 packages that they import from the main
+// module or from GO2PATH are copied, so that the tree holds everything
+// but the standard library and other modules. The tree may be built with
+// GOPATH=dir and GO111MODULE=off, or vendored. The listed packages must
+// be in the main module or in GO2PATH, so that they have import paths.
+//
+// The migrate command rewrites the .go2 files of each listed package
+// into .go files that use type parameters as supported by Go 1.18 and
+// later, keeping comments and layout. Type parameter lists and
+// instantiations use square brackets, type lists become unions, and
+// each contract becomes a constraint interface for each of its type
+// parameters. A contract C with several type parameters, such as
+// contract C(K, V), becomes the interfaces CK[K, V any] and CV[K, V any].
+// Pointer method constraints, written *T m(), cannot be migrated.
+// The .go2 files are left in place.
+//
+// The vet command type checks the .go2 files of each listed package,
+// including test files, and runs a set of analyzers over them, reporting
+// problems at .go2 file positions rather than in the translated code.
+// The analyzers are printf, which checks the arguments of calls of
+// printf-like functions against the format; shadow, which reports a
+// variable that shadows another of the same type that is used after
+// the shadowing scope; unreachable, which reports statements that follow
+// a return, panic or branch statement; and unusedresult, which reports
+// discarded results of calls of functions such as fmt.Sprintf and of
+// String and Error methods. Flags such as -printf select which analyzers
+// to run, as in "go2go vet -printf -shadow ./...". The command exits
+// with a failure status if any problem is reported.
+//
+// The doc command prints the documentation of a package from its .go2
+// files, or from its .go files if it has no .go2 files. With a symbol,
+// as in "go2go doc list List" or "go2go doc list List.Len", it prints
+// the declaration and documentation of that symbol. Contracts are listed
+// with the other declarations, and generic functions returning a generic
+// type, such as func New(type T)() *List(T), are listed with that type.
+// Packages are found in the main module, in GO2PATH, or as directories;
+// with a single argument that names no package, the argument is taken
+// to be a symbol of the package in the current directory. The -u flag
+// includes unexported declarations.
+//
+// The fmt command formats .go2 files, including contracts and type
+// parameter lists, which gofmt cannot parse. It takes gofmt's flags:
+// -l lists the files whose formatting differs, -w rewrites the files,
+// -d prints diffs, and -s simplifies the code. Arguments are files or
+// directories, which are walked recursively for .go2 files; with no
+// arguments, standard input is formatted to standard output.
+//
+// The check command parses and type checks the .go2 files of each listed
+// package, including test files, and reports every error found, with its
+// .go2 file position. The .go2 packages that they import, directly or
+// indirectly, are checked too; an error in one of them is reported at
+// the import declaration. Nothing is written to the disk, so the command
+// may be run on a source tree at any time, as from an editor or a
+// pre-commit hook. The command exits with a failure status if any error
+// is reported.
+//
+// The list command prints the import path of each listed package. With
+// the -json flag it prints instead a JSON object describing the package,
+// as "go list -json" does: its .go2 files, test files included; the .go
+// files that translating it writes; its imports, split into .go2 and
+// Go 1 packages; its exported generic functions, types and contracts;
+// and each instantiation that the package uses, with the package that
+// declares the generic function or type, the type arguments, and the
+// package holding the instantiated code, which is the package itself
+// or one that it imports. Instantiations used only by the tests are
+// listed separately. The packages are translated in memory, and nothing
+// is written to the disk or built.
+//
+// The lsp command runs a language server for .go2 files, which speaks
+// the Language Server Protocol over its standard input and output, for
+// use by editors. It reports syntax and type errors in the open files
+// as diagnostics, shows the type of an identifier or expression on
+// hover, finds the declaration of an identifier and the references to
+// it within its package, and formats files as go2go fmt does. The
+// server keeps the text of the open files in memory, and type checks
+// a package again when one of its files changes, parsing again only
+// the changed files; packages that import the changed package are
+// checked again too. Edits are seen by the packages that import an open
+// file before the file is saved. Nothing is written to the disk.
+//
+// The serve command runs a local playground: a web server, by default
+// on localhost:8080 and otherwise at the address set by its -http flag,
+// with a page for editing a single-file program and buttons to format
+// it, type check it, show its translation into Go 1, and run it. The
+// page uses JSON endpoints, /fmt, /check, /translate and /run, which
+// take a POST request with Content-Type application/json and an object
+// with the field Body, the program, and return an object with the
+// fields Body, the formatted or translated program; Output, the output
+// of the program; and Error. Requests must name the server by the host
+// given to -http, or as localhost, and requests from pages of other
+// sites are rejected. A program is built, using a build cache of its
+// own that is removed when the server is interrupted, in a temporary
+// directory that is removed afterwards. The build and the program get
+// that directory as their home and none of the environment of the
+// server, and the program is killed after ten seconds. Otherwise
+// programs are not isolated: they run with the privileges of the user
+// running the server, so do not expose it to untrusted users.
+//
 // Translation into standard Go requires generating Go code with mangled names.
 // The mangled names will always include Odia (Oriya) digits, such as ୦ and ୮.
 // Do not use Oriya digits in identifiers in your own code.
 //
+// With the -names readable flag, instantiations get ASCII names instead:
+// the generic name, with its first letter in upper case, followed by the
+// type arguments, each after a double underscore, so that List(int)
+// becomes List__int. A generic function or type of another package is
+// prefixed by the package name, as in List_List__int for list.List(int).
+// A type argument other than a predeclared or defined type, such as
+// []int, is written as T followed by eight hexadecimal digits of a hash
+// of the type. A generated name that conflicts with a declaration of the
+// package, or with the name of another instantiation, is reported as an
+// error. Each generated name is listed, with the generic function or type
+// and the type arguments, in the file instantiations.names next to the
+// translated files. The other names that the translation introduces,
+// such as those of the dictionaries and shared functions of the
+// dictionary translation, also separate their parts with double
+// underscores rather than Oriya digits, as in Shared__Max; those
+// declared at package level are listed in instantiations.names too.
+// Avoid double underscores in your own identifiers with this flag.
+//
 // Because this tool generates Go files, and because instantiated types
 // and functions need to refer to the types with which they are instantiated,
 // using function-local types as type arguments is not supported.
@@ -0,0 +1,234 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/tdakkota/go2go/golib/format"
+	"github.com/tdakkota/go2go/golib/parser"
+	"github.com/tdakkota/go2go/golib/scanner"
+	"github.com/tdakkota/go2go/golib/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// fmtFlags are the flags of go2go fmt, which match those of gofmt.
+type fmtFlags struct {
+	list     bool // -l
+	write    bool // -w
+	doDiff   bool // -d
+	simplify bool // -s
+}
+
+// gofmt formats the .go2 files named by args, as gofmt does for .go
+// files. A directory is walked recursively for .go2 files; with no
+// arguments, standard input is formatted. It returns the exit status.
+func gofmt(args []string) int {
+	var flags fmtFlags
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	fs.BoolVar(&flags.list, "l", false, "list files whose formatting differs from go2go fmt's")
+	fs.BoolVar(&flags.write, "w", false, "write result to (source) file instead of stdout")
+	fs.BoolVar(&flags.doDiff, "d", false, "display diffs instead of rewriting files")
+	fs.BoolVar(&flags.simplify, "s", false, "simplify code")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: go2go fmt [flags] [path ...]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	exitCode := 0
+	report := func(err error) {
+		scanner.PrintError(os.Stderr, err)
+		exitCode = 2
+	}
+
+	if fs.NArg() == 0 {
+		if flags.write {
+			fmt.Fprintln(os.Stderr, "error: cannot use -w with standard input")
+			return 2
+		}
+		if err := processFile("<standard input>", os.Stdin, os.Stdout, flags); err != nil {
+			report(err)
+		}
+		return exitCode
+	}
+
+	for _, path := range fs.Args() {
+		switch fi, err := os.Stat(path); {
+		case err != nil:
+			report(err)
+		case fi.IsDir():
+			err := filepath.Walk(path, func(path string, fi os.FileInfo, err error) error {
+				if err == nil && isGo2File(fi) {
+					err = processFile(path, nil, os.Stdout, flags)
+				}
+				// Don't complain if a file was deleted in the meantime.
+				if err != nil && !os.IsNotExist(err) {
+					report(err)
+				}
+				return nil
+			})
+			if err != nil {
+				report(err)
+			}
+		default:
+			if err := processFile(path, nil, os.Stdout, flags); err != nil {
+				report(err)
+			}
+		}
+	}
+	return exitCode
+}
+
+// isGo2File reports whether fi is a .go2 file that go2go fmt formats
+// when walking a directory.
+func isGo2File(fi os.FileInfo) bool {
+	name := fi.Name()
+	return !fi.IsDir() && !strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".go2")
+}
+
+// processFile formats the file filename, read from in if it is not
+// nil, and writes the result as directed by flags.
+func processFile(filename string, in io.Reader, out io.Writer, flags fmtFlags) error {
+	var perm os.FileMode = 0644
+	if in == nil {
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		in = f
+		perm = fi.Mode().Perm()
+	}
+
+	src, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+	if flags.simplify {
+		simplify(file)
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		return err
+	}
+	res := buf.Bytes()
+
+	if !bytes.Equal(src, res) {
+		// formatting has changed
+		if flags.list {
+			fmt.Fprintln(out, filename)
+		}
+		if flags.write {
+			if err := ioutil.WriteFile(filename, res, perm); err != nil {
+				return err
+			}
+		}
+		if flags.doDiff {
+			data, err := diff(src, res, filename)
+			if err != nil {
+				return fmt.Errorf("computing diff: %s", err)
+			}
+			fmt.Fprintf(out, "diff -u %s %s\n", filepath.ToSlash(filename+".orig"), filepath.ToSlash(filename))
+			out.Write(data)
+		}
+	}
+
+	if !flags.list && !flags.write && !flags.doDiff {
+		_, err = out.Write(res)
+	}
+
+	return err
+}
+
+// diff returns the output of diff -u comparing b1 and b2,
+// with the file names in the header replaced by filename.
+func diff(b1, b2 []byte, filename string) (data []byte, err error) {
+	f1, err := writeTempFile("", "go2go", b1)
+	if err != nil {
+		return
+	}
+	defer os.Remove(f1)
+
+	f2, err := writeTempFile("", "go2go", b2)
+	if err != nil {
+		return
+	}
+	defer os.Remove(f2)
+
+	data, err = exec.Command("diff", "-u", f1, f2).CombinedOutput()
+	if len(data) > 0 {
+		// diff exits with a non-zero status when the files don't match.
+		// Ignore that failure as long as we get output.
+		err = nil
+	}
+	if err != nil {
+		return
+	}
+	return replaceTempFilename(data, filename)
+}
+
+// replaceTempFilename replaces temporary filenames in diff with actual one.
+//
+// --- /tmp/go2go316145376	2017-02-03 19:13:00.280468375 -0500
+// +++ /tmp/go2go617882815	2017-02-03 19:13:00.280468375 -0500
+// ...
+// ->
+// --- path/to/file.go2.orig	2017-02-03 19:13:00.280468375 -0500
+// +++ path/to/file.go2	2017-02-03 19:13:00.280468375 -0500
+// ...
+func replaceTempFilename(diff []byte, filename string) ([]byte, error) {
+	bs := bytes.SplitN(diff, []byte{'\n'}, 3)
+	if len(bs) < 3 {
+		return nil, fmt.Errorf("got unexpected diff for %s", filename)
+	}
+	// Preserve timestamps.
+	var t0, t1 []byte
+	if i := bytes.LastIndexByte(bs[0], '\t'); i != -1 {
+		t0 = bs[0][i:]
+	}
+	if i := bytes.LastIndexByte(bs[1], '\t'); i != -1 {
+		t1 = bs[1][i:]
+	}
+	// Always print filepath with slash separator.
+	f := filepath.ToSlash(filename)
+	bs[0] = []byte(fmt.Sprintf("--- %s%s", f+".orig", t0))
+	bs[1] = []byte(fmt.Sprintf("+++ %s%s", f, t1))
+	return bytes.Join(bs, []byte{'\n'}), nil
+}
+
+// writeTempFile writes data to a new temporary file,
+// and returns its name.
+func writeTempFile(dir, prefix string, data []byte) (string, error) {
+	file, err := ioutil.TempFile(dir, prefix)
+	if err != nil {
+		return "", err
+	}
+	_, err = file.Write(data)
+	if err1 := file.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
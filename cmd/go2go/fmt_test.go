@@ -0,0 +1,153 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFmt(t *testing.T) {
+	t.Parallel()
+	buildGo2go(t)
+
+	const src = `package p
+
+contract Stringer(T) {  T String() string }
+
+func Join(type T Stringer)(s []T, sep string) (r string) {
+    for i, _ := range s[0:len(s)] {
+        if i > 0 { r += sep }
+        r += s[i].String()
+    }
+    return r
+}
+
+func Pairs(type T)(a, b T) [][]T { return [][]T{[]T{a, b}} }
+`
+	const want = `package p
+
+contract Stringer(T) {
+	T String() string
+}
+
+func Join(type T Stringer)(s []T, sep string) (r string) {
+	for i := range s[0:] {
+		if i > 0 {
+			r += sep
+		}
+		r += s[i].String()
+	}
+	return r
+}
+
+func Pairs(type T)(a, b T) [][]T { return [][]T{{a, b}} }
+`
+	dir, err := ioutil.TempDir("", "go2go-fmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "sub", "p.go2")
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(stdin string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command(testGo2go, append([]string{"fmt"}, args...)...)
+		cmd.Stdin = strings.NewReader(stdin)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("go2go fmt %v failed: %v\n%s", args, err, out)
+		}
+		return string(out)
+	}
+
+	if got := run(src, "-s"); got != want {
+		t.Errorf("go2go fmt -s printed\n%s\nwant\n%s", got, want)
+	}
+	if got := run("", "-l", dir); got != file+"\n" {
+		t.Errorf("go2go fmt -l printed %q, want %q", got, file+"\n")
+	}
+	if _, err := exec.LookPath("diff"); err == nil {
+		got := run("", "-d", file)
+		if !strings.Contains(got, "+contract Stringer(T) {\n") || !strings.Contains(got, "--- "+filepath.ToSlash(file)+".orig") {
+			t.Errorf("go2go fmt -d printed\n%s", got)
+		}
+	}
+	run("", "-w", "-s", dir)
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want {
+		t.Errorf("go2go fmt -w wrote\n%s\nwant\n%s", data, want)
+	}
+	if got := run("", "-l", "-s", dir); got != "" {
+		t.Errorf("go2go fmt -l listed formatted files:\n%s", got)
+	}
+}
+
+// TestFmtIdempotent checks that formatting the .go2 files in the
+// repository a second time does not change them.
+func TestFmtIdempotent(t *testing.T) {
+	t.Parallel()
+	buildGo2go(t)
+
+	dir, err := ioutil.TempDir("", "go2go-fmt-idempotent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	n := 0
+	for _, root := range []string{"testdata", filepath.Join("..", "..", "golib")} {
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || filepath.Ext(path) != ".go2" {
+				return err
+			}
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			fn := filepath.Join(dir, strings.ReplaceAll(filepath.ToSlash(path), "../", ""))
+			if err := os.MkdirAll(filepath.Dir(fn), 0o755); err != nil {
+				return err
+			}
+			n++
+			return ioutil.WriteFile(fn, data, 0o644)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n == 0 {
+		t.Fatal("no .go2 files found")
+	}
+
+	// Some test files have deliberate syntax errors;
+	// go2go fmt reports them and formats the others.
+	cmd := exec.Command(testGo2go, "fmt", "-w", "-s", dir)
+	cmd.Stderr = ioutil.Discard
+	if out, err := cmd.Output(); len(out) > 0 {
+		t.Fatalf("go2go fmt -w printed %s (err %v)", out, err)
+	}
+
+	cmd = exec.Command(testGo2go, "fmt", "-l", "-s", dir)
+	cmd.Stderr = ioutil.Discard
+	out, _ := cmd.Output()
+	if len(out) > 0 {
+		t.Errorf("formatting is not idempotent for:\n%s", out)
+	}
+}
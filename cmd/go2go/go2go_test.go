@@ -32,6 +32,10 @@ func testMain(m *testing.M) int {
 	defer os.RemoveAll(dir)
 	testTempDir = dir
 
+	// Keep the translations made by the tests
+	// out of the user's translation cache.
+	os.Setenv("GO2CACHE", filepath.Join(dir, "cache"))
+
 	return m.Run()
 }
 
@@ -321,3 +325,1560 @@ func TestTransitiveGo1(t *testing.T) {
 		t.Fatalf(`error running "go2go build": %v`, err)
 	}
 }
+
+const panicSource = `package main
+
+type Stack(type T) struct {
+	s []T
+}
+
+func (s *Stack(T)) Pop() T {
+	v := s.s[len(s.s)-1]
+	s.s = s.s[:len(s.s)-1]
+	return v
+}
+
+func main() {
+	var s Stack(string)
+	s.Pop()
+}
+`
+
+func TestLineDirectives(t *testing.T) {
+	t.Parallel()
+	buildGo2go(t)
+
+	gopath, err := ioutil.TempDir("", "go2go-line-directives")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	testFiles{
+		{
+			"panic/panic.go2",
+			panicSource,
+		},
+	}.create(t, gopath)
+
+	t.Log("go2go run")
+	dir := filepath.Join(gopath, "src", "panic")
+	cmd := exec.Command(testGo2go, "run", "panic.go2")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		t.Logf("%s", out)
+	}
+	if err == nil {
+		t.Fatal(`"go2go run" succeeded unexpectedly`)
+	}
+
+	// The panic is in the instantiated method, which should
+	// be reported at the position of the generic method.
+	for _, want := range []string{"panic.go2:8", "panic.go2:15"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("output does not mention %s", want)
+		}
+	}
+}
+
+func TestTranslateErrors(t *testing.T) {
+	t.Parallel()
+	buildGo2go(t)
+
+	gopath, err := ioutil.TempDir("", "go2go-translate-errors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	testFiles{
+		{
+			"p/a.go2",
+			"package p\n\nfunc F(type T)(x T)\n\nfunc G() {\n\tF(1)\n}\n",
+		},
+		{
+			"p/b.go2",
+			"package p\n\nfunc H() {\n\tF(\"x\")\n}\n",
+		},
+	}.create(t, gopath)
+
+	t.Log("go2go translate")
+	cmd := exec.Command(testGo2go, "translate", "p")
+	cmd.Dir = gopath
+	cmd.Env = append(os.Environ(),
+		"GO2PATH="+gopath,
+	)
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		t.Logf("%s", out)
+	}
+	if err == nil {
+		t.Fatal(`"go2go translate" succeeded unexpectedly`)
+	}
+
+	// Both problems should be reported, with positions.
+	for _, want := range []string{"a.go2:6:2: unsupported:", "b.go2:4:2: unsupported:"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("output does not contain %q", want)
+		}
+	}
+	if strings.Contains(string(out), "goroutine") {
+		t.Error("translation panicked")
+	}
+}
+
+func TestInstantiationsFile(t *testing.T) {
+	t.Parallel()
+	buildGo2go(t)
+
+	gopath, err := ioutil.TempDir("", "go2go-instantiations-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	testFiles{
+		{
+			"pair/pair.go2",
+			`package pair; type Pair(type T) struct{ A, B T }; func Swap(type T)(p Pair(T)) Pair(T) { return Pair(T){p.B, p.A} }; func Ints() Pair(int) { return Swap(Pair(int){1, 2}) }`,
+		},
+		{
+			"cmd/a.go2",
+			`package main; import "pair"; func a() pair.Pair(int) { return pair.Swap(pair.Pair(int){3, 4}) }`,
+		},
+		{
+			"cmd/b.go2",
+			`package main; import "pair"; func b() pair.Pair(int) { return pair.Swap(pair.Pair(int){5, 6}) }; func main() { a(); b(); pair.Ints() }`,
+		},
+		{
+			"cmd/c.go2",
+			`package main; func Ident(type T)(v T) T { return v }; func c() int { return Ident(1) }`,
+		},
+		{
+			"cmd/d.go2",
+			`package main; func d() int { return Ident(2) }`,
+		},
+	}.create(t, gopath)
+
+	t.Log("go2go build")
+	dir := filepath.Join(gopath, "src", "cmd")
+	cmd := exec.Command(testGo2go, "build")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GO2PATH="+gopath,
+	)
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		t.Logf("%s", out)
+	}
+	if err != nil {
+		t.Fatalf(`error running "go2go build": %v`, err)
+	}
+
+	// The instantiations of pair.Swap(int) and pair.Pair(int) are
+	// in package pair; Ident(int) is written once, to instantiations.go.
+	var all []byte
+	for _, name := range []string{"a.go", "b.go", "c.go", "d.go", "instantiations.go"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, data...)
+	}
+	for _, want := range []struct {
+		s string
+		n int
+	}{
+		{"func Instantiate", 1},
+		{"type Instantiate", 0},
+		{"pair.Instantiate", 6},
+	} {
+		if got := strings.Count(string(all), want.s); got != want.n {
+			t.Errorf("found %q %d times, want %d", want.s, got, want.n)
+		}
+	}
+	if t.Failed() {
+		t.Logf("%s", all)
+	}
+}
+
+func TestModules(t *testing.T) {
+	t.Parallel()
+	buildGo2go(t)
+
+	root, err := ioutil.TempDir("", "go2go-modules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	testFiles{
+		{
+			"m/go.mod",
+			"module example.com/m\n\ngo 1.16\n\nrequire example.com/lib v0.0.0\n\nreplace example.com/lib => ../lib\n",
+		},
+		{
+			"m/list/list.go2",
+			`package list; type List(type T) struct { next *List(T); val T }; func (l *List(T)) Push(v T) *List(T) { return &List(T){l, v} }; func (l *List(T)) Len() int { if l == nil { return 0 }; return 1 + l.next.Len() }`,
+		},
+		{
+			"m/cmd/hello/hello.go2",
+			`package main; import ("example.com/m/list"; "example.com/lib/ident"); func main() { var l *list.List(string); l = l.Push("a").Push(ident.Ident("b")); println("len", l.Len()) }`,
+		},
+		{
+			"lib/go.mod",
+			"module example.com/lib\n\ngo 1.16\n",
+		},
+		{
+			"lib/ident/ident.go2",
+			`package ident; func Ident(type T)(v T) T { return v }`,
+		},
+	}.create(t, root)
+
+	mdir := filepath.Join(root, "src", "m")
+	env := append(os.Environ(),
+		"GO111MODULE=on",
+		"GOFLAGS=-mod=mod",
+		"GOPROXY=off",
+		"GOWORK=off",
+	)
+
+	t.Log("go2go build")
+	cmd := exec.Command(testGo2go, "build", "./cmd/hello")
+	cmd.Dir = mdir
+	cmd.Env = env
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		t.Logf("%s", out)
+	}
+	if err != nil {
+		t.Fatalf(`error running "go2go build": %v`, err)
+	}
+
+	cmdName := "./hello"
+	if runtime.GOOS == "windows" {
+		cmdName += ".exe"
+	}
+	cmd = exec.Command(cmdName)
+	cmd.Dir = mdir
+	out, err = cmd.CombinedOutput()
+	t.Logf("%s", out)
+	if err != nil {
+		t.Fatalf("error running hello: %v", err)
+	}
+	if got, want := strings.TrimSpace(string(out)), "len 2"; got != want {
+		t.Errorf("hello printed %q, want %q", got, want)
+	}
+
+	// Imported packages are translated outside the module trees.
+	for _, dir := range []string{"m/list", "lib/ident"} {
+		matches, err := filepath.Glob(filepath.Join(root, "src", filepath.FromSlash(dir), "*.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(matches) > 0 {
+			t.Errorf("go2go build wrote %v", matches)
+		}
+	}
+
+	t.Log("go2go run")
+	cmd = exec.Command(testGo2go, "run", filepath.Join("cmd", "hello", "hello.go2"))
+	cmd.Dir = mdir
+	cmd.Env = env
+	out, err = cmd.CombinedOutput()
+	t.Logf("%s", out)
+	if err != nil {
+		t.Fatalf(`error running "go2go run": %v`, err)
+	}
+	if got, want := strings.TrimSpace(string(out)), "len 2"; got != want {
+		t.Errorf("go2go run printed %q, want %q", got, want)
+	}
+}
+
+func TestDictionary(t *testing.T) {
+	t.Parallel()
+	buildGo2go(t)
+
+	gopath, err := ioutil.TempDir("", "go2go-dictionary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	testFiles{
+		{
+			"ord/ord.go2",
+			`package ord
+
+contract Number(T) {
+	T int, float64
+}
+
+//go2go:dictionary
+func Max(type T Number)(a, b T) T {
+	if a < b {
+		return b
+	}
+	return a
+}
+
+//go2go:dictionary
+func Sum(type T Number)(a, b T) (s T) {
+	s += a
+	var z T
+	s = s + b + z
+	return
+}
+
+contract Stringer(T) {
+	T String() string
+}
+
+//go2go:dictionary
+func Describe(type T Stringer)(x T, prefix string) string {
+	return prefix + x.String()
+}
+
+func Min(type T Number)(a, b T) T {
+	if a < b {
+		return a
+	}
+	return b
+}
+`,
+		},
+		{
+			"gen/gen.go2",
+			`//go2go:dictionary
+
+package gen
+
+func Neg(type T)(x T, f func(interface{})) {
+	f(x)
+}
+
+func First(type T)(s []T) T {
+	return s[0]
+}
+`,
+		},
+		{
+			"cmd/main.go2",
+			`package main
+
+import (
+	"gen"
+	"ord"
+)
+
+type name string
+
+func (n name) String() string { return "name " + string(n) }
+
+func main() {
+	println(ord.Max(1, 2), ord.Max(3.5, 2.0) == 3.5, ord.Sum(1, 2), ord.Describe(name("bob"), "> "), ord.Min(4, 3))
+	gen.Neg(1, func(x interface{}) { println(x.(int)) })
+	println(gen.First([]int{5}))
+}
+`,
+		},
+	}.create(t, gopath)
+
+	t.Log("go2go build")
+	dir := filepath.Join(gopath, "src", "cmd")
+	cmd := exec.Command(testGo2go, "build")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GO2PATH="+gopath,
+	)
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		t.Logf("%s", out)
+	}
+	if err != nil {
+		t.Fatalf(`error running "go2go build": %v`, err)
+	}
+
+	cmdName := "./cmd"
+	if runtime.GOOS == "windows" {
+		cmdName += ".exe"
+	}
+	cmd = exec.Command(cmdName)
+	cmd.Dir = dir
+	out, err = cmd.CombinedOutput()
+	t.Logf("%s", out)
+	if err != nil {
+		t.Fatalf("error running cmd: %v", err)
+	}
+	if got, want := string(out), "2 true 3 > name bob 3\n1\n5\n"; got != want {
+		t.Errorf("cmd printed %q, want %q", got, want)
+	}
+
+	// Max is translated once in package ord, not once per
+	// type argument; Min is still instantiated.
+	data, err := ioutil.ReadFile(filepath.Join(dir, "instantiations.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []struct {
+		s string
+		n int
+	}{
+		{"ord.Shared୦Max(", 2},
+		{"ord.Shared୦Sum(", 1},
+		{"ord.Shared୦Describe(", 1},
+		{"gen.Shared୦Neg(", 1},
+		{"gen.Shared୦First(", 0},
+		{"a < b", 1},
+		{"interface {", 0},
+	} {
+		if got := strings.Count(string(data), want.s); got != want.n {
+			t.Errorf("found %q %d times, want %d", want.s, got, want.n)
+		}
+	}
+	if t.Failed() {
+		t.Logf("%s", data)
+	}
+}
+
+func TestPointerMethods(t *testing.T) {
+	t.Parallel()
+	buildGo2go(t)
+
+	gopath, err := ioutil.TempDir("", "go2go-pointer-methods")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	testFiles{
+		{
+			"dec/dec.go2",
+			`package dec
+
+contract Setter(T) {
+	*T Set(string)
+}
+
+// Decode returns the values of type T set to each of s.
+func Decode(type T Setter)(s []string) []T {
+	r := make([]T, len(s))
+	for i, v := range s {
+		r[i].Set(v)
+	}
+	return r
+}
+
+// New returns a new T set to s.
+func New(type T Setter)(s string) *T {
+	p := new(T)
+	p.Set(s)
+	return p
+}
+
+// One returns a T set to s, through New.
+func One(type T Setter)(s string) T {
+	return *New(T)(s)
+}
+`,
+		},
+		{
+			"cmd/main.go2",
+			`package main
+
+import "dec"
+
+type name struct{ s string }
+
+func (n *name) Set(s string) { n.s = "name " + s }
+
+type size int
+
+func (n *size) Set(s string) { *n = size(len(s)) }
+
+func main() {
+	names := dec.Decode(name)([]string{"a", "b"})
+	println(names[0].s, names[1].s, *dec.New(size)("abc"), dec.One(name)("c").s)
+}
+`,
+		},
+		{
+			"bad/bad.go2",
+			`package bad
+
+contract Setter(T) {
+	*T Set(string)
+}
+
+//go2go:dictionary
+func Set(type T Setter)(x T, s string) T {
+	x.Set(s)
+	return x
+}
+`,
+		},
+	}.create(t, gopath)
+	env := append(os.Environ(), "GO2PATH="+gopath)
+
+	t.Log("go2go build")
+	dir := filepath.Join(gopath, "src", "cmd")
+	cmd := exec.Command(testGo2go, "build")
+	cmd.Dir = dir
+	cmd.Env = env
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		t.Logf("%s", out)
+	}
+	if err != nil {
+		t.Fatalf(`error running "go2go build": %v`, err)
+	}
+
+	cmdName := "./cmd"
+	if runtime.GOOS == "windows" {
+		cmdName += ".exe"
+	}
+	cmd = exec.Command(cmdName)
+	cmd.Dir = dir
+	out, err = cmd.CombinedOutput()
+	t.Logf("%s", out)
+	if err != nil {
+		t.Fatalf("error running cmd: %v", err)
+	}
+	if got, want := string(out), "name a name b 3 name c\n"; got != want {
+		t.Errorf("cmd printed %q, want %q", got, want)
+	}
+
+	// A pointer method cannot be called through a dictionary.
+	cmd = exec.Command(testGo2go, "translate", "bad")
+	cmd.Env = env
+	out, err = cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("go2go translate bad succeeded unexpectedly\n%s", out)
+	}
+	if want := "pointer method Set is not supported"; !strings.Contains(string(out), want) {
+		t.Errorf("go2go translate bad printed %q, want %q", out, want)
+	}
+}
+
+func TestCoreTypes(t *testing.T) {
+	t.Parallel()
+	buildGo2go(t)
+
+	gopath, err := ioutil.TempDir("", "go2go-core-types")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	testFiles{
+		{
+			"cmd/main.go2",
+			`package main
+
+func Inc(type T interface{ type [4]int })(x T, i int) int {
+	x[i]++
+	return x[i]
+}
+
+func Count(type M interface{ type map[string]int })(m M, k string) (int, bool) {
+	m[k]++
+	v, ok := m[k]
+	return v, ok
+}
+
+func Echo(type C interface{ type chan int })(ch C, v int) int {
+	ch <- v
+	return <-ch
+}
+
+func Recv(type C interface{ type chan int, <-chan int })(ch C) int {
+	return <-ch
+}
+
+func Add(type P interface{ type *int })(p P, v int) int {
+	*p += v
+	return *p
+}
+
+func Call(type F interface{ type func(int) int })(f F, v int) int {
+	return f(v)
+}
+
+func main() {
+	ch := make(chan int, 1)
+	n, ok := Count(map[string]int{}, "a")
+	e := Echo(ch, 2)
+	ch <- 3
+	r := Recv((<-chan int)(ch))
+	v := 4
+	a := Add(&v, 1)
+	println(Inc([4]int{1, 2, 3, 4}, 3), n, ok, e, r, a, v, Call(func(x int) int { return x * 2 }, 3))
+}
+`,
+		},
+	}.create(t, gopath)
+
+	t.Log("go2go build")
+	dir := filepath.Join(gopath, "src", "cmd")
+	cmd := exec.Command(testGo2go, "build")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GO2PATH="+gopath)
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		t.Logf("%s", out)
+	}
+	if err != nil {
+		t.Fatalf(`error running "go2go build": %v`, err)
+	}
+
+	cmdName := "./cmd"
+	if runtime.GOOS == "windows" {
+		cmdName += ".exe"
+	}
+	cmd = exec.Command(cmdName)
+	cmd.Dir = dir
+	out, err = cmd.CombinedOutput()
+	t.Logf("%s", out)
+	if err != nil {
+		t.Fatalf("error running cmd: %v", err)
+	}
+	if got, want := string(out), "5 1 true 2 3 5 5 6\n"; got != want {
+		t.Errorf("cmd printed %q, want %q", got, want)
+	}
+}
+
+func TestMultipleContracts(t *testing.T) {
+	t.Parallel()
+	buildGo2go(t)
+
+	gopath, err := ioutil.TempDir("", "go2go-multiple-contracts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	testFiles{
+		{
+			"cmd/main.go2",
+			`package main
+
+contract Stringer(T) {
+	T String() string
+}
+
+contract Number(T) {
+	T int, int64, float64
+}
+
+contract Ordered(T) {
+	T int, int64, float64, string
+}
+
+contract Convert(From, To) {
+	From int, int64
+	To float64
+}
+
+func Max(type T Number(T), Ordered(T))(x, y T) T {
+	if x < y {
+		return y
+	}
+	return x
+}
+
+func Show(type T Stringer(T), Number(T))(x T) (string, T) {
+	return x.String(), x + 1
+}
+
+func Float(type T Convert(T, float64))(x T) float64 {
+	return float64(x) / 2
+}
+
+type num int
+
+func (n num) String() string { return "num" }
+
+func main() {
+	s, n := Show(num(3))
+	println(Max(1, 2), Max(2.5, 1.5) == 2.5, s, n, Float(int64(3)) == 1.5)
+}
+`,
+		},
+	}.create(t, gopath)
+
+	t.Log("go2go build")
+	dir := filepath.Join(gopath, "src", "cmd")
+	cmd := exec.Command(testGo2go, "build")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GO2PATH="+gopath)
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		t.Logf("%s", out)
+	}
+	if err != nil {
+		t.Fatalf(`error running "go2go build": %v`, err)
+	}
+
+	cmdName := "./cmd"
+	if runtime.GOOS == "windows" {
+		cmdName += ".exe"
+	}
+	cmd = exec.Command(cmdName)
+	cmd.Dir = dir
+	out, err = cmd.CombinedOutput()
+	t.Logf("%s", out)
+	if err != nil {
+		t.Fatalf("error running cmd: %v", err)
+	}
+	if got, want := string(out), "2 true num 4 true\n"; got != want {
+		t.Errorf("cmd printed %q, want %q", got, want)
+	}
+}
+
+func TestRecursiveBounds(t *testing.T) {
+	t.Parallel()
+	buildGo2go(t)
+
+	gopath, err := ioutil.TempDir("", "go2go-recursive-bounds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	testFiles{
+		{
+			"graph/graph.go2",
+			`package graph
+
+type NodeFace(type Node NodeFace(Node, Edge), Edge EdgeFace(Node, Edge)) interface {
+	Edges() []Edge
+}
+
+type EdgeFace(type Node NodeFace(Node, Edge), Edge EdgeFace(Node, Edge)) interface {
+	Nodes() (from, to Node)
+}
+
+type Graph(type Node NodeFace(Node, Edge), Edge EdgeFace(Node, Edge), comparable(Node)) struct {
+	nodes []Node
+}
+
+func New(type Node NodeFace(Node, Edge), Edge EdgeFace(Node, Edge), comparable(Node))(nodes []Node) *Graph(Node, Edge) {
+	return &Graph(Node, Edge){nodes: nodes}
+}
+
+func (g *Graph(Node, Edge)) ShortestPath(from, to Node) []Edge {
+	visited := make(map[Node][]Edge)
+	visited[from] = nil
+	workqueue := []Node{from}
+	for len(workqueue) > 0 {
+		current := workqueue[0]
+		workqueue = workqueue[1:]
+		for _, edge := range current.Edges() {
+			n1, n2 := edge.Nodes()
+			next := n1
+			if next == current {
+				next = n2
+			}
+			if _, ok := visited[next]; ok {
+				continue
+			}
+			path := append(visited[current][:len(visited[current]):len(visited[current])], edge)
+			if next == to {
+				return path
+			}
+			visited[next] = path
+			workqueue = append(workqueue, next)
+		}
+	}
+	return nil
+}
+`,
+		},
+		{
+			"cmd/main.go2",
+			`package main
+
+import "graph"
+
+type node int
+
+type edge struct{ from, to node }
+
+var adjacent = map[node][]edge{}
+
+func (n node) Edges() []edge        { return adjacent[n] }
+func (e edge) Nodes() (node, node) { return e.from, e.to }
+
+func connect(a, b node) {
+	e := edge{a, b}
+	adjacent[a] = append(adjacent[a], e)
+	adjacent[b] = append(adjacent[b], e)
+}
+
+func main() {
+	connect(1, 2)
+	connect(2, 3)
+	connect(3, 4)
+	connect(1, 3)
+	g := graph.New(node, edge)([]node{1, 2, 3, 4})
+	for _, e := range g.ShortestPath(1, 4) {
+		println(e.from, e.to)
+	}
+}
+`,
+		},
+	}.create(t, gopath)
+
+	t.Log("go2go build")
+	dir := filepath.Join(gopath, "src", "cmd")
+	cmd := exec.Command(testGo2go, "build")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GO2PATH="+gopath)
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		t.Logf("%s", out)
+	}
+	if err != nil {
+		t.Fatalf(`error running "go2go build": %v`, err)
+	}
+
+	cmdName := "./cmd"
+	if runtime.GOOS == "windows" {
+		cmdName += ".exe"
+	}
+	cmd = exec.Command(cmdName)
+	cmd.Dir = dir
+	out, err = cmd.CombinedOutput()
+	t.Logf("%s", out)
+	if err != nil {
+		t.Fatalf("error running cmd: %v", err)
+	}
+	if got, want := string(out), "1 3\n3 4\n"; got != want {
+		t.Errorf("cmd printed %q, want %q", got, want)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	t.Parallel()
+	buildGo2go(t)
+
+	root, err := ioutil.TempDir("", "go2go-migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	testFiles{
+		{
+			"m/go.mod",
+			"module example.com/m\n\ngo 1.18\n",
+		},
+		{
+			"m/graph/graph.go2",
+			`// Package graph holds generic code.
+package graph
+
+// Number permits numbers.
+contract Number(T) {
+	// Integers.
+	T int, int64,
+		float64 // and floats
+}
+
+// G relates nodes and edges.
+contract G(Node, Edge) {
+	// Edges returns the edges.
+	Node Edges() []Edge
+	comparable(Node)
+	Edge Nodes() (a, b Node)
+}
+
+// Sum returns the sum of s.
+func Sum(type T Number)(s []T) T {
+	var r T
+	for _, v := range s {
+		r += v
+	}
+	return r
+}
+
+// Graph is a graph.
+type Graph(type Node, Edge G) struct {
+	nodes []Node
+}
+
+// New returns a graph.
+func New(type Node, Edge G)(nodes []Node) *Graph(Node, Edge) {
+	return &Graph(Node, Edge){nodes: nodes}
+}
+
+// Len returns the number of nodes.
+func (g *Graph(Node, Edge)) Len() int { return len(g.nodes) }
+`,
+		},
+		{
+			"m/graph/old.go",
+			"// Code generated by go2go; DO NOT EDIT.\n\npackage graph\n",
+		},
+		{
+			"m/cmd/hello/hello.go2",
+			`package main
+
+import "example.com/m/graph"
+
+type node int
+type edge int
+
+func (node) Edges() []edge   { return nil }
+func (edge) Nodes() (a, b node) { return 0, 0 }
+
+func main() {
+	println(graph.Sum([]int{1, 2, 3}), graph.Sum(float64)(nil) == 0)
+	println(graph.New(node, edge)([]node{1, 2}).Len())
+}
+`,
+		},
+	}.create(t, root)
+
+	mdir := filepath.Join(root, "src", "m")
+	env := append(os.Environ(),
+		"GO111MODULE=on",
+		"GOFLAGS=-mod=mod",
+		"GOPROXY=off",
+		"GOWORK=off",
+	)
+
+	cmd := exec.Command(testGo2go, "migrate", "./graph", "./cmd/hello")
+	cmd.Dir = mdir
+	cmd.Env = env
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		t.Logf("%s", out)
+	}
+	if err != nil {
+		t.Fatalf(`error running "go2go migrate": %v`, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(mdir, "graph", "old.go")); !os.IsNotExist(err) {
+		t.Errorf("go2go migrate did not remove old translation: %v", err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(mdir, "graph", "graph.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	for _, want := range []string{
+		"// Package graph holds generic code.\n",
+		"type Number interface {\n\t// Integers.\n\t~int | ~int64 |\n\t\t~float64 // and floats\n}\n",
+		"type GNode[Node, Edge any] interface {\n\t// Edges returns the edges.\n\tEdges() []Edge\n\tcomparable\n}\n",
+		"type GEdge[Node, Edge any] interface {\n\tNodes() (a, b Node)\n}\n",
+		"func Sum[T Number](s []T) T {\n",
+		"type Graph[Node GNode[Node, Edge], Edge GEdge[Node, Edge]] struct {\n",
+		"return &Graph[Node, Edge]{nodes: nodes}\n",
+		"func (g *Graph[Node, Edge]) Len() int",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("graph.go does not contain %q", want)
+		}
+	}
+	if t.Failed() {
+		t.Logf("graph.go:\n%s", got)
+	}
+
+	// The migrated code is built by the go command alone.
+	cmd = exec.Command(testenv.GoToolPath(t), "run", "./cmd/hello")
+	cmd.Dir = mdir
+	cmd.Env = env
+	out, err = cmd.CombinedOutput()
+	t.Logf("%s", out)
+	if err != nil {
+		t.Fatalf("error running migrated hello: %v", err)
+	}
+	if got, want := string(out), "6 true\n2\n"; got != want {
+		t.Errorf("hello printed %q, want %q", got, want)
+	}
+}
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+	buildGo2go(t)
+
+	gopath, err := ioutil.TempDir("", "go2go-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	testFiles{
+		{
+			"list/list.go2",
+			`package list
+
+type List(type T) struct {
+	next *List(T)
+	val  T
+}
+
+func (l *List(T)) Push(v T) *List(T) { return &List(T){l, v} }
+
+func (l *List(T)) Len() int {
+	if l == nil {
+		return 0
+	}
+	return 1 + l.next.Len()
+}
+
+func Ints() *List(int) { return new(List(int)).Push(1) }
+
+func Msg() string { return "original" }
+`,
+		},
+		{
+			"cmd/main.go2",
+			`package main
+
+import "list"
+
+func main() {
+	var l *list.List(int)
+	println(l.Push(2).Len()+list.Ints().Len(), list.Msg())
+}
+`,
+		},
+	}.create(t, gopath)
+
+	cacheDir := filepath.Join(gopath, "cache")
+	dir := filepath.Join(gopath, "src", "cmd")
+	cmdName := "./cmd"
+	if runtime.GOOS == "windows" {
+		cmdName += ".exe"
+	}
+	run := func(want string) {
+		t.Helper()
+		cmd := exec.Command(testGo2go, "build")
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GO2PATH="+gopath, "GO2CACHE="+cacheDir)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("error running go2go build: %v\n%s", err, out)
+		}
+		cmd = exec.Command(cmdName)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("error running cmd: %v\n%s", err, out)
+		}
+		if got := string(out); got != want {
+			t.Errorf("cmd printed %q, want %q", got, want)
+		}
+
+		// List(int) is instantiated by package list, whether
+		// or not its translation comes from the cache.
+		if _, err := os.Stat(filepath.Join(dir, "instantiations.go")); !os.IsNotExist(err) {
+			t.Errorf("package main has its own instantiations: %v", err)
+		}
+	}
+
+	run("3 original\n")
+
+	// Change the cached translation of list, to show that
+	// it is used, rather than translating list again.
+	cached, err := filepath.Glob(filepath.Join(cacheDir, "*", "*", "list.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cached) != 1 {
+		t.Fatalf("found cached files %v, want one list.go", cached)
+	}
+	data, err := ioutil.ReadFile(cached[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = []byte(strings.Replace(string(data), `"original"`, `"cached"`, 1))
+	if err := ioutil.WriteFile(cached[0], data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	run("3 cached\n")
+
+	// A change to the source is translated again.
+	src := filepath.Join(gopath, "src", "list", "list.go2")
+	data, err = ioutil.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = []byte(strings.Replace(string(data), `"original"`, `"changed"`, 1))
+	if err := os.Chmod(src, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(src, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	run("3 changed\n")
+
+	cmd := exec.Command(testGo2go, "clean", "-cache")
+	cmd.Env = append(os.Environ(), "GO2CACHE="+cacheDir)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("error running go2go clean -cache: %v\n%s", err, out)
+	}
+	if _, err := os.Stat(cacheDir); !os.IsNotExist(err) {
+		t.Errorf("go2go clean -cache left %s: %v", cacheDir, err)
+	}
+}
+
+func TestReadableNames(t *testing.T) {
+	t.Parallel()
+	buildGo2go(t)
+
+	gopath, err := ioutil.TempDir("", "go2go-readable-names")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	testFiles{
+		{
+			"list/list.go2",
+			`package list
+
+type List(type T) []T
+
+func (l List(T)) Len() int { return len(l) }
+
+func Of(type T)(v ...T) List(T) { return List(T)(v) }
+`,
+		},
+		{
+			"app/main.go2",
+			`package main
+
+import "list"
+
+func first(type T)(s []T) T { return s[0] }
+
+func main() {
+	println(list.Of(1, 2).Len(), first([]int{3}), first([][]int{{4}})[0])
+}
+`,
+		},
+		{
+			"clash/main.go2",
+			`package main
+
+func first(type T)(s []T) T { return s[0] }
+
+func First__int() {}
+
+func main() { println(first([]int{1})) }
+`,
+		},
+	}.create(t, gopath)
+
+	dir := filepath.Join(gopath, "src", "app")
+	cmd := exec.Command(testGo2go, "-names", "readable", "build")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GO2PATH="+gopath)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("error running go2go build: %v\n%s", err, out)
+	}
+	cmdName := "./app"
+	if runtime.GOOS == "windows" {
+		cmdName += ".exe"
+	}
+	cmd = exec.Command(cmdName)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("error running app: %v\n%s", err, out)
+	}
+	if got, want := string(out), "2 3 4\n"; got != want {
+		t.Errorf("app printed %q, want %q", got, want)
+	}
+
+	got, err := ioutil.ReadFile(filepath.Join(dir, "instantiations.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"func First__int(", "func List_Of__int(", "func First__T"} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("instantiations.go does not contain %q:\n%s", want, got)
+		}
+	}
+	names, err := ioutil.ReadFile(filepath.Join(dir, "instantiations.names"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"package main\n",
+		"First__int\tmain.first(int)\n",
+		"List_Of__int\tlist.Of(int)\n",
+		"\tmain.first([]int)\n",
+	} {
+		if !strings.Contains(string(names), want) {
+			t.Errorf("instantiations.names does not contain %q:\n%s", want, names)
+		}
+	}
+
+	cmd = exec.Command(testGo2go, "-names", "readable", "build")
+	cmd.Dir = filepath.Join(gopath, "src", "clash")
+	out, err = cmd.CombinedOutput()
+	if err == nil {
+		t.Fatal("go2go build with a conflicting name succeeded unexpectedly")
+	}
+	if want := "name First__int of instantiation main.first(int) conflicts with First__int declared in package main"; !strings.Contains(string(out), want) {
+		t.Errorf("go2go build printed %q, want %q", out, want)
+	}
+}
+
+func TestReadableNamesDictionary(t *testing.T) {
+	t.Parallel()
+	buildGo2go(t)
+
+	gopath, err := ioutil.TempDir("", "go2go-readable-dictionary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	testFiles{
+		{
+			"ord/ord.go2",
+			`package ord
+
+contract Number(T) {
+	T int, float64
+}
+
+//go2go:dictionary
+func Max(type T Number)(a, b T) T {
+	if a < b {
+		return b
+	}
+	return a
+}
+
+contract Stringer(T) {
+	T String() string
+}
+
+//go2go:dictionary
+func Describe(type T Stringer)(x T, prefix string) string {
+	return prefix + x.String()
+}
+`,
+		},
+		{
+			"app/main.go2",
+			`package main
+
+import "ord"
+
+type name string
+
+func (n name) String() string { return "name " + string(n) }
+
+func main() {
+	println(ord.Max(1, 2), ord.Describe(name("bob"), "> "))
+}
+`,
+		},
+	}.create(t, gopath)
+
+	outdir := filepath.Join(gopath, "out")
+	cmd := exec.Command(testGo2go, "-names", "readable", "translate", "-o", outdir, "app")
+	cmd.Env = append(os.Environ(), "GO2PATH="+gopath, "GO111MODULE=off")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go2go translate -o failed: %v\n%s", err, out)
+	}
+
+	cmd = exec.Command(testenv.GoToolPath(t), "run", "app")
+	cmd.Env = append(os.Environ(), "GOPATH="+outdir, "GO111MODULE=off")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("error running app: %v\n%s", err, out)
+	}
+	if got, want := string(out), "2 > name bob\n"; got != want {
+		t.Errorf("app printed %q, want %q", got, want)
+	}
+
+	for _, pkg := range []string{"app", "ord"} {
+		files, err := filepath.Glob(filepath.Join(outdir, "src", pkg, "*.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.ContainsAny(string(data), "୦୮") {
+				t.Errorf("%s contains a mangled name:\n%s", file, data)
+			}
+		}
+	}
+
+	for _, test := range []struct {
+		pkg  string
+		want []string
+	}{
+		{
+			"app",
+			[]string{
+				"Dictionary__Ord_Max__int\tdictionary of ord.Max(int)\n",
+				"Ord_Max__int\tord.Max(int)\n",
+				"Dictionary__Ord_Describe__name\tdictionary of ord.Describe(main.name)\n",
+			},
+		},
+		{
+			"ord",
+			[]string{
+				"Dictionary__Max\tdictionary type of ord.Max\n",
+				"Shared__Max\tshared function of ord.Max\n",
+				"Shared__Describe\tshared function of ord.Describe\n",
+			},
+		},
+	} {
+		names, err := ioutil.ReadFile(filepath.Join(outdir, "src", test.pkg, "instantiations.names"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(string(names), want) {
+				t.Errorf("%s/instantiations.names does not contain %q:\n%s", test.pkg, want, names)
+			}
+		}
+	}
+}
+
+func TestMixed(t *testing.T) {
+	t.Parallel()
+	buildGo2go(t)
+
+	const helper = `package mixed
+
+// Helper is written by hand.
+func Helper() int { return 40 }
+
+// Total uses a function declared in a .go2 file.
+func Total() int { return UseMax() + 2 }
+`
+	tmpdir, err := ioutil.TempDir("", "go2go-mixed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	gopath := filepath.Join(tmpdir, "gopath")
+	testFiles{
+		{
+			"mixed/max.go2",
+			`package mixed
+
+func Max(type T interface{ Less(T) bool })(a, b T) T {
+	if a.Less(b) {
+		return b
+	}
+	return a
+}
+
+type Int int
+
+func (i Int) Less(j Int) bool { return i < j }
+
+func UseMax() int { return int(Max(Int(2), Int(Helper()))) }
+`,
+		},
+		{
+			"mixed/helper.go",
+			helper,
+		},
+		{
+			"app/main.go2",
+			`package main
+
+import "mixed"
+
+func main() {
+	println(mixed.Total(), mixed.Max(mixed.Int(1), mixed.Int(2)))
+}
+`,
+		},
+	}.create(t, gopath)
+	env := append(os.Environ(), "GO2PATH="+gopath, "GO111MODULE=off")
+	mixed := filepath.Join(gopath, "src", "mixed")
+
+	// Translating the package in place keeps the hand-written file,
+	// also when it is translated again.
+	for i := 0; i < 2; i++ {
+		cmd := exec.Command(testGo2go, "translate", "mixed")
+		cmd.Env = env
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("go2go translate failed: %v\n%s", err, out)
+		}
+	}
+	if got, err := ioutil.ReadFile(filepath.Join(mixed, "helper.go")); err != nil {
+		t.Error(err)
+	} else if string(got) != helper {
+		t.Errorf("go2go translate changed helper.go to\n%s", got)
+	}
+	if _, err := os.Stat(filepath.Join(mixed, "max.go")); err != nil {
+		t.Errorf("go2go translate did not write max.go: %v", err)
+	}
+
+	// An imported mixed package is translated next to a copy
+	// of the hand-written file.
+	outdir := filepath.Join(tmpdir, "out")
+	cmd := exec.Command(testGo2go, "translate", "-o", outdir, "app")
+	cmd.Env = env
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go2go translate -o failed: %v\n%s", err, out)
+	}
+	cmd = exec.Command(testenv.GoToolPath(t), "run", "app")
+	cmd.Env = append(os.Environ(), "GOPATH="+outdir, "GO111MODULE=off")
+	cmd.Dir = outdir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run app in the translated tree failed: %v\n%s", err, out)
+	}
+	if got, want := string(out), "42 2\n"; got != want {
+		t.Errorf("app printed %q, want %q", got, want)
+	}
+
+	cmd = exec.Command(testGo2go, "build", "app")
+	cmd.Dir = gopath
+	cmd.Env = env
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go2go build failed: %v\n%s", err, out)
+	}
+
+	// A hand-written file may not use generics, and a .go2 file
+	// may not be translated over a hand-written file.
+	for i, test := range []struct {
+		files testFiles
+		want  string
+	}{
+		{
+			testFiles{
+				{"bad/gen.go2", "package bad\n\nfunc Id(type T)(x T) T { return x }\n"},
+				{"bad/use.go", "package bad\n\nvar X = Id(1)\n"},
+			},
+			"use.go:3:9: unsupported: generic Id used in Go 1 file use.go",
+		},
+		{
+			testFiles{
+				{"bad/gen.go2", "package bad\n"},
+				{"bad/decl.go", "package bad\n\ntype List(type T) []T\n"},
+			},
+			"decl.go:3:6: unsupported: generic type List declared in Go 1 file decl.go",
+		},
+		{
+			testFiles{
+				{"bad/gen.go2", "package bad\n"},
+				{"bad/gen.go", "package bad\n"},
+			},
+			"gen.go2: translation would overwrite hand-written file gen.go",
+		},
+	} {
+		gopath := filepath.Join(tmpdir, fmt.Sprintf("bad%d", i))
+		test.files.create(t, gopath)
+		cmd := exec.Command(testGo2go, "translate", "bad")
+		cmd.Env = append(os.Environ(), "GO2PATH="+gopath, "GO111MODULE=off")
+		out, err := cmd.CombinedOutput()
+		if err == nil || !strings.Contains(string(out), test.want) {
+			t.Errorf("go2go translate: got %v\n%s\nwant error containing %q", err, out, test.want)
+		}
+	}
+}
+
+func TestBuildConstraints(t *testing.T) {
+	t.Parallel()
+	buildGo2go(t)
+
+	tmpdir, err := ioutil.TempDir("", "go2go-build-constraints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	gopath := filepath.Join(tmpdir, "gopath")
+	testFiles{
+		{
+			"plat/plat.go2",
+			`package plat
+
+func Id(type T)(x T) T { return x }
+
+func Name() string { return Id(osName) }
+`,
+		},
+		{"plat/plat_linux.go2", "package plat\n\nconst osName = \"linux\"\n"},
+		{"plat/plat_windows.go2", "package plat\n\nconst osName = \"windows\"\n"},
+		{"plat/plat_other.go2", "// +build !linux,!windows\n\npackage plat\n\nconst osName = \"other\"\n"},
+		{"plat/extra.go2", "// +build extra\n\npackage plat\n\nfunc Extra() int { return Id(1) }\n"},
+		{
+			"app/main.go2",
+			`package main
+
+import "plat"
+
+func main() {
+	println(plat.Name(), plat.Extra())
+}
+`,
+		},
+	}.create(t, gopath)
+	plat := filepath.Join(gopath, "src", "plat")
+
+	cmd := exec.Command(testGo2go, "translate", "plat")
+	cmd.Env = append(os.Environ(), "GO2PATH="+gopath, "GO111MODULE=off", "GOOS=linux", "GOARCH=amd64")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go2go translate failed: %v\n%s", err, out)
+	}
+	for name, want := range map[string]bool{
+		"plat.go":         true,
+		"plat_linux.go":   true,
+		"plat_windows.go": false,
+		"plat_other.go":   false,
+		"extra.go":        false,
+	} {
+		_, err := os.Stat(filepath.Join(plat, name))
+		if got := err == nil; got != want {
+			t.Errorf("GOOS=linux go2go translate wrote %s: %v, want %v", name, got, want)
+		}
+	}
+
+	// Cross-compile the translation of another build context.
+	outdir := filepath.Join(tmpdir, "out")
+	cmd = exec.Command(testGo2go, "-tags", "extra", "translate", "-o", outdir, "app")
+	cmd.Env = append(os.Environ(), "GO2PATH="+gopath, "GO111MODULE=off", "GOOS=windows", "GOARCH=amd64")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go2go -tags extra translate -o failed: %v\n%s", err, out)
+	}
+	for name, want := range map[string]bool{
+		"plat_linux.go":   false,
+		"plat_windows.go": true,
+		"extra.go":        true,
+	} {
+		_, err := os.Stat(filepath.Join(outdir, "src", "plat", name))
+		if got := err == nil; got != want {
+			t.Errorf("GOOS=windows go2go translate -o wrote %s: %v, want %v", name, got, want)
+		}
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(outdir, "src", "plat", "extra.go")); err != nil {
+		t.Error(err)
+	} else if !strings.Contains(string(data), "\n// +build extra\n\n") {
+		t.Errorf("extra.go does not keep its build constraint:\n%s", data)
+	}
+
+	cmd = exec.Command(testenv.GoToolPath(t), "build", "-tags", "extra", "-o", os.DevNull, "app")
+	cmd.Env = append(os.Environ(), "GOPATH="+outdir, "GO111MODULE=off", "GOOS=windows", "GOARCH=amd64")
+	cmd.Dir = outdir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("GOOS=windows go build of the translated tree failed: %v\n%s", err, out)
+	}
+	cmd = exec.Command(testenv.GoToolPath(t), "build", "-o", os.DevNull, "app")
+	cmd.Env = append(os.Environ(), "GOPATH="+outdir, "GO111MODULE=off", "GOOS=windows", "GOARCH=amd64")
+	cmd.Dir = outdir
+	if out, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("go build without -tags extra succeeded, want an error for plat.Extra\n%s", out)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/tdakkota/go2go/golib/go2go"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// listFlags reports whether args start with the -json flag,
+// and returns the remaining arguments.
+func listFlags(args []string) (bool, []string) {
+	asJSON := false
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		switch args[0] {
+		case "-json", "--json":
+			asJSON = true
+		default:
+			die(fmt.Sprintf("go2go list: unknown flag %s", args[0]))
+		}
+		args = args[1:]
+	}
+	return asJSON, args
+}
+
+// list describes the .go2 packages in dirs on standard output: as
+// JSON objects if asJSON is set, or else by their import paths.
+// It reports whether every package could be described.
+func list(importer *go2go.Importer, dirs []string, asJSON bool) bool {
+	ok := true
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		dir, err := filepath.Abs(dir)
+		if err != nil {
+			die(err.Error())
+		}
+		info, err := go2go.List(importer, dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "go2go list: %s: %v\n", dir, err)
+			ok = false
+			continue
+		}
+		if !asJSON {
+			fmt.Println(info.ImportPath)
+			continue
+		}
+		data, err := json.MarshalIndent(info, "", "\t")
+		if err != nil {
+			die(err.Error())
+		}
+		os.Stdout.Write(append(data, '\n'))
+	}
+	return ok
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main_test
+
+import (
+	"encoding/json"
+	"github.com/tdakkota/go2go/golib/go2go"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	t.Parallel()
+	buildGo2go(t)
+
+	gopath, err := ioutil.TempDir("", "go2go-list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	testFiles{
+		{
+			"list/list.go2",
+			`package list
+
+type List(type T) []T
+
+func (l List(T)) Len() int { return len(l) }
+
+func Of(type T)(v ...T) List(T) { return List(T)(v) }
+
+func Ints() List(int) { return Of(1, 2) }
+`,
+		},
+		{
+			"app/main.go2",
+			`package main
+
+import "list"
+
+type point struct{ x int }
+
+func first(type T)(s []T) T { return s[0] }
+
+func main() {
+	println(list.Of(1).Len(), first([]point{{2}}).x)
+}
+`,
+		},
+		{
+			"app/main_test.go2",
+			`package main
+
+import "list"
+
+func init() { println(list.Of("a").Len()) }
+`,
+		},
+	}.create(t, gopath)
+
+	dir := filepath.Join(gopath, "src", "app")
+	cmd := exec.Command(testGo2go, "list", "-json")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GO2PATH="+gopath, "GO111MODULE=off")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("go2go list -json failed: %v\n%s", err, out)
+	}
+	var got go2go.PackageInfo
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("go2go list -json printed invalid JSON: %v\n%s", err, out)
+	}
+	want := go2go.PackageInfo{
+		Dir:          dir,
+		ImportPath:   "app",
+		Name:         "main",
+		Go2Files:     []string{"main.go2"},
+		TestGo2Files: []string{"main_test.go2"},
+		GoFiles:      []string{"instantiations.go", "instantiations_test.go", "main.go", "main_test.go"},
+		Imports:      []string{"list"},
+		Go2Imports:   []string{"list"},
+		TestImports:  []string{"list"},
+		Instantiations: []*go2go.Instance{
+			{Package: "app", Name: "first", Kind: "func", TypeArgs: []string{"app.point"}, InstantiatedIn: "app"},
+			{Package: "list", Name: "Of", Kind: "func", TypeArgs: []string{"int"}, InstantiatedIn: "list"},
+		},
+		TestInstantiations: []*go2go.Instance{
+			{Package: "list", Name: "List", Kind: "type", TypeArgs: []string{"string"}, InstantiatedIn: "app"},
+			{Package: "list", Name: "Of", Kind: "func", TypeArgs: []string{"string"}, InstantiatedIn: "app"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("go2go list -json printed\n%s\nwant %+v", out, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "main.go")); !os.IsNotExist(err) {
+		t.Errorf("go2go list wrote main.go: %v", err)
+	}
+
+	cmd = exec.Command(testGo2go, "list", "-json", "list")
+	cmd.Env = append(os.Environ(), "GO2PATH="+gopath, "GO111MODULE=off")
+	out, err = cmd.Output()
+	if err != nil {
+		t.Fatalf("go2go list -json list failed: %v\n%s", err, out)
+	}
+	got = go2go.PackageInfo{}
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("go2go list -json printed invalid JSON: %v\n%s", err, out)
+	}
+	wantGenerics := []*go2go.Generic{
+		{Name: "List", Kind: "type", TypeParams: []string{"T"}},
+		{Name: "Of", Kind: "func", TypeParams: []string{"T"}},
+	}
+	if !reflect.DeepEqual(got.Generics, wantGenerics) {
+		t.Errorf("go2go list -json list printed\n%s\nwant generics %+v", out, wantGenerics)
+	}
+
+	cmd = exec.Command(testGo2go, "list")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GO2PATH="+gopath, "GO111MODULE=off")
+	if out, err := cmd.Output(); err != nil || string(out) != "app\n" {
+		t.Errorf("go2go list printed %q, %v; want %q", out, err, "app\n")
+	}
+}
@@ -0,0 +1,757 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/tdakkota/go2go/golib/ast"
+	"github.com/tdakkota/go2go/golib/format"
+	"github.com/tdakkota/go2go/golib/go2go"
+	"github.com/tdakkota/go2go/golib/parser"
+	"github.com/tdakkota/go2go/golib/scanner"
+	"github.com/tdakkota/go2go/golib/token"
+	"github.com/tdakkota/go2go/golib/types"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// An lspServer is a language server for .go2 files, speaking the
+// Language Server Protocol over a pair of streams.
+//
+// The server keeps the text of the documents that the client has
+// opened, and type checks the package of a document whenever the
+// document changes. Imported .go2 packages are read through the same
+// documents, so unsaved edits are seen by the packages importing them.
+type lspServer struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	root     string // workspace root directory
+	fset     *token.FileSet
+	importer *go2go.Importer
+	lister   *go2go.Importer        // selects the files of packages, without tracking
+	imported map[string]bool        // directories read by importer
+	docs     map[string][]byte      // text of open documents, by file name
+	files    map[string]*lspFile    // parsed files, by file name
+	pkgs     map[string]*lspPackage // checked packages, by directory
+
+	shutdown bool // whether the client asked the server to shut down
+}
+
+// An lspFile is a parsed .go2 file. It is parsed again only when its
+// text changes.
+type lspFile struct {
+	src  []byte
+	file *ast.File
+	errs scanner.ErrorList
+}
+
+// An lspPackage is the result of type checking the .go2 files of
+// a directory, including test files.
+type lspPackage struct {
+	dir   string
+	files []string // file names, sorted
+	pkgs  []*types.Package
+	info  *types.Info
+	diags map[string][]Diagnostic // by file name
+}
+
+// serveLSP runs a language server reading requests from r and writing
+// responses to w, until the client asks it to exit.
+func serveLSP(r io.Reader, w io.Writer) error {
+	s := &lspServer{
+		in:    bufio.NewReader(r),
+		out:   w,
+		root:  ".",
+		fset:  token.NewFileSet(),
+		docs:  make(map[string][]byte),
+		files: make(map[string]*lspFile),
+		pkgs:  make(map[string]*lspPackage),
+	}
+	s.lister = go2go.NewImporterFS(lspFS{s: s})
+	s.resetImporter()
+	for {
+		msg, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg == nil {
+			// Malformed JSON; reported already.
+			continue
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("lsp: exit without shutdown")
+			}
+			return nil
+		}
+		result, rerr := s.handle(msg)
+		if msg.ID == nil {
+			// A notification gets no response.
+			continue
+		}
+		if err := s.respond(msg.ID, result, rerr); err != nil {
+			return err
+		}
+	}
+}
+
+// read reads the next message from the client. It returns a nil
+// message if the message is not valid JSON.
+func (s *lspServer) read() (*rpcMessage, error) {
+	length := -1
+	for {
+		line, err := s.in.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" && length < 0 {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("lsp: reading header: %v", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			return nil, fmt.Errorf("lsp: invalid header %q", line)
+		}
+		if strings.EqualFold(line[:i], "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(line[i+1:]))
+			if err != nil || length < 0 {
+				return nil, fmt.Errorf("lsp: invalid header %q", line)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("lsp: missing Content-Length header")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, fmt.Errorf("lsp: reading message: %v", err)
+	}
+	var msg rpcMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		null := json.RawMessage("null")
+		return nil, s.respond(&null, nil, &rpcError{codeParseError, err.Error()})
+	}
+	return &msg, nil
+}
+
+// write writes a message to the client.
+func (s *lspServer) write(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n", len(data)); err != nil {
+		return err
+	}
+	_, err = s.out.Write(data)
+	return err
+}
+
+// respond sends the response to the request id.
+func (s *lspServer) respond(id *json.RawMessage, result interface{}, rerr *rpcError) error {
+	resp := rpcResponse{JSONRPC: "2.0", ID: id, Error: rerr}
+	if rerr == nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		resp.Result = data
+	}
+	return s.write(resp)
+}
+
+// notify sends a notification to the client.
+func (s *lspServer) notify(method string, params interface{}) error {
+	return s.write(rpcNotification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// handle handles a request or notification, and returns the result
+// of a request.
+func (s *lspServer) handle(msg *rpcMessage) (interface{}, *rpcError) {
+	// unmarshal decodes the parameters into v.
+	unmarshal := func(v interface{}) *rpcError {
+		if err := json.Unmarshal(msg.Params, v); err != nil {
+			return &rpcError{codeInvalidParams, err.Error()}
+		}
+		return nil
+	}
+
+	switch msg.Method {
+	case "initialize":
+		var params initializeParams
+		if err := unmarshal(&params); err != nil {
+			return nil, err
+		}
+		if params.RootURI != "" {
+			s.root = uriToPath(params.RootURI)
+			s.resetImporter()
+		}
+		return initializeResult{
+			Capabilities: serverCapabilities{
+				TextDocumentSync:           syncIncremental,
+				HoverProvider:              true,
+				DefinitionProvider:         true,
+				ReferencesProvider:         true,
+				DocumentFormattingProvider: true,
+			},
+			ServerInfo: serverInfo{Name: "go2go"},
+		}, nil
+
+	case "initialized":
+		return nil, nil
+
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := unmarshal(&params); err != nil {
+			return nil, err
+		}
+		s.update(uriToPath(params.TextDocument.URI), []byte(params.TextDocument.Text))
+		return nil, nil
+
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := unmarshal(&params); err != nil {
+			return nil, err
+		}
+		filename := uriToPath(params.TextDocument.URI)
+		src, ok := s.docs[filename]
+		if !ok {
+			return nil, nil
+		}
+		for _, change := range params.ContentChanges {
+			if change.Range == nil {
+				src = []byte(change.Text)
+				continue
+			}
+			start := offsetOf(src, change.Range.Start)
+			end := offsetOf(src, change.Range.End)
+			if end < start {
+				end = start
+			}
+			src = append(append(append([]byte(nil), src[:start]...), change.Text...), src[end:]...)
+		}
+		s.update(filename, src)
+		return nil, nil
+
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := unmarshal(&params); err != nil {
+			return nil, err
+		}
+		s.update(uriToPath(params.TextDocument.URI), nil)
+		return nil, nil
+
+	case "textDocument/hover":
+		var params textDocumentPositionParams
+		if err := unmarshal(&params); err != nil {
+			return nil, err
+		}
+		return s.hover(params), nil
+
+	case "textDocument/definition":
+		var params textDocumentPositionParams
+		if err := unmarshal(&params); err != nil {
+			return nil, err
+		}
+		return s.definition(params), nil
+
+	case "textDocument/references":
+		var params referenceParams
+		if err := unmarshal(&params); err != nil {
+			return nil, err
+		}
+		return s.references(params), nil
+
+	case "textDocument/formatting":
+		var params documentFormattingParams
+		if err := unmarshal(&params); err != nil {
+			return nil, err
+		}
+		return s.formatting(params), nil
+	}
+
+	if msg.ID == nil || strings.HasPrefix(msg.Method, "$/") {
+		// Notifications that the server does not know are ignored.
+		return nil, nil
+	}
+	if msg.Method == "" {
+		return nil, &rpcError{codeInvalidRequest, "missing method"}
+	}
+	return nil, &rpcError{codeMethodNotFound, "method not supported: " + msg.Method}
+}
+
+// resetImporter starts over with a new Importer, so that imported
+// packages are translated again.
+func (s *lspServer) resetImporter() {
+	s.imported = make(map[string]bool)
+	s.importer = go2go.NewImporterFS(lspFS{s: s, track: true})
+	if os.Getenv("GO111MODULE") != "off" {
+		// Without a go.mod file, packages are found in GO2PATH.
+		s.importer.FindModule(s.root)
+	}
+}
+
+// update records the new text of the document filename, or that the
+// document was closed if src is nil, and checks its package again.
+// If the package is imported by the checked packages, they are all
+// checked again.
+func (s *lspServer) update(filename string, src []byte) {
+	if filepath.Ext(filename) != ".go2" {
+		return
+	}
+	if src == nil {
+		delete(s.docs, filename)
+	} else {
+		s.docs[filename] = src
+	}
+
+	dir := filepath.Dir(filename)
+	if !s.imported[dir] {
+		s.check(dir)
+		return
+	}
+
+	s.resetImporter()
+	dirs := []string{dir}
+	for d := range s.pkgs {
+		if d != dir {
+			dirs = append(dirs, d)
+		}
+	}
+	sort.Strings(dirs[1:])
+	for _, d := range dirs {
+		s.check(d)
+	}
+}
+
+// check parses and type checks the .go2 files in dir, with the
+// hand-written .go files, and publishes the diagnostics for each of
+// them. A package whose files are no longer open is forgotten, after
+// its diagnostics are cleared.
+func (s *lspServer) check(dir string) {
+	old := s.pkgs[dir]
+	p := &lspPackage{
+		dir:   dir,
+		diags: make(map[string][]Diagnostic),
+		info: &types.Info{
+			Types: make(map[ast.Expr]types.TypeAndValue),
+			Defs:  make(map[*ast.Ident]types.Object),
+			Uses:  make(map[*ast.Ident]types.Object),
+		},
+	}
+
+	open := false
+	go2files, gofiles, _ := s.lister.PackageFiles(dir)
+	for _, name := range go2files {
+		filename := filepath.Join(dir, name)
+		if _, ok := s.docs[filename]; ok {
+			open = true
+		}
+		p.files = append(p.files, filename)
+	}
+	// Hand-written .go files are type checked with the .go2 files.
+	for _, name := range gofiles {
+		p.files = append(p.files, filepath.Join(dir, name))
+	}
+	sort.Strings(p.files)
+
+	if !open {
+		delete(s.pkgs, dir)
+	} else {
+		s.pkgs[dir] = p
+		s.checkPackage(p)
+	}
+
+	for _, filename := range p.files {
+		s.publish(filename, p.diags[filename])
+	}
+	if old != nil {
+		// Clear the diagnostics of files that were removed.
+		for _, filename := range old.files {
+			if _, ok := p.diags[filename]; !ok && !contains(p.files, filename) {
+				s.publish(filename, nil)
+			}
+		}
+	}
+}
+
+// checkPackage parses the files of p, when they changed, and type
+// checks them, recording the problems found.
+func (s *lspServer) checkPackage(p *lspPackage) {
+	var pkgNames []string
+	pkgFiles := make(map[string][]*ast.File)
+	parseFailed := false
+	for _, filename := range p.files {
+		src, err := lspFS{s: s}.ReadFile(filename)
+		if err != nil {
+			continue
+		}
+		f := s.files[filename]
+		if f == nil || !bytes.Equal(f.src, src) {
+			f = &lspFile{src: src}
+			f.file, err = parser.ParseFile(s.fset, filename, src, parser.AllErrors)
+			if el, ok := err.(scanner.ErrorList); ok {
+				f.errs = el
+			}
+			s.files[filename] = f
+		}
+		for _, e := range f.errs {
+			p.addDiag(f, e.Pos, "syntax", e.Msg)
+		}
+		if f.errs != nil || f.file == nil {
+			parseFailed = true
+			continue
+		}
+		name := f.file.Name.Name
+		if pkgFiles[name] == nil {
+			pkgNames = append(pkgNames, name)
+		}
+		pkgFiles[name] = append(pkgFiles[name], f.file)
+	}
+	if parseFailed {
+		// Type errors in partly parsed files are mostly noise.
+		return
+	}
+
+	sort.Strings(pkgNames)
+	for _, name := range pkgNames {
+		conf := types.Config{
+			Importer: s.importer,
+			Error: func(err error) {
+				if terr, ok := err.(types.Error); ok {
+					pos := s.fset.Position(terr.Pos)
+					p.addDiag(s.files[pos.Filename], pos, "type", terr.Msg)
+				}
+			},
+		}
+		pkg, _ := conf.Check(name, s.fset, pkgFiles[name], p.info)
+		p.pkgs = append(p.pkgs, pkg)
+	}
+}
+
+// addDiag records a problem at pos in f.
+func (p *lspPackage) addDiag(f *lspFile, pos token.Position, source, msg string) {
+	if f == nil {
+		return
+	}
+	start := lspPosition(f.src, pos)
+	p.diags[pos.Filename] = append(p.diags[pos.Filename], Diagnostic{
+		Range:    Range{Start: start, End: start},
+		Severity: severityError,
+		Source:   "go2go " + source,
+		Message:  msg,
+	})
+}
+
+// publish sends the diagnostics of a file to the client.
+func (s *lspServer) publish(filename string, diags []Diagnostic) {
+	if diags == nil {
+		diags = []Diagnostic{}
+	}
+	s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         pathToURI(filename),
+		Diagnostics: diags,
+	})
+}
+
+// identAt returns the package holding the checked document at pos,
+// and the identifier at pos, if any, with the object that it denotes.
+func (s *lspServer) identAt(params textDocumentPositionParams) (*lspPackage, *ast.Ident, types.Object) {
+	filename := uriToPath(params.TextDocument.URI)
+	p, f, pos := s.position(filename, params.Position)
+	if p == nil {
+		return nil, nil, nil
+	}
+	var id *ast.Ident
+	ast.Inspect(f.file, func(n ast.Node) bool {
+		if n == nil || id != nil || pos < n.Pos() || pos > n.End() {
+			return false
+		}
+		if n, ok := n.(*ast.Ident); ok {
+			id = n
+		}
+		return true
+	})
+	if id == nil {
+		return p, nil, nil
+	}
+	obj := p.info.Defs[id]
+	if obj == nil {
+		obj = p.info.Uses[id]
+	}
+	return p, id, obj
+}
+
+// position returns the checked package and the parsed file holding
+// filename, and the position in it of the LSP position lpos.
+func (s *lspServer) position(filename string, lpos Position) (*lspPackage, *lspFile, token.Pos) {
+	p := s.pkgs[filepath.Dir(filename)]
+	f := s.files[filename]
+	if p == nil || f == nil || f.file == nil {
+		return nil, nil, token.NoPos
+	}
+	tf := s.fset.File(f.file.Pos())
+	if tf == nil {
+		return nil, nil, token.NoPos
+	}
+	return p, f, tf.Pos(offsetOf(f.src, lpos))
+}
+
+// hover returns the declaration of the object denoted by the
+// identifier at a position, or the type of the innermost expression.
+func (s *lspServer) hover(params textDocumentPositionParams) interface{} {
+	p, id, obj := s.identAt(params)
+	if p == nil {
+		return nil
+	}
+	var text string
+	var node ast.Node
+	if obj != nil {
+		text = types.ObjectString(obj, s.qualifier(p))
+		node = id
+	} else {
+		_, f, pos := s.position(uriToPath(params.TextDocument.URI), params.Position)
+		var expr ast.Expr
+		for e, tv := range p.info.Types {
+			if tv.Type == nil || pos < e.Pos() || pos > e.End() || s.fset.File(e.Pos()) != s.fset.File(f.file.Pos()) {
+				continue
+			}
+			if expr == nil || e.End()-e.Pos() < expr.End()-expr.Pos() {
+				expr = e
+			}
+		}
+		if expr == nil {
+			return nil
+		}
+		tv := p.info.Types[expr]
+		text = types.TypeString(tv.Type, s.qualifier(p))
+		if tv.Value != nil {
+			text += " = " + tv.Value.String()
+		}
+		node = expr
+	}
+	r := s.lspRange(node.Pos(), node.End())
+	return hover{
+		Contents: markupContent{Kind: "markdown", Value: "```go\n" + text + "\n```"},
+		Range:    &r,
+	}
+}
+
+// definition returns the location of the declaration of the object
+// denoted by the identifier at a position. Only declarations in the
+// checked packages are found.
+func (s *lspServer) definition(params textDocumentPositionParams) interface{} {
+	_, _, obj := s.identAt(params)
+	if obj == nil || !obj.Pos().IsValid() || !s.isChecked(obj.Pkg()) {
+		return nil
+	}
+	return []Location{s.location(obj.Pos(), obj.Pos()+token.Pos(len(obj.Name())))}
+}
+
+// references returns the locations of the identifiers in the package
+// that denote the object denoted by the identifier at a position.
+func (s *lspServer) references(params referenceParams) interface{} {
+	p, _, obj := s.identAt(params.textDocumentPositionParams)
+	if obj == nil {
+		return nil
+	}
+	var ids []*ast.Ident
+	if params.Context.IncludeDeclaration {
+		for id, def := range p.info.Defs {
+			if def == obj {
+				ids = append(ids, id)
+			}
+		}
+	}
+	for id, use := range p.info.Uses {
+		if use == obj {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].Pos() < ids[j].Pos()
+	})
+	locs := []Location{}
+	for _, id := range ids {
+		locs = append(locs, s.location(id.Pos(), id.End()))
+	}
+	return locs
+}
+
+// formatting returns an edit replacing the whole document with its
+// formatted text, or no edits if it does not parse.
+func (s *lspServer) formatting(params documentFormattingParams) interface{} {
+	filename := uriToPath(params.TextDocument.URI)
+	src, err := lspFS{s: s}.ReadFile(filename)
+	if err != nil {
+		return nil
+	}
+	formatted, err := format.Source(src)
+	if err != nil || bytes.Equal(formatted, src) {
+		return []TextEdit{}
+	}
+	end := offsetPosition(src, len(src))
+	return []TextEdit{{
+		Range:   Range{Start: Position{}, End: end},
+		NewText: string(formatted),
+	}}
+}
+
+// isChecked reports whether pkg is one of the checked packages.
+func (s *lspServer) isChecked(pkg *types.Package) bool {
+	for _, p := range s.pkgs {
+		for _, q := range p.pkgs {
+			if q == pkg {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// qualifier qualifies the names of packages other than those of p.
+func (s *lspServer) qualifier(p *lspPackage) types.Qualifier {
+	return func(pkg *types.Package) string {
+		for _, q := range p.pkgs {
+			if q == pkg {
+				return ""
+			}
+		}
+		return pkg.Name()
+	}
+}
+
+// location returns the location of the text from start to end.
+func (s *lspServer) location(start, end token.Pos) Location {
+	return Location{
+		URI:   pathToURI(s.fset.Position(start).Filename),
+		Range: s.lspRange(start, end),
+	}
+}
+
+// lspRange returns the range of the text from start to end.
+func (s *lspServer) lspRange(start, end token.Pos) Range {
+	p, q := s.fset.Position(start), s.fset.Position(end)
+	var src []byte
+	if f := s.files[p.Filename]; f != nil {
+		src = f.src
+	}
+	return Range{Start: lspPosition(src, p), End: lspPosition(src, q)}
+}
+
+// lspPosition converts pos, in src, to an LSP position.
+func lspPosition(src []byte, pos token.Position) Position {
+	if pos.Line < 1 {
+		return Position{}
+	}
+	return offsetPosition(src, pos.Offset)
+}
+
+// offsetPosition returns the LSP position of the byte offset off in src.
+func offsetPosition(src []byte, off int) Position {
+	if off > len(src) {
+		off = len(src)
+	}
+	line := bytes.Count(src[:off], []byte("\n"))
+	lineStart := bytes.LastIndexByte(src[:off], '\n') + 1
+	return Position{Line: line, Character: utf16Len(src[lineStart:off])}
+}
+
+// offsetOf returns the byte offset in src of the LSP position pos.
+func offsetOf(src []byte, pos Position) int {
+	off := 0
+	for line := 0; line < pos.Line; line++ {
+		i := bytes.IndexByte(src[off:], '\n')
+		if i < 0 {
+			return len(src)
+		}
+		off += i + 1
+	}
+	for n := 0; n < pos.Character && off < len(src) && src[off] != '\n'; {
+		r, size := utf8.DecodeRune(src[off:])
+		n += len(utf16.Encode([]rune{r}))
+		off += size
+	}
+	return off
+}
+
+// utf16Len returns the length of b in UTF-16 code units.
+func utf16Len(b []byte) int {
+	n := 0
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		n += len(utf16.Encode([]rune{r}))
+		b = b[size:]
+	}
+	return n
+}
+
+// uriToPath returns the file name of a file URI.
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// pathToURI returns the file URI of a file name.
+func pathToURI(filename string) string {
+	if abs, err := filepath.Abs(filename); err == nil {
+		filename = abs
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(filename)}).String()
+}
+
+// lspFS is the FileSystem of the server: the files on the disk,
+// with the text of the open documents in place of their contents.
+type lspFS struct {
+	s     *lspServer
+	track bool // record the directories read in s.imported
+}
+
+func (fsys lspFS) ReadDir(dir string) ([]string, error) {
+	names, err := go2go.OSFS.ReadDir(dir)
+	dir = filepath.Clean(dir)
+	if fsys.track {
+		fsys.s.imported[dir] = true
+	}
+	for filename := range fsys.s.docs {
+		if filepath.Dir(filename) == dir && !contains(names, filepath.Base(filename)) {
+			names = append(names, filepath.Base(filename))
+			err = nil
+		}
+	}
+	sort.Strings(names)
+	return names, err
+}
+
+func (fsys lspFS) ReadFile(name string) ([]byte, error) {
+	if src, ok := fsys.s.docs[filepath.Clean(name)]; ok {
+		return src, nil
+	}
+	return go2go.OSFS.ReadFile(name)
+}
@@ -0,0 +1,304 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// An lspClient talks to a go2go lsp process in tests.
+type lspClient struct {
+	t   *testing.T
+	in  io.Writer
+	out *bufio.Reader
+	id  int
+}
+
+// send sends a request, or a notification if id is false,
+// and returns the request ID.
+func (c *lspClient) send(method string, params interface{}, id bool) int {
+	c.t.Helper()
+	msg := map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}
+	if id {
+		c.id++
+		msg["id"] = c.id
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if _, err := fmt.Fprintf(c.in, "Content-Length: %d\r\n\r\n%s", len(data), data); err != nil {
+		c.t.Fatal(err)
+	}
+	return c.id
+}
+
+// lspMessage is a message from the server.
+type lspMessage struct {
+	ID     *int
+	Method string
+	Params json.RawMessage
+	Result json.RawMessage
+	Error  *struct{ Message string }
+}
+
+// read returns the next message from the server.
+func (c *lspClient) read() *lspMessage {
+	c.t.Helper()
+	length := 0
+	for {
+		line, err := c.out.ReadString('\n')
+		if err != nil {
+			c.t.Fatalf("reading from go2go lsp: %v", err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "Content-Length: ") {
+			length, _ = strconv.Atoi(strings.TrimPrefix(line, "Content-Length: "))
+		}
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(c.out, data); err != nil {
+		c.t.Fatalf("reading from go2go lsp: %v", err)
+	}
+	var msg lspMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		c.t.Fatalf("go2go lsp sent invalid JSON %s: %v", data, err)
+	}
+	return &msg
+}
+
+// call sends a request and decodes its result into result, skipping
+// the notifications sent before the response.
+func (c *lspClient) call(method string, params, result interface{}) {
+	c.t.Helper()
+	id := c.send(method, params, true)
+	for {
+		msg := c.read()
+		if msg.ID == nil || *msg.ID != id {
+			continue
+		}
+		if msg.Error != nil {
+			c.t.Fatalf("%s failed: %s", method, msg.Error.Message)
+		}
+		if err := json.Unmarshal(msg.Result, result); err != nil {
+			c.t.Fatalf("%s: decoding result %s: %v", method, msg.Result, err)
+		}
+		return
+	}
+}
+
+type lspDiagnostic struct {
+	Range struct {
+		Start struct{ Line, Character int }
+	}
+	Message string
+}
+
+// diagnostics returns the next diagnostics published for uri.
+func (c *lspClient) diagnostics(uri string) []lspDiagnostic {
+	c.t.Helper()
+	for {
+		msg := c.read()
+		if msg.Method != "textDocument/publishDiagnostics" {
+			continue
+		}
+		var params struct {
+			URI         string
+			Diagnostics []lspDiagnostic
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			c.t.Fatal(err)
+		}
+		if params.URI == uri {
+			return params.Diagnostics
+		}
+	}
+}
+
+func TestLSP(t *testing.T) {
+	t.Parallel()
+	buildGo2go(t)
+
+	gopath, err := ioutil.TempDir("", "go2go-l-s-p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	testFiles{
+		{
+			"lib/lib.go2",
+			`package lib
+
+// Pair is a pair of values.
+type Pair(type T) struct{ A, B T }
+
+func First(type T)(p Pair(T)) T { return p.A }
+`,
+		},
+		{
+			"app/main.go2",
+			`package main
+
+import "lib"
+
+func main() {
+	p := lib.Pair(int){1, 2}
+	var s string = lib.First(p)
+	println(s, p.B)
+}
+`,
+		},
+	}.create(t, gopath)
+
+	cmd := exec.Command(testGo2go, "lsp")
+	cmd.Env = append(os.Environ(), "GO2PATH="+gopath, "GO111MODULE=off")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+	c := &lspClient{t: t, in: stdin, out: bufio.NewReader(stdout)}
+
+	uri := func(name string) string {
+		return "file://" + filepath.ToSlash(filepath.Join(gopath, "src", name))
+	}
+	doc := func(name string) map[string]interface{} {
+		return map[string]interface{}{"uri": uri(name)}
+	}
+	pos := func(name string, line, char int) map[string]interface{} {
+		return map[string]interface{}{
+			"textDocument": doc(name),
+			"position":     map[string]int{"line": line, "character": char},
+		}
+	}
+
+	var initResult struct {
+		Capabilities struct {
+			HoverProvider bool
+		}
+	}
+	c.call("initialize", map[string]interface{}{"rootUri": "file://" + filepath.ToSlash(gopath)}, &initResult)
+	if !initResult.Capabilities.HoverProvider {
+		t.Errorf("initialize result does not provide hover")
+	}
+	c.send("initialized", map[string]interface{}{}, false)
+
+	main, err := ioutil.ReadFile(filepath.Join(gopath, "src", "app", "main.go2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.send("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri("app/main.go2"), "version": 1, "text": string(main)},
+	}, false)
+	diags := c.diagnostics(uri("app/main.go2"))
+	if len(diags) != 1 || diags[0].Range.Start.Line != 6 || !strings.Contains(diags[0].Message, "cannot use lib.First(p)") {
+		t.Errorf("diagnostics for main.go2: got %+v, want an error on line 6 for lib.First(p)", diags)
+	}
+
+	var h struct{ Contents struct{ Value string } }
+	c.call("textDocument/hover", pos("app/main.go2", 7, 12), &h)
+	if want := "var p lib.Pair(int)"; !strings.Contains(h.Contents.Value, want) {
+		t.Errorf("hover on p: got %q, want %q", h.Contents.Value, want)
+	}
+
+	var locs []struct {
+		URI   string
+		Range struct {
+			Start struct{ Line, Character int }
+		}
+	}
+	c.call("textDocument/definition", pos("app/main.go2", 7, 12), &locs)
+	if len(locs) != 1 || locs[0].URI != uri("app/main.go2") || locs[0].Range.Start.Line != 5 || locs[0].Range.Start.Character != 1 {
+		t.Errorf("definition of p: got %+v, want main.go2 line 5", locs)
+	}
+
+	refs := pos("app/main.go2", 5, 1)
+	refs["context"] = map[string]bool{"includeDeclaration": true}
+	c.call("textDocument/references", refs, &locs)
+	var lines []int
+	for _, loc := range locs {
+		lines = append(lines, loc.Range.Start.Line)
+	}
+	if want := []int{5, 6, 7}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("references to p: got lines %v, want %v", lines, want)
+	}
+
+	// Fix the error with an incremental change.
+	c.send("textDocument/didChange", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri("app/main.go2"), "version": 2},
+		"contentChanges": []interface{}{
+			map[string]interface{}{
+				"range": map[string]interface{}{
+					"start": map[string]int{"line": 6, "character": 7},
+					"end":   map[string]int{"line": 6, "character": 13},
+				},
+				"text": "int",
+			},
+		},
+	}, false)
+	if diags := c.diagnostics(uri("app/main.go2")); len(diags) != 0 {
+		t.Errorf("diagnostics after fix: got %+v, want none", diags)
+	}
+
+	// An unsaved edit of an imported package is seen by the
+	// packages that import it.
+	c.send("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{
+			"uri":     uri("lib/lib.go2"),
+			"version": 1,
+			"text":    "package lib\n\ntype Pair(type T) struct{ A, B T }\n\nfunc Head(type T)(p Pair(T)) T {return p.A}\n",
+		},
+	}, false)
+	if diags := c.diagnostics(uri("lib/lib.go2")); len(diags) != 0 {
+		t.Errorf("diagnostics for lib.go2: got %+v, want none", diags)
+	}
+	diags = c.diagnostics(uri("app/main.go2"))
+	if len(diags) != 1 || !strings.Contains(diags[0].Message, "First") {
+		t.Errorf("diagnostics for main.go2 after editing lib.go2: got %+v, want an error for First", diags)
+	}
+
+	var edits []struct{ NewText string }
+	c.call("textDocument/formatting", map[string]interface{}{"textDocument": doc("lib/lib.go2")}, &edits)
+	if len(edits) != 1 || !strings.Contains(edits[0].NewText, "T { return p.A }") {
+		t.Errorf("formatting lib.go2: got %+v", edits)
+	}
+
+	var null interface{}
+	c.call("shutdown", nil, &null)
+	c.send("exit", nil, false)
+	stdin.Close()
+	if err := cmd.Wait(); err != nil {
+		t.Errorf("go2go lsp failed: %v\n%s", err, stderr.String())
+	}
+
+	// Nothing is written to the disk.
+	if _, err := os.Stat(filepath.Join(gopath, "src", "app", "main.go")); !os.IsNotExist(err) {
+		t.Errorf("go2go lsp wrote main.go: %v", err)
+	}
+}
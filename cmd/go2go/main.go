@@ -5,8 +5,10 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"github.com/tdakkota/go2go/golib/build"
 	"github.com/tdakkota/go2go/golib/go2go"
 	"io/ioutil"
 	"log"
@@ -19,11 +21,26 @@ import (
 
 var gotool = filepath.Join(runtime.GOROOT(), "bin", "go")
 
+var parallel = flag.Int("p", runtime.NumCPU(), "number of packages to translate in parallel")
+
+var names = flag.String("names", "mangled", "how to name instantiations: mangled or readable")
+
+var tags = flag.String("tags", "", "comma-separated list of build tags to consider satisfied")
+
 var cmds = map[string]bool{
 	"build":     true,
+	"check":     true,
+	"clean":     true,
+	"doc":       true,
+	"fmt":       true,
+	"list":      true,
+	"lsp":       true,
+	"migrate":   true,
 	"run":       true,
+	"serve":     true,
 	"test":      true,
 	"translate": true,
+	"vet":       true,
 }
 
 func main() {
@@ -38,6 +55,66 @@ func main() {
 		usage()
 	}
 
+	if args[0] == "fmt" {
+		os.Exit(gofmt(args[1:]))
+	}
+
+	if args[0] == "serve" {
+		serve(args[1:])
+		return
+	}
+
+	if args[0] == "lsp" {
+		if err := serveLSP(os.Stdin, os.Stdout); err != nil {
+			die(err.Error())
+		}
+		return
+	}
+
+	var outdir string
+	if args[0] == "translate" {
+		outdir, args = translateFlags(args[1:])
+		args = append([]string{"translate"}, args...)
+	}
+
+	if args[0] == "check" || args[0] == "list" || outdir != "" {
+		// Packages are translated in memory, so that nothing
+		// is written to the disk, except to an output tree.
+		importer := go2go.NewImporterFS(go2go.OSFS)
+		modules := configure(importer)
+		ok := true
+		switch args[0] {
+		case "check":
+			ok = check(importer, expandPackages(importer, modules, args[1:]))
+		case "list":
+			asJSON, pkgs := listFlags(args[1:])
+			ok = list(importer, expandPackages(importer, modules, pkgs), asJSON)
+		case "translate":
+			translateTo(importer, expandPackages(importer, modules, args[1:]), outdir)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+
+	cacheDir, err := go2go.DefaultCacheDir()
+	if err != nil {
+		die(err.Error())
+	}
+
+	if args[0] == "clean" {
+		if len(args) != 2 || args[1] != "-cache" {
+			usage()
+		}
+		if cacheDir != "" {
+			if err := go2go.CleanCache(cacheDir); err != nil {
+				die(err.Error())
+			}
+		}
+		return
+	}
+
 	importerTmpdir, err := ioutil.TempDir("", "go2go")
 	if err != nil {
 		log.Fatal(err)
@@ -45,53 +122,131 @@ func main() {
 	defer os.RemoveAll(importerTmpdir)
 
 	importer := go2go.NewImporter(importerTmpdir)
+	importer.SetCacheDir(cacheDir)
+	modules := configure(importer)
+
+	if args[0] == "doc" {
+		showDoc(importer, modules, args[1:])
+		return
+	}
+
+	if args[0] == "vet" {
+		analyzers, pkgs := vetAnalyzers(args[1:])
+		if !vet(importer, analyzers, expandPackages(importer, modules, pkgs)) {
+			os.RemoveAll(importerTmpdir)
+			os.Exit(1)
+		}
+		return
+	}
 
 	var rundir string
+	overlay := make(map[string]string)
 	if args[0] == "run" {
 		tmpdir := copyToTmpdir(args[1:])
 		defer os.RemoveAll(tmpdir)
 		translate(importer, tmpdir)
-		nargs := []string{"run"}
+		var files []string
 		for _, arg := range args[1:] {
 			base := filepath.Base(arg)
 			f := strings.TrimSuffix(base, ".go2") + ".go"
-			nargs = append(nargs, f)
+			files = append(files, f)
+		}
+		// Instantiations are written to a file of their own.
+		if _, err := os.Stat(filepath.Join(tmpdir, go2go.InstantiationsFile)); err == nil {
+			files = append(files, go2go.InstantiationsFile)
 		}
-		args = nargs
-		rundir = tmpdir
+		if modules {
+			// Run the translated files as though they were
+			// in the source directory, so that the go command
+			// finds the main module.
+			srcdir, err := filepath.Abs(filepath.Dir(args[1]))
+			if err != nil {
+				die(err.Error())
+			}
+			for i, f := range files {
+				files[i] = filepath.Join(srcdir, f)
+				overlay[files[i]] = filepath.Join(tmpdir, f)
+			}
+		} else {
+			rundir = tmpdir
+		}
+		args = append([]string{"run"}, files...)
 	} else if args[0] == "translate" && isGo2Files(args[1:]...) {
 		for _, arg := range args[1:] {
 			translateFile(importer, arg)
 		}
+	} else if args[0] == "migrate" {
+		migrate(importer, expandPackages(importer, modules, args[1:]))
 	} else {
-		for _, dir := range expandPackages(args[1:]) {
-			translate(importer, dir)
-		}
+		translateAll(importer, expandPackages(importer, modules, args[1:]))
 	}
 
-	if args[0] != "translate" {
+	if args[0] != "translate" && args[0] != "migrate" {
+		for k, v := range importer.Overlay() {
+			overlay[k] = v
+		}
+		if modules && len(overlay) > 0 {
+			args = append([]string{args[0], "-overlay=" + writeOverlay(importerTmpdir, overlay)}, args[1:]...)
+		}
+		if *tags != "" {
+			args = append([]string{args[0], "-tags=" + *tags}, args[1:]...)
+		}
+
 		cmd := exec.Command(gotool, args...)
 		cmd.Stdin = os.Stdin
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 		cmd.Dir = rundir
-		gopath := importerTmpdir
-		if go2path := os.Getenv("GO2PATH"); go2path != "" {
-			gopath += ":" + go2path
-		}
-		if oldGopath := os.Getenv("GOPATH"); oldGopath != "" {
-			gopath += ":" + oldGopath
+		if !modules {
+			gopath := importerTmpdir
+			if go2path := os.Getenv("GO2PATH"); go2path != "" {
+				gopath += ":" + go2path
+			}
+			if oldGopath := os.Getenv("GOPATH"); oldGopath != "" {
+				gopath += ":" + oldGopath
+			}
+			cmd.Env = append(os.Environ(),
+				"GOPATH="+gopath,
+				"GO111MODULE=off",
+			)
 		}
-		cmd.Env = append(os.Environ(),
-			"GOPATH="+gopath,
-			"GO111MODULE=off",
-		)
 		if err := cmd.Run(); err != nil {
 			die(fmt.Sprintf("%s %v failed: %v", gotool, args, err))
 		}
 	}
 }
 
+// configure sets up importer as the flags say, and looks for a go.mod
+// file. It reports whether go2go works in module mode.
+func configure(importer *go2go.Importer) bool {
+	switch *names {
+	case "mangled":
+		importer.SetNaming(go2go.MangledNames)
+	case "readable":
+		importer.SetNaming(go2go.ReadableNames)
+	default:
+		usage()
+	}
+	if *tags != "" {
+		ctxt := build.Default
+		ctxt.BuildTags = strings.FieldsFunc(*tags, func(r rune) bool {
+			return r == ',' || r == ' '
+		})
+		importer.SetBuildContext(ctxt)
+	}
+
+	// Use module mode if there is a go.mod file,
+	// unless GO111MODULE says otherwise.
+	if os.Getenv("GO111MODULE") == "off" {
+		return false
+	}
+	modules, err := importer.FindModule(".")
+	if err != nil {
+		die(err.Error())
+	}
+	return modules
+}
+
 // isGo2Files reports whether the arguments are a list of .go2 files.
 func isGo2Files(args ...string) bool {
 	for _, arg := range args {
@@ -102,8 +257,23 @@ func isGo2Files(args ...string) bool {
 	return true
 }
 
+// writeOverlay writes an overlay file for the go command's -overlay
+// flag into dir, and returns its name.
+func writeOverlay(dir string, replace map[string]string) string {
+	data, err := json.Marshal(struct{ Replace map[string]string }{replace})
+	if err != nil {
+		die(err.Error())
+	}
+	file := filepath.Join(dir, "overlay.json")
+	if err := ioutil.WriteFile(file, data, 0644); err != nil {
+		die(err.Error())
+	}
+	return file
+}
+
 // expandPackages returns a list of directories expanded from packages.
-func expandPackages(pkgs []string) []string {
+// In module mode, packages in local modules are found by the importer.
+func expandPackages(importer *go2go.Importer, modules bool, pkgs []string) []string {
 	if len(pkgs) == 0 {
 		return []string{"."}
 	}
@@ -111,6 +281,17 @@ func expandPackages(pkgs []string) []string {
 	var dirs []string
 pkgloop:
 	for _, pkg := range pkgs {
+		if modules {
+			if !strings.Contains(pkg, "...") && (filepath.IsAbs(pkg) || build.IsLocalImport(pkg)) {
+				dirs = append(dirs, pkg)
+				continue
+			}
+			if d := importer.ModuleDir(pkg); d != "" {
+				dirs = append(dirs, d)
+				continue
+			}
+		}
+
 		if go2path != "" {
 			for _, pd := range strings.Split(go2path, ":") {
 				d := filepath.Join(pd, "src", pkg)
@@ -123,7 +304,7 @@ pkgloop:
 
 		cmd := exec.Command(gotool, "list", "-f", "{{.Dir}}", pkg)
 		cmd.Stderr = os.Stderr
-		if go2path != "" {
+		if go2path != "" && !modules {
 			gopath := go2path
 			if oldGopath := os.Getenv("GOPATH"); oldGopath != "" {
 				gopath += ":" + oldGopath
@@ -165,14 +346,29 @@ func copyToTmpdir(files []string) string {
 
 // usage reports a usage message and exits with failure.
 func usage() {
-	fmt.Fprint(os.Stderr, `Usage: go2go <command> [arguments]
+	fmt.Fprint(os.Stderr, `Usage: go2go [-p n] [-names mangled|readable] [-tags tag,list] <command> [arguments]
 
 The commands are:
 
 	build      translate and build packages
+	check      type check packages, writing nothing
+	clean      remove the translation cache (clean -cache)
+	doc        show documentation for a package or symbol
+	fmt        format .go2 files (flags -l -w -d -s as for gofmt)
+	list       list packages, with -json their files and instantiations
+	lsp        run a language server for .go2 files on stdin and stdout
+	migrate    convert packages to Go 1.18 type parameters
 	run        translate and run list of files
+	serve      run a local playground (serve -http addr)
 	test       translate and test packages
-	translate  translate .go2 files into .go files
+	translate  translate .go2 files into .go files (-o dir for a separate tree)
+	vet        report likely mistakes in packages
+
+The -p flag sets the number of packages translated in parallel;
+it defaults to the number of CPUs. With -names readable, instantiated
+functions and types get readable ASCII names, listed in the file
+instantiations.names. The -tags flag lists build tags to consider
+satisfied when selecting files, as for the go command.
 `)
 	os.Exit(1)
 }
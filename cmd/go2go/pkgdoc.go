@@ -0,0 +1,339 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/tdakkota/go2go/golib/ast"
+	"github.com/tdakkota/go2go/golib/build"
+	"github.com/tdakkota/go2go/golib/doc"
+	"github.com/tdakkota/go2go/golib/go2go"
+	"github.com/tdakkota/go2go/golib/parser"
+	"github.com/tdakkota/go2go/golib/printer"
+	"github.com/tdakkota/go2go/golib/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// docPrinter prints declarations as go2go doc shows them.
+var docPrinter = printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+
+// showDoc prints the documentation of a package, or of a symbol
+// in a package, as in go2go doc [-u] [pkg] [sym[.method]].
+func showDoc(importer *go2go.Importer, modules bool, args []string) {
+	mode := doc.Mode(0)
+	if len(args) > 0 && args[0] == "-u" {
+		mode |= doc.AllDecls
+		args = args[1:]
+	}
+
+	var pkg, sym string
+	switch len(args) {
+	case 0:
+	case 1:
+		// A single argument is a package, unless it is not one
+		// and looks like the name of an exported symbol.
+		if findPackageDir(importer, modules, args[0]) == "" && isSymbol(args[0]) {
+			sym = args[0]
+		} else {
+			pkg = args[0]
+		}
+	case 2:
+		pkg, sym = args[0], args[1]
+	default:
+		usage()
+	}
+
+	dir := "."
+	if pkg != "" {
+		if dir = findPackageDir(importer, modules, pkg); dir == "" {
+			dir = expandPackages(importer, modules, []string{pkg})[0]
+		}
+	}
+	p, fset, err := loadDoc(dir, pkg, mode)
+	if err != nil {
+		die(err.Error())
+	}
+
+	if sym == "" {
+		packageDoc(os.Stdout, p, fset)
+		return
+	}
+	if !symbolDoc(os.Stdout, p, fset, sym) {
+		die(fmt.Sprintf("doc: no symbol %s in package %s", sym, p.Name))
+	}
+}
+
+// findPackageDir returns the directory of the package pkg in the
+// main module or in GO2PATH, or the directory pkg itself, or "".
+func findPackageDir(importer *go2go.Importer, modules bool, pkg string) string {
+	if filepath.IsAbs(pkg) || build.IsLocalImport(pkg) {
+		if fi, err := os.Stat(pkg); err == nil && fi.IsDir() {
+			return pkg
+		}
+		return ""
+	}
+	if modules {
+		if d := importer.ModuleDir(pkg); d != "" {
+			return d
+		}
+	}
+	if go2path := os.Getenv("GO2PATH"); go2path != "" {
+		for _, pd := range strings.Split(go2path, ":") {
+			d := filepath.Join(pd, "src", pkg)
+			if fi, err := os.Stat(d); err == nil && fi.IsDir() {
+				return d
+			}
+		}
+	}
+	return ""
+}
+
+// isSymbol reports whether s looks like an exported symbol,
+// such as List or List.Len.
+func isSymbol(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsUpper(r) && !strings.Contains(s, "/")
+}
+
+// loadDoc computes the documentation of the package in dir. Its .go2
+// files are used if there are any, and its .go files otherwise; test
+// files are ignored.
+func loadDoc(dir, importPath string, mode doc.Mode) (*doc.Package, *token.FileSet, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var go2files, gofiles []string
+	for _, fi := range fis {
+		name := fi.Name()
+		if fi.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(name, "_test.go2"), strings.HasSuffix(name, "_test.go"):
+		case strings.HasSuffix(name, ".go2"):
+			go2files = append(go2files, name)
+		case strings.HasSuffix(name, ".go"):
+			gofiles = append(gofiles, name)
+		}
+	}
+	if len(go2files) > 0 {
+		// Only the hand-written .go files are sources
+		// of a .go2 package.
+		handWritten, err := go2go.HandWrittenFiles(go2go.OSFS, dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		keep := make(map[string]bool)
+		for _, name := range handWritten {
+			keep[name] = true
+		}
+		files := go2files
+		for _, name := range gofiles {
+			if keep[name] {
+				files = append(files, name)
+			}
+		}
+		gofiles = files
+	}
+	if len(gofiles) == 0 {
+		return nil, nil, fmt.Errorf("no .go2 or .go files in %s", dir)
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range gofiles {
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(files) > 0 && f.Name.Name != files[0].Name.Name {
+			return nil, nil, fmt.Errorf("found packages %s and %s in %s", files[0].Name.Name, f.Name.Name, dir)
+		}
+		files = append(files, f)
+	}
+	p, err := doc.NewFromFiles(fset, files, importPath, mode)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, fset, nil
+}
+
+// packageDoc prints the package comment of p, followed by a summary
+// line for each of its declarations.
+func packageDoc(w io.Writer, p *doc.Package, fset *token.FileSet) {
+	if p.ImportPath != "" {
+		fmt.Fprintf(w, "package %s // import %q\n\n", p.Name, p.ImportPath)
+	} else {
+		fmt.Fprintf(w, "package %s\n\n", p.Name)
+	}
+	if p.Doc != "" {
+		doc.ToText(w, p.Doc, "", "    ", 80)
+		fmt.Fprintln(w)
+	}
+
+	var buf bytes.Buffer
+	section := func(lines ...string) {
+		for _, line := range lines {
+			fmt.Fprintln(&buf, line)
+		}
+		if buf.Len() > 0 {
+			fmt.Fprintln(&buf)
+			w.Write(buf.Bytes())
+			buf.Reset()
+		}
+	}
+	for _, v := range p.Consts {
+		section(summary(fset, v.Decl))
+	}
+	for _, v := range p.Vars {
+		section(summary(fset, v.Decl))
+	}
+	var lines []string
+	for _, c := range p.Contracts {
+		lines = append(lines, summary(fset, c.Decl))
+	}
+	section(lines...)
+	lines = nil
+	for _, f := range p.Funcs {
+		lines = append(lines, summary(fset, f.Decl))
+	}
+	section(lines...)
+	for _, t := range p.Types {
+		lines := []string{summary(fset, t.Decl)}
+		for _, f := range t.Funcs {
+			lines = append(lines, "    "+summary(fset, f.Decl))
+		}
+		section(lines...)
+	}
+}
+
+// symbolDoc prints the declaration and the documentation of the
+// symbol sym of p, and reports whether it was found.
+func symbolDoc(w io.Writer, p *doc.Package, fset *token.FileSet, sym string) bool {
+	if i := strings.Index(sym, "."); i >= 0 {
+		typ, method := sym[:i], sym[i+1:]
+		for _, t := range p.Types {
+			if t.Name != typ {
+				continue
+			}
+			for _, m := range t.Methods {
+				if m.Name == method {
+					declDoc(w, fset, m.Decl, m.Doc)
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	for _, v := range append(p.Consts, p.Vars...) {
+		if contains(v.Names, sym) {
+			declDoc(w, fset, v.Decl, v.Doc)
+			return true
+		}
+	}
+	for _, c := range p.Contracts {
+		if c.Name == sym {
+			declDoc(w, fset, c.Decl, c.Doc)
+			return true
+		}
+	}
+	for _, f := range p.Funcs {
+		if f.Name == sym {
+			declDoc(w, fset, f.Decl, f.Doc)
+			return true
+		}
+	}
+	for _, t := range p.Types {
+		for _, v := range append(t.Consts, t.Vars...) {
+			if contains(v.Names, sym) {
+				declDoc(w, fset, v.Decl, v.Doc)
+				return true
+			}
+		}
+		for _, f := range t.Funcs {
+			if f.Name == sym {
+				declDoc(w, fset, f.Decl, f.Doc)
+				return true
+			}
+		}
+		if t.Name != sym {
+			continue
+		}
+		declDoc(w, fset, t.Decl, t.Doc)
+		var lines []string
+		for _, v := range append(t.Consts, t.Vars...) {
+			lines = append(lines, summary(fset, v.Decl))
+		}
+		for _, f := range t.Funcs {
+			lines = append(lines, summary(fset, f.Decl))
+		}
+		for _, m := range t.Methods {
+			lines = append(lines, summary(fset, m.Decl))
+		}
+		if len(lines) > 0 {
+			fmt.Fprintln(w)
+			for _, line := range lines {
+				fmt.Fprintln(w, line)
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// declDoc prints the declaration decl followed by its
+// documentation text, indented.
+func declDoc(w io.Writer, fset *token.FileSet, decl ast.Decl, text string) {
+	fmt.Fprintln(w, declString(fset, decl))
+	if text != "" {
+		doc.ToText(w, text, "    ", "\t", 80)
+	}
+}
+
+// summary returns the first line of decl, with "{ ... }"
+// standing for the rest of a declaration spanning several lines.
+func summary(fset *token.FileSet, decl ast.Decl) string {
+	s := declString(fset, decl)
+	i := strings.IndexByte(s, '\n')
+	if i < 0 {
+		return s
+	}
+	s = s[:i]
+	switch {
+	case strings.HasSuffix(s, "{"):
+		return s + " ... }"
+	case strings.HasSuffix(s, "("):
+		return s + " ... )"
+	}
+	return s
+}
+
+// declString returns the source text of decl.
+func declString(fset *token.FileSet, decl ast.Decl) string {
+	var buf bytes.Buffer
+	if err := docPrinter.Fprint(&buf, fset, decl); err != nil {
+		die(err.Error())
+	}
+	return buf.String()
+}
+
+// contains reports whether list contains s.
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDoc(t *testing.T) {
+	t.Parallel()
+	buildGo2go(t)
+
+	go2path, err := filepath.Abs("testdata/go2path")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		args []string
+		dir  string
+		want []string
+	}{
+		{
+			[]string{"list"},
+			".",
+			[]string{
+				"package list // import \"list\"\n",
+				"type List(type TElem) struct { ... }\n    func New(type TElem)() *List(TElem)\n",
+			},
+		},
+		{
+			[]string{"contracts"},
+			".",
+			[]string{"contract Ordered(T) { ... }\n"},
+		},
+		{
+			[]string{"contracts", "Signed"},
+			".",
+			[]string{
+				"contract Signed(T) {\n\tT int, int8, int16, int32, int64\n}\n",
+				"    The Signed contract permits any signed integer type.\n",
+			},
+		},
+		{
+			[]string{"List.Len"},
+			filepath.Join(go2path, "src", "list"),
+			[]string{"func (l *List(TElem)) Len() int\n    Len returns the number of elements of list l."},
+		},
+	} {
+		cmd := exec.Command(testGo2go, append([]string{"doc"}, test.args...)...)
+		cmd.Dir = test.dir
+		cmd.Env = append(os.Environ(), "GO2PATH="+go2path)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Errorf("go2go doc %v failed: %v\n%s", test.args, err, out)
+			continue
+		}
+		for _, want := range test.want {
+			if !strings.Contains(string(out), want) {
+				t.Errorf("go2go doc %v output does not contain %q:\n%s", test.args, want, out)
+			}
+		}
+	}
+
+	cmd := exec.Command(testGo2go, "doc", "list", "Missing")
+	cmd.Env = append(os.Environ(), "GO2PATH="+go2path)
+	if out, err := cmd.CombinedOutput(); err == nil || !strings.Contains(string(out), "no symbol Missing in package list") {
+		t.Errorf("go2go doc list Missing: got %v\n%s", err, out)
+	}
+}
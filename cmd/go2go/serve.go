@@ -0,0 +1,434 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/tdakkota/go2go/golib/format"
+	"github.com/tdakkota/go2go/golib/go2go"
+	"github.com/tdakkota/go2go/golib/scanner"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// The limits of a program run by go2go serve.
+const (
+	maxProgSize  = 1 << 20
+	runTimeout   = 10 * time.Second
+	maxRunOutput = 1 << 20
+)
+
+// progName is the name of the file holding the program being edited.
+const progName = "prog.go2"
+
+// A serveRequest is the JSON request of a go2go serve endpoint.
+type serveRequest struct {
+	Body string // the program
+}
+
+// A serveResponse is the JSON response of a go2go serve endpoint.
+// The fields are those of the responses of the Go playground.
+type serveResponse struct {
+	Body   string `json:",omitempty"` // formatted or translated program
+	Output string `json:",omitempty"` // output of the program
+	Error  string `json:",omitempty"` // errors, one per line
+}
+
+// serve runs a local playground for .go2 programs: an HTTP server
+// with a page to edit a program, and endpoints to format, check,
+// translate and run it. Each endpoint takes the program in a JSON
+// POST request. Requests must name the server by its address, so
+// that other web sites cannot reach it through the browser.
+func serve(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("http", "localhost:8080", "HTTP service address")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: go2go serve [-http addr]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	// Programs are built with a build cache of their own,
+	// which is removed when the server stops.
+	workdir, err := ioutil.TempDir("", "go2go-serve")
+	if err != nil {
+		die(err.Error())
+	}
+	runCache = filepath.Join(workdir, "cache")
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		os.RemoveAll(workdir)
+		os.Exit(1)
+	}()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", servePage)
+	mux.HandleFunc("/fmt", serveEndpoint(formatProg))
+	mux.HandleFunc("/check", serveEndpoint(checkProg))
+	mux.HandleFunc("/translate", serveEndpoint(translateProg))
+	mux.HandleFunc("/run", serveEndpoint(runProg))
+
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		os.RemoveAll(workdir)
+		die(err.Error())
+	}
+	fmt.Fprintf(os.Stderr, "go2go serve: listening on http://%s/\n", l.Addr())
+	err = http.Serve(l, checkHost(serveHosts(*addr, l.Addr()), mux))
+	os.RemoveAll(workdir)
+	die(err.Error())
+}
+
+// serveHosts returns the host:port values by which requests may name
+// a server listening on addr, as set by the -http flag, at laddr:
+// those two addresses, and the loopback addresses with the port of
+// laddr.
+func serveHosts(addr string, laddr net.Addr) map[string]bool {
+	hosts := make(map[string]bool)
+	_, port, err := net.SplitHostPort(laddr.String())
+	if err != nil {
+		return hosts
+	}
+	names := []string{"localhost", "127.0.0.1", "::1"}
+	if host, _, err := net.SplitHostPort(addr); err == nil && host != "" {
+		names = append(names, host)
+	}
+	if ta, ok := laddr.(*net.TCPAddr); ok && !ta.IP.IsUnspecified() {
+		names = append(names, ta.IP.String())
+	}
+	for _, name := range names {
+		hosts[strings.ToLower(net.JoinHostPort(name, port))] = true
+	}
+	return hosts
+}
+
+// checkHost returns a handler that passes requests to h if their
+// Host header, and their Origin header if any, name one of hosts.
+// This keeps pages of other sites from using the server, including
+// by rebinding their own host name to the address of the server.
+func checkHost(hosts map[string]bool, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !hosts[strings.ToLower(r.Host)] {
+			http.Error(w, "unknown host "+r.Host, http.StatusForbidden)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			if err != nil || u.Scheme != "http" || !hosts[strings.ToLower(u.Host)] {
+				http.Error(w, "cross-origin request from "+origin, http.StatusForbidden)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// serveEndpoint returns a handler that calls f with the program in
+// a JSON POST request, and writes the response that it returns as
+// JSON. Requiring a JSON request means that a page of another site
+// can only send one after a CORS preflight, which the server rejects.
+func serveEndpoint(f func(ctx context.Context, src []byte) serveResponse) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mt != "application/json" {
+			http.Error(w, "request must be application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+		var req serveRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxProgSize)).Decode(&req); err != nil {
+			http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp := f(r.Context(), []byte(req.Body))
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// formatProg formats the program src.
+func formatProg(ctx context.Context, src []byte) serveResponse {
+	out, err := format.Source(src)
+	if err != nil {
+		if el, ok := err.(scanner.ErrorList); ok {
+			for _, e := range el {
+				e.Pos.Filename = progName
+			}
+		}
+		return serveResponse{Error: playError(err)}
+	}
+	return serveResponse{Body: string(out)}
+}
+
+// checkProg type checks the program src, and reports every error.
+func checkProg(ctx context.Context, src []byte) serveResponse {
+	importer := go2go.NewImporterFS(go2go.MapFS{progName: src})
+	errs, err := go2go.Check(importer, ".")
+	if err != nil {
+		return serveResponse{Error: err.Error()}
+	}
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return serveResponse{Error: strings.Join(msgs, "\n")}
+}
+
+// translateProg translates the program src into Go 1.
+func translateProg(ctx context.Context, src []byte) serveResponse {
+	importer := go2go.NewImporterFS(go2go.MapFS{progName: src})
+	out, err := go2go.RewriteBuffer(importer, progName, src)
+	if err != nil {
+		return serveResponse{Error: playError(err)}
+	}
+	return serveResponse{Body: string(out)}
+}
+
+// runCache is the build cache used for programs run by go2go serve.
+var runCache string
+
+// runProg translates the program src, builds it in a temporary
+// directory that is removed afterwards, and runs it there. The build
+// and the program get an environment of their own, with that directory
+// as their home, rather than the environment of go2go serve. The
+// program is killed if it runs for longer than runTimeout, and its
+// output is truncated to maxRunOutput bytes. It still runs with the
+// privileges of go2go serve.
+func runProg(ctx context.Context, src []byte) serveResponse {
+	resp := translateProg(ctx, src)
+	if resp.Error != "" {
+		return resp
+	}
+
+	tmpdir, err := ioutil.TempDir("", "go2go-serve")
+	if err != nil {
+		return serveResponse{Error: err.Error()}
+	}
+	defer os.RemoveAll(tmpdir)
+	prog := filepath.Join(tmpdir, "prog.go")
+	if err := ioutil.WriteFile(prog, []byte(resp.Body), 0644); err != nil {
+		return serveResponse{Error: err.Error()}
+	}
+
+	// Build the program first and run the binary directly, so that
+	// the timeout kills the program itself rather than "go run".
+	var out limitedBuffer
+	exe := "prog"
+	if runtime.GOOS == "windows" {
+		exe += ".exe"
+	}
+	cmd := exec.CommandContext(ctx, gotool, "build", "-o", exe, "prog.go")
+	cmd.Dir = tmpdir
+	cmd.Env = runEnv(tmpdir, "GOPATH="+tmpdir, "GOCACHE="+runCache, "GO111MODULE=off", "CGO_ENABLED=0")
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return serveResponse{Output: out.String(), Error: err.Error()}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, runTimeout)
+	defer cancel()
+	cmd = exec.CommandContext(ctx, filepath.Join(tmpdir, exe))
+	cmd.Dir = tmpdir
+	cmd.Env = runEnv(tmpdir)
+	err = runOutput(cmd, &out)
+	resp = serveResponse{Output: out.String()}
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		resp.Error = fmt.Sprintf("program timed out after %v", runTimeout)
+	case err != nil:
+		resp.Error = err.Error()
+	}
+	return resp
+}
+
+// runEnv returns the environment for building or running a program
+// in dir: dir as the home and temporary directory, and env.
+func runEnv(dir string, env ...string) []string {
+	r := []string{"HOME=" + dir, "TMPDIR=" + dir}
+	if runtime.GOOS == "windows" {
+		r = append(r, "USERPROFILE="+dir, "TMP="+dir, "TEMP="+dir, "SystemRoot="+os.Getenv("SystemRoot"))
+	}
+	return append(r, env...)
+}
+
+// runOutput runs cmd, writing its output to out. The output is read
+// through a pipe of our own, so that once the program exits or is
+// killed, runOutput does not wait for the output of processes started
+// by the program that outlive it.
+func runOutput(cmd *exec.Cmd, out io.Writer) error {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = w
+	cmd.Stderr = w
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		r.Close()
+		return err
+	}
+	done := make(chan bool)
+	go func() {
+		io.Copy(out, r)
+		close(done)
+	}()
+	err = cmd.Wait()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+	}
+	r.Close()
+	<-done
+	return err
+}
+
+// playError returns the message of err, without the trailing newline
+// of a list of type checking errors.
+func playError(err error) string {
+	return strings.TrimSpace(err.Error())
+}
+
+// A limitedBuffer is a buffer that drops what is written beyond
+// maxRunOutput bytes.
+type limitedBuffer struct {
+	bytes.Buffer
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := maxRunOutput - b.Len(); len(p) > room {
+		p = p[:room]
+		b.truncated = true
+	}
+	b.Buffer.Write(p)
+	return n, nil
+}
+
+func (b *limitedBuffer) String() string {
+	if b.truncated {
+		return b.Buffer.String() + "\n[output truncated]\n"
+	}
+	return b.Buffer.String()
+}
+
+// servePage serves the page of the playground.
+func servePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, playPage)
+}
+
+// playPage is the page of the playground. Its buttons post the
+// program to the endpoints, and show the responses.
+const playPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>go2go playground</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+textarea, pre { font-family: monospace; font-size: 14px; width: 100%; box-sizing: border-box; }
+textarea { height: 24em; tab-size: 8; }
+pre { background: #f4f4f4; padding: 0.5em; min-height: 4em; white-space: pre-wrap; }
+.error { color: #c00; }
+</style>
+</head>
+<body>
+<h1>go2go playground</h1>
+<p>
+<button onclick="post('/run')">Run</button>
+<button onclick="post('/fmt')">Format</button>
+<button onclick="post('/check')">Check</button>
+<button onclick="post('/translate')">Translate</button>
+</p>
+<textarea id="body" spellcheck="false">package main
+
+import "fmt"
+
+contract Ordered(T) {
+	T int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64, uintptr,
+		float32, float64,
+		string
+}
+
+func Max(type T Ordered)(a, b T) T {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func main() {
+	fmt.Println(Max(1, 2), Max("a", "b"))
+}
+</textarea>
+<pre id="output"></pre>
+<script>
+function post(path) {
+	var body = document.getElementById("body");
+	var output = document.getElementById("output");
+	output.className = "";
+	output.textContent = "Waiting...";
+	fetch(path, {
+		method: "POST",
+		headers: {"Content-Type": "application/json"},
+		body: JSON.stringify({Body: body.value})
+	})
+		.then(function(r) { return r.json(); })
+		.then(function(resp) {
+			if (resp.Error) {
+				output.className = "error";
+				output.textContent = (resp.Output || "") + resp.Error;
+			} else if (path == "/fmt") {
+				body.value = resp.Body;
+				output.textContent = "";
+			} else if (path == "/check") {
+				output.textContent = "No errors.";
+			} else {
+				output.textContent = resp.Body || resp.Output || "";
+			}
+		})
+		.catch(function(err) {
+			output.className = "error";
+			output.textContent = String(err);
+		});
+}
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,159 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestServe(t *testing.T) {
+	t.Parallel()
+	buildGo2go(t)
+
+	cmd := exec.Command(testGo2go, "serve", "-http", "127.0.0.1:0")
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		// Interrupt the server, so that it removes its build cache.
+		if runtime.GOOS == "windows" || cmd.Process.Signal(os.Interrupt) != nil {
+			cmd.Process.Kill()
+		}
+		cmd.Wait()
+	}()
+	line, err := bufio.NewReader(stderr).ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading go2go serve address: %v", err)
+	}
+	const prefix = "go2go serve: listening on "
+	if !strings.HasPrefix(line, prefix) {
+		t.Fatalf("go2go serve printed %q, want %q", line, prefix)
+	}
+	base := strings.TrimSpace(strings.TrimPrefix(line, prefix))
+
+	resp, err := http.Get(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || !strings.Contains(string(page), "go2go playground") {
+		t.Errorf("GET / returned %q, %v", page, err)
+	}
+
+	const prog = `package main
+
+func Sum(type T)(s []T, add func(T, T) T) T {
+	var r T
+	for _, v := range s { r = add(r, v) }
+	return r
+}
+
+func main() {
+	println(Sum([]int{1, 2, 3}, func(a, b int) int { return a + b }))
+}
+`
+	const bad = `package main
+
+func main() {
+	var s string = 1
+	println(s, undefined)
+}
+`
+	for _, test := range []struct {
+		path, prog string
+		field      string // Body, Output or Error
+		want       []string
+	}{
+		{"fmt", prog, "Body", []string{"\tfor _, v := range s {\n\t\tr = add(r, v)\n\t}\n"}},
+		{"fmt", "package main\nfunc (", "Error", []string{"prog.go2:2:7: expected"}},
+		{"check", prog, "Error", nil},
+		{"check", bad, "Error", []string{"prog.go2:4:17: cannot convert 1", "prog.go2:5:13: undeclared name: undefined"}},
+		{"translate", prog, "Body", []string{"// Code generated by go2go; DO NOT EDIT.", "func Instantiate"}},
+		{"translate", bad, "Error", []string{"type checking failed for main"}},
+		{"run", prog, "Output", []string{"6\n"}},
+		{"run", "package main\n\nfunc main() { panic(\"boom\") }\n", "Output", []string{"panic: boom"}},
+		{"run", "package main\n\nfunc main() { println(\"start\"); for {} }\n", "Error", []string{"program timed out after 10s"}},
+	} {
+		req, err := json.Marshal(map[string]string{"Body": test.prog})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.Post(base+test.path, "application/json", bytes.NewReader(req))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got map[string]string
+		err = json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("/%s: decoding response: %v", test.path, err)
+		}
+		if test.want == nil && len(got) != 0 {
+			t.Errorf("/%s: got %q, want an empty response", test.path, got)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(got[test.field], want) {
+				t.Errorf("/%s: %s is %q, want it to contain %q", test.path, test.field, got[test.field], want)
+			}
+		}
+	}
+
+	// Requests that a page of another site could make are rejected.
+	u, err := url.Parse(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(u.Host)
+	for _, test := range []struct {
+		desc, method, path, host, origin, ctype string
+		status                                  int
+	}{
+		{"GET /run", "GET", "run", "", "", "", http.StatusMethodNotAllowed},
+		{"form POST", "POST", "run", "", "", "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"text POST", "POST", "run", "", "", "text/plain", http.StatusUnsupportedMediaType},
+		{"rebound host", "POST", "run", "evil.example:" + port, "", "application/json", http.StatusForbidden},
+		{"rebound host page", "GET", "", "evil.example:" + port, "", "", http.StatusForbidden},
+		{"other origin", "POST", "run", "", "http://evil.example", "application/json", http.StatusForbidden},
+		{"localhost", "POST", "check", "localhost:" + port, "http://localhost:" + port, "application/json", http.StatusOK},
+	} {
+		req, err := http.NewRequest(test.method, base+test.path, strings.NewReader(`{"Body": "package main\n\nfunc main() {}\n"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.host != "" {
+			req.Host = test.host
+		}
+		if test.origin != "" {
+			req.Header.Set("Origin", test.origin)
+		}
+		if test.ctype != "" {
+			req.Header.Set("Content-Type", test.ctype)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: got status %s, want %d", test.desc, resp.Status, test.status)
+		}
+	}
+}
@@ -7,6 +7,7 @@ package main
 import (
 	"github.com/tdakkota/go2go/golib/go2go"
 	"io/ioutil"
+	"path/filepath"
 	"strings"
 )
 
@@ -17,6 +18,47 @@ func translate(importer *go2go.Importer, dir string) {
 	}
 }
 
+// translateAll writes .go files for all .go2 files in dirs, and for
+// the packages that they import, translating up to -p packages at once.
+func translateAll(importer *go2go.Importer, dirs []string) {
+	if err := go2go.RewriteAll(importer, dirs, *parallel); err != nil {
+		die(err.Error())
+	}
+}
+
+// translateFlags returns the directory set by a leading -o flag in
+// args, or the empty string if there is none, and the remaining
+// arguments.
+func translateFlags(args []string) (string, []string) {
+	if len(args) == 0 {
+		return "", args
+	}
+	switch {
+	case args[0] == "-o":
+		if len(args) < 2 {
+			usage()
+		}
+		return args[1], args[2:]
+	case strings.HasPrefix(args[0], "-o="):
+		return strings.TrimPrefix(args[0], "-o="), args[1:]
+	}
+	return "", args
+}
+
+// translateTo writes the translations of the .go2 packages in dirs,
+// and of the packages that they import, into a tree under outdir.
+func translateTo(importer *go2go.Importer, dirs []string, outdir string) {
+	var pkgDirs []string
+	for _, dir := range dirs {
+		if dir != "" {
+			pkgDirs = append(pkgDirs, dir)
+		}
+	}
+	if err := go2go.RewriteTo(importer, pkgDirs, outdir); err != nil {
+		die(err.Error())
+	}
+}
+
 // translateFile translates one .go2 file into a .go file.
 func translateFile(importer *go2go.Importer, file string) {
 	data, err := ioutil.ReadFile(file)
@@ -31,3 +73,29 @@ func translateFile(importer *go2go.Importer, file string) {
 		die(err.Error())
 	}
 }
+
+// migrate converts the .go2 files in dirs into .go files using
+// Go 1.18 type parameters. Every package is converted before any
+// file is written, as a converted package can no longer be imported
+// by the packages that use it. Files from an earlier translation are
+// removed; hand-written .go files are kept.
+func migrate(importer *go2go.Importer, dirs []string) {
+	migrated := make([]map[string][]byte, len(dirs))
+	for i, dir := range dirs {
+		files, err := go2go.Migrate(importer, dir)
+		if err != nil {
+			die(err.Error())
+		}
+		migrated[i] = files
+	}
+	for i, dir := range dirs {
+		if err := go2go.RemoveTranslation(dir); err != nil {
+			die(err.Error())
+		}
+		for name, data := range migrated[i] {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+				die(err.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main_test
+
+import (
+	"github.com/tdakkota/go2go/testutil/testenv"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParallel(t *testing.T) {
+	t.Parallel()
+	buildGo2go(t)
+
+	gopath, err := ioutil.TempDir("", "go2go-parallel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	testFiles{
+		{
+			"max/max.go2",
+			`package max
+
+contract Ordered(T) {
+	T int, float64, string
+}
+
+func Max(type T Ordered)(a, b T) T {
+	if a > b {
+		return a
+	}
+	return b
+}
+`,
+		},
+		{
+			"sum/sum.go2",
+			`package sum
+
+contract Number(T) {
+	T int, float64
+}
+
+func Sum(type T Number)(s ...T) (r T) {
+	for _, v := range s {
+		r += v
+	}
+	return r
+}
+`,
+		},
+		{
+			"pair/pair.go2",
+			`package pair
+
+import "max"
+
+type Pair(type T) struct{ a, b T }
+
+func (p Pair(T)) First() T { return p.a }
+
+func Larger(a, b int) int { return max.Max(a, b) }
+
+func First(a, b string) string { return Pair(string){a, b}.First() }
+`,
+		},
+		{
+			"triple/triple.go2",
+			`package triple
+
+import (
+	"max"
+	"sum"
+)
+
+func Largest(a, b, c int) int { return max.Max(max.Max(a, b), c) }
+
+func Total(a, b, c float64) float64 { return sum.Sum(a, b, c) }
+`,
+		},
+		{
+			"app/main.go2",
+			`package main
+
+import (
+	"pair"
+	"sum"
+	"triple"
+)
+
+func main() {
+	println(pair.Larger(1, 2), pair.First("x", "y"), triple.Largest(3, 5, 4), int(triple.Total(1, 2, 3)), sum.Sum(4, 5))
+}
+`,
+		},
+		{
+			"cycle1/cycle1.go2",
+			`package cycle1
+
+import "cycle2"
+
+func F(type T)(x T) T { return cycle2.G(x) }
+`,
+		},
+		{
+			"cycle2/cycle2.go2",
+			`package cycle2
+
+import "cycle1"
+
+func G(type T)(x T) T { return cycle1.F(x) }
+`,
+		},
+		{
+			"usecycle/main.go2",
+			`package main
+
+import "cycle1"
+
+func main() { println(cycle1.F(1)) }
+`,
+		},
+	}.create(t, gopath)
+
+	for _, p := range []string{"1", "4"} {
+		cmd := exec.Command(testGo2go, "-p", p, "build")
+		cmd.Dir = filepath.Join(gopath, "src", "app")
+		cmd.Env = append(os.Environ(), "GO2PATH="+gopath, "GO2CACHE=off")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("error running go2go -p %s build: %v\n%s", p, err, out)
+		}
+		cmdName := "./app"
+		if runtime.GOOS == "windows" {
+			cmdName += ".exe"
+		}
+		cmd = exec.Command(cmdName)
+		cmd.Dir = filepath.Join(gopath, "src", "app")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("error running app: %v\n%s", err, out)
+		}
+		if got, want := string(out), "2 x 5 6 9\n"; got != want {
+			t.Errorf("-p %s: app printed %q, want %q", p, got, want)
+		}
+	}
+
+	cmd := exec.Command(testGo2go, "-p", "4", "build")
+	cmd.Dir = filepath.Join(gopath, "src", "usecycle")
+	cmd.Env = append(os.Environ(), "GO2PATH="+gopath, "GO2CACHE=off")
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("go2go build of an import cycle succeeded unexpectedly")
+	}
+	if want := "import cycle not allowed: cycle1 -> cycle2 -> cycle1"; !strings.Contains(string(out), want) {
+		t.Errorf("go2go build of an import cycle printed %q, want %q", out, want)
+	}
+}
+
+func TestTranslateOutDir(t *testing.T) {
+	t.Parallel()
+	buildGo2go(t)
+
+	tmpdir, err := ioutil.TempDir("", "go2go-translate-out-dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	gopath := filepath.Join(tmpdir, "gopath")
+	testFiles{
+		{
+			"util/util.go",
+			`package util
+
+func Double(x int) int { return 2 * x }
+`,
+		},
+		{
+			"gen/gen.go2",
+			`package gen
+
+type Box(type T) struct{ V T }
+
+func Get(type T)(b Box(T)) T { return b.V }
+`,
+		},
+		{
+			"lib/lib.go2",
+			`package lib
+
+import (
+	"gen"
+	"util"
+)
+
+func Wrap(type T)(v T) gen.Box(T) { return gen.Box(T){v} }
+
+func Twice(x int) int { return util.Double(x) }
+`,
+		},
+		{
+			"lib/lib_test.go2",
+			`package lib
+
+func init() { _ = Wrap(1) }
+`,
+		},
+		{
+			"app/main.go2",
+			`package main
+
+import (
+	"gen"
+	"lib"
+)
+
+func main() {
+	println(gen.Get(lib.Wrap(lib.Twice(21))))
+}
+`,
+		},
+	}.create(t, gopath)
+
+	outdir := filepath.Join(tmpdir, "out")
+	cmd := exec.Command(testGo2go, "translate", "-o", outdir, "app")
+	cmd.Env = append(os.Environ(), "GO2PATH="+gopath, "GO111MODULE=off")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go2go translate -o failed: %v\n%s", err, out)
+	}
+
+	var got []string
+	filepath.Walk(outdir, func(path string, fi os.FileInfo, err error) error {
+		if err == nil && !fi.IsDir() {
+			rel, _ := filepath.Rel(outdir, path)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	want := []string{
+		"src/app/instantiations.go",
+		"src/app/main.go",
+		"src/gen/gen.go",
+		"src/lib/instantiations_test.go",
+		"src/lib/lib.go",
+		"src/lib/lib_test.go",
+		"src/util/util.go",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("go2go translate -o wrote %v, want %v", got, want)
+	}
+
+	// The source tree is left untouched.
+	filepath.Walk(gopath, func(path string, fi os.FileInfo, err error) error {
+		if err == nil && strings.HasSuffix(path, ".go") && filepath.Base(path) != "util.go" {
+			t.Errorf("go2go translate -o wrote %s", path)
+		}
+		return nil
+	})
+
+	// The tree is a self-contained GOPATH.
+	cmd = exec.Command(testenv.GoToolPath(t), "run", "app")
+	cmd.Env = append(os.Environ(), "GOPATH="+outdir, "GO111MODULE=off")
+	cmd.Dir = outdir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run app in the translated tree failed: %v\n%s", err, out)
+	}
+	if got, want := string(out), "42\n"; got != want {
+		t.Errorf("app printed %q, want %q", got, want)
+	}
+
+	elsewhere := filepath.Join(tmpdir, "elsewhere")
+	if err := os.Mkdir(elsewhere, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(elsewhere, "p.go2"), []byte("package p\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd = exec.Command(testGo2go, "translate", "-o", outdir, ".")
+	cmd.Dir = elsewhere
+	cmd.Env = append(os.Environ(), "GO2PATH="+gopath, "GO111MODULE=off")
+	if out, err := cmd.CombinedOutput(); err == nil || !strings.Contains(string(out), "cannot determine import path") {
+		t.Errorf("go2go translate -o of a directory outside GO2PATH: got %v\n%s", err, out)
+	}
+}
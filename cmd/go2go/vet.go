@@ -0,0 +1,48 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/tdakkota/go2go/golib/go2go"
+	"os"
+	"strings"
+)
+
+// vetAnalyzers returns the analyzers selected by the flags in args,
+// such as -printf, and the remaining arguments. With no flags,
+// every analyzer is selected.
+func vetAnalyzers(args []string) ([]*go2go.Analyzer, []string) {
+	var analyzers []*go2go.Analyzer
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		a := go2go.LookupAnalyzer(strings.TrimLeft(args[0], "-"))
+		if a == nil {
+			die(fmt.Sprintf("go2go vet: unknown analyzer %s", args[0]))
+		}
+		analyzers = append(analyzers, a)
+		args = args[1:]
+	}
+	if analyzers == nil {
+		analyzers = go2go.Analyzers
+	}
+	return analyzers, args
+}
+
+// vet runs the analyzers over the .go2 packages in dirs, and reports
+// the problems found. It reports whether there were none.
+func vet(importer *go2go.Importer, analyzers []*go2go.Analyzer, dirs []string) bool {
+	ok := true
+	for _, dir := range dirs {
+		diags, err := go2go.Vet(importer, dir, analyzers)
+		if err != nil {
+			die(err.Error())
+		}
+		for _, d := range diags {
+			fmt.Fprintln(os.Stderr, d)
+			ok = false
+		}
+	}
+	return ok
+}
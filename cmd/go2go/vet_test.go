@@ -0,0 +1,100 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVet(t *testing.T) {
+	t.Parallel()
+	buildGo2go(t)
+
+	gopath, err := ioutil.TempDir("", "go2go-vet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	testFiles{
+		{
+			"vet/vet.go2",
+			`package vet
+
+type Box(type T) struct{ v T }
+
+func (b Box(T)) String() string { return "box" }
+
+func logf(format string, args ...interface{}) {}
+
+func Get(type T)(b Box(T)) T {
+	logf("%d %d", b.v)
+	return b.v
+	panic("after return")
+}
+
+func Count(type T)(s []T) int {
+	n := 0
+	for range s {
+		n := 1
+		n++
+	}
+	Box(int){}.String()
+	return n
+}
+
+func Fail() {
+	panic("fail")
+	println("after panic")
+}
+
+contract Stringer(T) {
+	T String() string
+}
+
+func Show(type T Stringer)(x T) {
+	x.String()
+}
+`,
+		},
+	}.create(t, gopath)
+
+	dir := filepath.Join(gopath, "src", "vet")
+	cmd := exec.Command(testGo2go, "vet")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GO2PATH="+gopath)
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("go2go vet succeeded unexpectedly\n%s", out)
+	}
+	if strings.Contains(string(out), "Stringer") {
+		t.Errorf("go2go vet output mentions the contract bound:\n%s", out)
+	}
+	for _, want := range []string{
+		`vet.go2:10:2: vet.logf format "%d %d" reads arg #2, but call has 1 arg` + "\n",
+		"vet.go2:12:2: unreachable code\n",
+		"vet.go2:18:3: declaration of \"n\" shadows declaration at line 16\n",
+		"vet.go2:21:2: result of (vet.Box).String call not used\n",
+		"vet.go2:27:2: unreachable code\n",
+		"vet.go2:35:2: result of x.String call not used\n",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("go2go vet output does not contain %q:\n%s", want, out)
+		}
+	}
+
+	cmd = exec.Command(testGo2go, "vet", "-unreachable")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GO2PATH="+gopath)
+	out, _ = cmd.CombinedOutput()
+	if strings.Contains(string(out), "logf format") || !strings.Contains(string(out), "unreachable code") {
+		t.Errorf("go2go vet -unreachable reported:\n%s", out)
+	}
+}
@@ -853,6 +853,11 @@ Found:
 			// the name was vetted above with goodOSArchFile.
 			p.SysoFiles = append(p.SysoFiles, name)
 			continue
+		case ".go2":
+			// .go2 files are translated by go2go;
+			// MatchFile selects them, but they are
+			// not part of a Go 1 package.
+			continue
 		}
 
 		pf, err := parser.ParseFile(fset, filename, data, parser.ImportsOnly|parser.ParseComments)
@@ -1293,6 +1298,9 @@ func parseWord(data []byte) (word, rest []byte) {
 //
 // MatchFile considers the name of the file and may use ctxt.OpenFile to
 // read some or all of the file's content.
+//
+// A .go2 file matches as a .go file would, though ImportDir leaves
+// .go2 files out of the Package.
 func (ctxt *Context) MatchFile(dir, name string) (match bool, err error) {
 	match, _, _, err = ctxt.matchFile(dir, name, nil, nil)
 	return
@@ -1323,7 +1331,7 @@ func (ctxt *Context) matchFile(dir, name string, allTags map[string]bool, binary
 	}
 
 	switch ext {
-	case ".go", ".c", ".cc", ".cxx", ".cpp", ".m", ".s", ".h", ".hh", ".hpp", ".hxx", ".f", ".F", ".f90", ".S", ".sx", ".swig", ".swigcxx":
+	case ".go", ".go2", ".c", ".cc", ".cxx", ".cpp", ".m", ".s", ".h", ".hh", ".hpp", ".hxx", ".f", ".F", ".f90", ".S", ".sx", ".swig", ".swigcxx":
 		// tentatively okay - read to make sure
 	case ".syso":
 		// binary, no reading
@@ -1340,9 +1348,9 @@ func (ctxt *Context) matchFile(dir, name string, allTags map[string]bool, binary
 		return
 	}
 
-	if strings.HasSuffix(filename, ".go") {
+	if strings.HasSuffix(filename, ".go") || strings.HasSuffix(filename, ".go2") {
 		data, err = readImports(f, false, nil)
-		if strings.HasSuffix(filename, "_test.go") {
+		if strings.HasSuffix(filename, "_test.go") || strings.HasSuffix(filename, "_test.go2") {
 			binaryOnly = nil // ignore //go:binary-only-package comments in _test.go files
 		}
 	} else {
@@ -219,6 +219,10 @@ var matchFileTests = []struct {
 	{ctxtAndroid, "plan9_test.go", "", true},
 	{ctxtAndroid, "arm.s", "", true},
 	{ctxtAndroid, "amd64.s", "", true},
+	{ctxtP9, "foo_arm.go2", "", true},
+	{ctxtP9, "foo_darwin.go2", "", false},
+	{ctxtP9, "foo1.go2", "// +build linux\n\npackage main\n", false},
+	{ctxtAndroid, "foo_linux_test.go2", "// +build android\n\npackage main\n", true},
 }
 
 func TestMatchFile(t *testing.T) {
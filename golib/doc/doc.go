@@ -26,10 +26,11 @@ type Package struct {
 	Bugs []string
 
 	// declarations
-	Consts []*Value
-	Types  []*Type
-	Vars   []*Value
-	Funcs  []*Func
+	Consts    []*Value
+	Types     []*Type
+	Vars      []*Value
+	Funcs     []*Func
+	Contracts []*Contract
 
 	// Examples is a sorted list of examples associated with
 	// the package. Examples are extracted from _test.go files
@@ -48,9 +49,10 @@ type Value struct {
 
 // Type is the documentation for a type declaration.
 type Type struct {
-	Doc  string
-	Name string
-	Decl *ast.GenDecl
+	Doc     string
+	Name    string
+	TParams []string // type parameter names, for a generic type
+	Decl    *ast.GenDecl
 
 	// associated declarations
 	Consts  []*Value // sorted list of constants of (mostly) this type
@@ -66,14 +68,15 @@ type Type struct {
 
 // Func is the documentation for a func declaration.
 type Func struct {
-	Doc  string
-	Name string
-	Decl *ast.FuncDecl
+	Doc     string
+	Name    string
+	TParams []string // type parameter names, for a generic function
+	Decl    *ast.FuncDecl
 
 	// methods
 	// (for functions, these fields have the respective zero value)
-	Recv  string // actual   receiver "T" or "*T"
-	Orig  string // original receiver "T" or "*T"
+	Recv  string // actual   receiver "T", "*T", "T(P)" or "*T(P)"
+	Orig  string // original receiver "T", "*T", "T(P)" or "*T(P)"
 	Level int    // embedding level; 0 means not embedded
 
 	// Examples is a sorted list of examples associated with this
@@ -82,6 +85,14 @@ type Func struct {
 	Examples []*Example
 }
 
+// Contract is the documentation for a contract declaration.
+type Contract struct {
+	Doc     string
+	Name    string
+	TParams []string // type parameter names
+	Decl    *ast.GenDecl
+}
+
 // A Note represents a marked comment starting with "MARKER(uid): note body".
 // Any note with a marker of 2 or more upper case [A-Z] letters and a uid of
 // at least one character is recognized. The ":" following the uid is optional.
@@ -132,6 +143,7 @@ func New(pkg *ast.Package, importPath string, mode Mode) *Package {
 		Types:      sortedTypes(r.types, mode&AllMethods != 0),
 		Vars:       sortedValues(r.values, token.VAR),
 		Funcs:      sortedFuncs(r.funcs, true),
+		Contracts:  sortedContracts(r.contracts),
 	}
 }
 
@@ -139,6 +151,8 @@ func New(pkg *ast.Package, importPath string, mode Mode) *Package {
 //
 // The package is specified by a list of *ast.Files and corresponding
 // file set, which must not be nil.
+// Files may be .go or .go2 files, the latter holding contracts and
+// generic declarations.
 // NewFromFiles uses all provided files when computing documentation,
 // so it is the caller's responsibility to provide only the files that
 // match the desired build context. "go/build".Context.MatchFile can
@@ -176,7 +190,7 @@ func NewFromFiles(fset *token.FileSet, files []*ast.File, importPath string, opt
 		panic(fmt.Errorf("doc.NewFromFiles: there must not be more than 1 option argument"))
 	}
 
-	// Collect .go and _test.go files.
+	// Collect .go and _test.go files, and their .go2 counterparts.
 	var (
 		goFiles     = make(map[string]*ast.File)
 		testGoFiles []*ast.File
@@ -187,12 +201,12 @@ func NewFromFiles(fset *token.FileSet, files []*ast.File, importPath string, opt
 			return nil, fmt.Errorf("file files[%d] is not found in the provided file set", i)
 		}
 		switch name := f.Name(); {
-		case strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go"):
-			goFiles[name] = files[i]
-		case strings.HasSuffix(name, "_test.go"):
+		case strings.HasSuffix(name, "_test.go"), strings.HasSuffix(name, "_test.go2"):
 			testGoFiles = append(testGoFiles, files[i])
+		case strings.HasSuffix(name, ".go"), strings.HasSuffix(name, ".go2"):
+			goFiles[name] = files[i]
 		default:
-			return nil, fmt.Errorf("file files[%d] filename %q does not have a .go extension", i, name)
+			return nil, fmt.Errorf("file files[%d] filename %q does not have a .go or .go2 extension", i, name)
 		}
 	}
 
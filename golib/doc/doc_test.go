@@ -70,7 +70,37 @@ func isGoFile(fi os.FileInfo) bool {
 	name := fi.Name()
 	return !fi.IsDir() &&
 		len(name) > 0 && name[0] != '.' && // ignore .files
-		filepath.Ext(name) == ".go"
+		(filepath.Ext(name) == ".go" || filepath.Ext(name) == ".go2")
+}
+
+// parseDir is like parser.ParseDir, but it also parses .go2 files.
+func parseDir(fset *token.FileSet, path string, filter func(os.FileInfo) bool, mode parser.Mode) (map[string]*ast.Package, error) {
+	list, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	pkgs := make(map[string]*ast.Package)
+	for _, d := range list {
+		if !filter(d) {
+			continue
+		}
+		filename := filepath.Join(path, d.Name())
+		src, err := parser.ParseFile(fset, filename, nil, mode)
+		if err != nil {
+			return nil, err
+		}
+		name := src.Name.Name
+		pkg, found := pkgs[name]
+		if !found {
+			pkg = &ast.Package{
+				Name:  name,
+				Files: make(map[string]*ast.File),
+			}
+			pkgs[name] = pkg
+		}
+		pkg.Files[filename] = src
+	}
+	return pkgs, nil
 }
 
 type bundle struct {
@@ -93,7 +123,7 @@ func test(t *testing.T, mode Mode) {
 
 	// get packages
 	fset := token.NewFileSet()
-	pkgs, err := parser.ParseDir(fset, dataDir, filter, parser.ParseComments)
+	pkgs, err := parseDir(fset, dataDir, filter, parser.ParseComments)
 	if err != nil {
 		t.Fatal(err)
 	}
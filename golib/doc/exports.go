@@ -172,6 +172,11 @@ func (r *reader) filterType(parent *namedType, typ ast.Expr) {
 		// nothing to do
 	case *ast.ParenExpr:
 		r.filterType(nil, t.X)
+	case *ast.CallExpr:
+		// instantiated generic type
+		for _, arg := range t.Args {
+			r.filterType(nil, arg)
+		}
 	case *ast.ArrayType:
 		r.filterType(nil, t.Elt)
 	case *ast.StructType:
@@ -226,6 +231,8 @@ func (r *reader) filterSpec(spec ast.Spec) bool {
 			// special case: remember that error is declared locally
 			r.errorDecl = true
 		}
+	case *ast.ContractSpec:
+		return token.IsExported(s.Name.Name)
 	}
 	return false
 }
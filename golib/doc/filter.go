@@ -30,6 +30,10 @@ func matchDecl(d *ast.GenDecl, f Filter) bool {
 					return true
 				}
 			}
+		case *ast.ContractSpec:
+			if f(v.Name.Name) {
+				return true
+			}
 		case *ast.TypeSpec:
 			if f(v.Name.Name) {
 				return true
@@ -60,6 +64,17 @@ func filterValues(a []*Value, f Filter) []*Value {
 	return a[0:w]
 }
 
+func filterContracts(a []*Contract, f Filter) []*Contract {
+	w := 0
+	for _, cd := range a {
+		if f(cd.Name) {
+			a[w] = cd
+			w++
+		}
+	}
+	return a[0:w]
+}
+
 func filterFuncs(a []*Func, f Filter) []*Func {
 	w := 0
 	for _, fd := range a {
@@ -101,5 +116,6 @@ func (p *Package) Filter(f Filter) {
 	p.Vars = filterValues(p.Vars, f)
 	p.Types = filterTypes(p.Types, f)
 	p.Funcs = filterFuncs(p.Funcs, f)
+	p.Contracts = filterContracts(p.Contracts, f)
 	p.Doc = "" // don't show top-level package doc
 }
@@ -23,7 +23,8 @@ import (
 type methodSet map[string]*Func
 
 // recvString returns a string representation of recv of the
-// form "T", "*T", or "BADRECV" (if not a proper receiver type).
+// form "T", "*T", "T(P)", "*T(P)", or "BADRECV" (if not a proper
+// receiver type).
 //
 func recvString(recv ast.Expr) string {
 	switch t := recv.(type) {
@@ -31,10 +32,38 @@ func recvString(recv ast.Expr) string {
 		return t.Name
 	case *ast.StarExpr:
 		return "*" + recvString(t.X)
+	case *ast.ParenExpr:
+		return recvString(t.X)
+	case *ast.CallExpr:
+		// receiver of a generic type, with its type parameters
+		s := recvString(t.Fun) + "("
+		for i, arg := range t.Args {
+			if i > 0 {
+				s += ", "
+			}
+			s += recvString(arg)
+		}
+		return s + ")"
 	}
 	return "BADRECV"
 }
 
+// fieldNames returns the names declared by list, such as the names
+// of a list of type parameters, or nil if list is nil.
+//
+func fieldNames(list *ast.FieldList) []string {
+	if list == nil {
+		return nil
+	}
+	var names []string
+	for _, f := range list.List {
+		for _, name := range f.Names {
+			names = append(names, name.Name)
+		}
+	}
+	return names
+}
+
 // set creates the corresponding Func for f and adds it to mset.
 // If there are multiple f's with the same name, set keeps the first
 // one with documentation; conflicts are ignored. The boolean
@@ -61,11 +90,12 @@ func (mset methodSet) set(f *ast.FuncDecl, preserveAST bool) {
 		recv = recvString(typ)
 	}
 	mset[name] = &Func{
-		Doc:  f.Doc.Text(),
-		Name: name,
-		Decl: f,
-		Recv: recv,
-		Orig: recv,
+		Doc:     f.Doc.Text(),
+		Name:    name,
+		TParams: fieldNames(f.Type.TParams),
+		Decl:    f,
+		Recv:    recv,
+		Orig:    recv,
 	}
 	if !preserveAST {
 		f.Doc = nil // doc consumed - remove from AST
@@ -111,6 +141,9 @@ func baseTypeName(x ast.Expr) (name string, imported bool) {
 		return baseTypeName(t.X)
 	case *ast.StarExpr:
 		return baseTypeName(t.X)
+	case *ast.CallExpr:
+		// instantiated generic type
+		return baseTypeName(t.Fun)
 	}
 	return
 }
@@ -123,9 +156,10 @@ type embeddedSet map[*namedType]bool
 // reader.lookupType.
 //
 type namedType struct {
-	doc  string       // doc comment for type
-	name string       // type name
-	decl *ast.GenDecl // nil if declaration hasn't been seen yet
+	doc     string       // doc comment for type
+	name    string       // type name
+	tparams []string     // type parameter names, for a generic type
+	decl    *ast.GenDecl // nil if declaration hasn't been seen yet
 
 	isEmbedded bool        // true if this type is embedded
 	isStruct   bool        // true if this type is a struct
@@ -162,6 +196,7 @@ type reader struct {
 	order     int      // sort order of const and var declarations (when we can't use a name)
 	types     map[string]*namedType
 	funcs     methodSet
+	contracts []*Contract
 
 	// support for package-local error type declarations
 	errorDecl bool                 // if set, type "error" was declared locally
@@ -353,6 +388,7 @@ func (r *reader) readType(decl *ast.GenDecl, spec *ast.TypeSpec) {
 		decl.Doc = nil // doc consumed - remove from AST
 	}
 	typ.doc = doc.Text()
+	typ.tparams = fieldNames(spec.TParams)
 
 	// record anonymous fields (they may contribute methods)
 	// (some fields may have been recorded already when filtering
@@ -366,6 +402,36 @@ func (r *reader) readType(decl *ast.GenDecl, spec *ast.TypeSpec) {
 	}
 }
 
+// readContract processes a contract declaration.
+//
+func (r *reader) readContract(decl *ast.GenDecl, spec *ast.ContractSpec) {
+	if spec.Name.Name == "_" || !r.isVisible(spec.Name.Name) {
+		return
+	}
+
+	// compute documentation
+	doc := spec.Doc
+	if doc == nil {
+		// no doc associated with the spec, use the declaration doc, if any
+		doc = decl.Doc
+	}
+	if r.mode&PreserveAST == 0 {
+		spec.Doc = nil // doc consumed - remove from AST
+		decl.Doc = nil // doc consumed - remove from AST
+	}
+
+	var tparams []string
+	for _, par := range spec.TParams {
+		tparams = append(tparams, par.Name)
+	}
+	r.contracts = append(r.contracts, &Contract{
+		Doc:     doc.Text(),
+		Name:    spec.Name.Name,
+		TParams: tparams,
+		Decl:    decl,
+	})
+}
+
 // isPredeclared reports whether n denotes a predeclared type.
 //
 func (r *reader) isPredeclared(n string) bool {
@@ -406,10 +472,13 @@ func (r *reader) readFunc(fun *ast.FuncDecl) {
 	}
 
 	// Associate factory functions with the first visible result type, as long as
-	// others are predeclared types.
+	// others are predeclared types. A generic function may return an
+	// instantiation of a generic type, as in func New(type T)() *List(T),
+	// but a result of a type parameter type is not a factory result.
 	if fun.Type.Results.NumFields() >= 1 {
 		var typ *namedType // type to associate the function with
 		numResultTypes := 0
+		tparams := fieldNames(fun.Type.TParams)
 		for _, res := range fun.Type.Results.List {
 			factoryType := res.Type
 			if t, ok := factoryType.(*ast.ArrayType); ok {
@@ -417,7 +486,7 @@ func (r *reader) readFunc(fun *ast.FuncDecl) {
 				// T (or pointers to T) as factory functions of T.
 				factoryType = t.Elt
 			}
-			if n, imp := baseTypeName(factoryType); !imp && r.isVisible(n) && !r.isPredeclared(n) {
+			if n, imp := baseTypeName(factoryType); !imp && r.isVisible(n) && !r.isPredeclared(n) && !contains(tparams, n) {
 				if t := r.lookupType(n); t != nil {
 					typ = t
 					numResultTypes++
@@ -439,6 +508,17 @@ func (r *reader) readFunc(fun *ast.FuncDecl) {
 	r.funcs.set(fun, r.mode&PreserveAST != 0)
 }
 
+// contains reports whether list contains s.
+//
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
 var (
 	noteMarker    = `([A-Z][A-Z]+)\(([^)]+)\):?`                // MARKER(uid), MARKER at least 2 chars, uid at least 1 char
 	noteMarkerRx  = lazyregexp.New(`^[ \t]*` + noteMarker)      // MARKER(uid) at text start
@@ -555,6 +635,25 @@ func (r *reader) readFile(src *ast.File) {
 						r.readType(fake, s)
 					}
 				}
+			case token.IDENT:
+				// contracts are handled individually, like types
+				if len(d.Specs) == 1 && !d.Lparen.IsValid() {
+					if s, ok := d.Specs[0].(*ast.ContractSpec); ok {
+						r.readContract(d, s)
+					}
+					break
+				}
+				for _, spec := range d.Specs {
+					if s, ok := spec.(*ast.ContractSpec); ok {
+						fake := &ast.GenDecl{
+							Doc:    d.Doc,
+							TokPos: s.Pos(),
+							Tok:    token.IDENT,
+							Specs:  []ast.Spec{s},
+						}
+						r.readContract(fake, s)
+					}
+				}
 			}
 		}
 	}
@@ -800,6 +899,7 @@ func sortedTypes(m map[string]*namedType, allMethods bool) []*Type {
 		list[i] = &Type{
 			Doc:     t.doc,
 			Name:    t.name,
+			TParams: t.tparams,
 			Decl:    t.decl,
 			Consts:  sortedValues(t.values, token.CONST),
 			Vars:    sortedValues(t.values, token.VAR),
@@ -818,6 +918,15 @@ func sortedTypes(m map[string]*namedType, allMethods bool) []*Type {
 	return list
 }
 
+func sortedContracts(list []*Contract) []*Contract {
+	sortBy(
+		func(i, j int) bool { return list[i].Name < list[j].Name },
+		func(i, j int) { list[i], list[j] = list[j], list[i] },
+		len(list),
+	)
+	return list
+}
+
 func removeStar(s string) string {
 	if len(s) > 0 && s[0] == '*' {
 		return s[1:]
@@ -0,0 +1,314 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package go2go
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/tdakkota/go2go/golib/ast"
+	"github.com/tdakkota/go2go/golib/types"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// The translation cache.
+//
+// The .go files written for an imported package are saved in a cache
+// directory, in a subdirectory named by a hash of the tool, the import
+// path and directory of the package, the build context, its source
+// files, and the hashes of the .go2 packages that it imports. As the
+// hash of an imported package covers its own imports, a change to any
+// transitively imported .go2 package changes the hash.
+//
+// A cached package is still parsed and type checked, as the packages
+// that import it need its types and generic declarations, but it is not
+// translated again. Along with the .go files the cache holds a manifest
+// of the instantiations that the package exports, so that the packages
+// importing it keep using them rather than instantiating their own.
+
+// cacheManifestFile is the name of the manifest in a cache entry.
+const cacheManifestFile = "manifest.json"
+
+// A cacheManifest lists the instantiations exported by a cached package.
+type cacheManifest struct {
+	Funcs []cacheInst
+	Types []cacheInst
+}
+
+// A cacheInst describes an instantiation of the generic function or
+// type Name declared in the package Pkg, with the type arguments Types,
+// as the declaration Decl.
+type cacheInst struct {
+	Pkg   string
+	Name  string
+	Types []string
+	Decl  string
+}
+
+// DefaultCacheDir returns the translation cache directory named by the
+// GO2CACHE environment variable, or the go2go directory in the user's
+// cache directory if GO2CACHE is not set. It returns the empty string
+// if GO2CACHE is "off".
+func DefaultCacheDir() (string, error) {
+	dir := os.Getenv("GO2CACHE")
+	switch dir {
+	case "off":
+		return "", nil
+	case "":
+		ucd, err := os.UserCacheDir()
+		if err != nil {
+			return "", fmt.Errorf("cannot determine translation cache directory: %v; set GO2CACHE", err)
+		}
+		return filepath.Join(ucd, "go2go"), nil
+	}
+	if !filepath.IsAbs(dir) {
+		return "", fmt.Errorf("GO2CACHE is not an absolute path: %s", dir)
+	}
+	return dir, nil
+}
+
+// SetCacheDir sets the directory that caches translated imported
+// packages. The empty string, the default, disables caching.
+func (imp *Importer) SetCacheDir(dir string) {
+	imp.cacheDir = dir
+}
+
+// CleanCache removes the translation cache in dir.
+func CleanCache(dir string) error {
+	return os.RemoveAll(dir)
+}
+
+var (
+	toolIDOnce sync.Once
+	toolIDHash string
+	toolIDErr  error
+)
+
+// toolID returns a hash of the running executable, so that a new
+// version of the translator does not use the translations of an old one.
+func toolID() (string, error) {
+	toolIDOnce.Do(func() {
+		exe, err := os.Executable()
+		if err != nil {
+			toolIDErr = err
+			return
+		}
+		f, err := os.Open(exe)
+		if err != nil {
+			toolIDErr = err
+			return
+		}
+		defer f.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			toolIDErr = err
+			return
+		}
+		toolIDHash = hex.EncodeToString(h.Sum(nil))
+	})
+	return toolIDHash, toolIDErr
+}
+
+// cacheKey returns the hash identifying the translation of the package
+// importPath, with the source files files in dir. The imports of the
+// package must have been type checked, so that the hashes of imported
+// .go2 packages are known.
+func (imp *Importer) cacheKey(importPath, dir string, files []string, asts []*ast.File) (string, error) {
+	id, err := toolID()
+	if err != nil {
+		return "", err
+	}
+	adir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "go2go %s\nnaming %d\npackage %s\ndir %s\n", id, imp.naming, importPath, adir)
+	fmt.Fprintf(h, "build %s %s %v %q\n", imp.ctxt.GOOS, imp.ctxt.GOARCH, imp.ctxt.CgoEnabled, imp.ctxt.BuildTags)
+	files = append([]string(nil), files...)
+	sort.Strings(files)
+	for _, f := range files {
+		data, err := imp.fs.ReadFile(filepath.Join(dir, f))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "file %s %d\n", f, len(data))
+		h.Write(data)
+	}
+	imports := imp.collectImports(asts)
+	imp.mu.Lock()
+	for _, path := range imports {
+		fmt.Fprintf(h, "import %s %s\n", path, imp.cacheKeys[path])
+	}
+	imp.mu.Unlock()
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// restoreCached copies the cached translation with the given key into
+// outdir, and records the instantiations that it exports. It reports
+// whether the translation was found in the cache.
+func (imp *Importer) restoreCached(key, outdir string, tpkg *types.Package) bool {
+	edir := filepath.Join(imp.cacheDir, key[:2], key)
+	data, err := ioutil.ReadFile(filepath.Join(edir, cacheManifestFile))
+	if err != nil {
+		return false
+	}
+	var m cacheManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return false
+	}
+
+	// Resolve the manifest before changing anything,
+	// so that a stale entry is simply a cache miss.
+	var funcs []types.Object
+	for _, e := range m.Funcs {
+		obj := imp.cachedObject(e, tpkg)
+		if obj == nil {
+			return false
+		}
+		funcs = append(funcs, obj)
+	}
+	var typs []types.Type
+	for _, e := range m.Types {
+		obj := imp.cachedObject(e, tpkg)
+		if obj == nil {
+			return false
+		}
+		typs = append(typs, obj.Type())
+	}
+
+	files, err := ioutil.ReadDir(edir)
+	if err != nil {
+		return false
+	}
+	for _, fi := range files {
+		if filepath.Ext(fi.Name()) != ".go" && fi.Name() != namesFile {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(edir, fi.Name()))
+		if err != nil {
+			return false
+		}
+		if err := imp.writeOutput(filepath.Join(outdir, fi.Name()), data); err != nil {
+			return false
+		}
+	}
+
+	for i, e := range m.Funcs {
+		imp.addInstantiation(funcs[i], &instantiation{
+			keys: e.Types,
+			decl: ast.NewIdent(e.Decl),
+			pkg:  tpkg,
+		})
+	}
+	for i, e := range m.Types {
+		imp.addTypeInstantiation(typs[i], &typeInstantiation{
+			keys: e.Types,
+			decl: ast.NewIdent(e.Decl),
+			pkg:  tpkg,
+		})
+	}
+	return true
+}
+
+// cachedObject returns the generic function or type named by a
+// manifest entry, or nil if it is not found.
+func (imp *Importer) cachedObject(e cacheInst, tpkg *types.Package) types.Object {
+	pkg := tpkg
+	if e.Pkg != tpkg.Path() {
+		var ok bool
+		if pkg, ok = imp.lookupPackage(e.Pkg); !ok {
+			return nil
+		}
+	}
+	return pkg.Scope().Lookup(e.Name)
+}
+
+// storeCache saves the translation of tpkg in outdir in the cache
+// under key. Failing to write the cache is not an error.
+func (imp *Importer) storeCache(key, outdir string, tpkg *types.Package) {
+	var m cacheManifest
+	imp.mu.Lock()
+	for obj, insts := range imp.instantiations {
+		for _, inst := range insts {
+			if inst.pkg == tpkg {
+				m.Funcs = append(m.Funcs, newCacheInst(obj, inst.types, inst.keys, inst.decl))
+			}
+		}
+	}
+	for typ, insts := range imp.typeInstantiations {
+		named, ok := typ.(*types.Named)
+		if !ok {
+			continue
+		}
+		for _, inst := range insts {
+			if inst.pkg == tpkg {
+				m.Types = append(m.Types, newCacheInst(named.Obj(), inst.types, inst.keys, inst.decl))
+			}
+		}
+	}
+	imp.mu.Unlock()
+	data, err := json.Marshal(&m)
+	if err != nil {
+		return
+	}
+
+	// Write the entry into a temporary directory first, so that
+	// a concurrent go2go never sees a partial entry.
+	parent := filepath.Join(imp.cacheDir, key[:2])
+	if err := os.MkdirAll(parent, 0777); err != nil {
+		return
+	}
+	tmp, err := ioutil.TempDir(parent, "tmp-")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(tmp)
+	files, err := imp.outputFiles(outdir)
+	if err != nil {
+		return
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(tmp, name), data, 0644); err != nil {
+			return
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmp, cacheManifestFile), data, 0644); err != nil {
+		return
+	}
+	os.Rename(tmp, filepath.Join(parent, key))
+}
+
+// newCacheInst returns the manifest entry for an instantiation of obj.
+func newCacheInst(obj types.Object, typeList []types.Type, keys []string, decl *ast.Ident) cacheInst {
+	if typeList != nil {
+		keys = typeKeys(typeList)
+	}
+	return cacheInst{
+		Pkg:   obj.Pkg().Path(),
+		Name:  obj.Name(),
+		Types: keys,
+		Decl:  decl.Name,
+	}
+}
+
+// typeKeys returns strings identifying the types in typeList,
+// with the types of other packages qualified by import path.
+func typeKeys(typeList []types.Type) []string {
+	keys := make([]string, len(typeList))
+	for i, typ := range typeList {
+		keys[i] = types.TypeString(typ, func(pkg *types.Package) string {
+			return pkg.Path()
+		})
+	}
+	return keys
+}
@@ -0,0 +1,97 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package go2go
+
+import (
+	"github.com/tdakkota/go2go/golib/ast"
+	"github.com/tdakkota/go2go/golib/parser"
+	"github.com/tdakkota/go2go/golib/scanner"
+	"github.com/tdakkota/go2go/golib/token"
+	"github.com/tdakkota/go2go/golib/types"
+	"path/filepath"
+	"sort"
+)
+
+// Check parses and type checks the .go2 files in dir, with the
+// hand-written .go files, including test files, and returns every
+// error found, sorted by position. The errors
+// are scanner.Error values if a file cannot be parsed, and types.Error
+// values otherwise. The .go2 packages that the files import, directly
+// or indirectly, are type checked when they are imported; an error in
+// one of them is reported at the import declaration. The error result
+// is set if the package cannot be read. With an Importer returned by
+// NewImporterFS, nothing is written to the disk.
+func Check(importer *Importer, dir string) ([]error, error) {
+	go2files, gofiles, err := importer.PackageFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse every file before reporting errors,
+	// so that all syntax errors are reported at once.
+	fset := token.NewFileSet()
+	var errs []error
+	var pkgNames []string
+	pkgs := make(map[string][]*ast.File)
+	for _, f := range append(go2files, gofiles...) {
+		filename := filepath.Join(dir, f)
+		src, err := importer.fs.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		pf, err := parser.ParseFile(fset, filename, src, parser.AllErrors)
+		if err != nil {
+			if el, ok := err.(scanner.ErrorList); ok {
+				for _, e := range el {
+					errs = append(errs, *e)
+				}
+				continue
+			}
+			return nil, err
+		}
+		name := pf.Name.Name
+		if pkgs[name] == nil {
+			pkgNames = append(pkgNames, name)
+		}
+		pkgs[name] = append(pkgs[name], pf)
+	}
+	if len(errs) > 0 {
+		return errs, nil
+	}
+
+	sort.Strings(pkgNames)
+	for _, name := range pkgNames {
+		conf := types.Config{
+			Importer: importer.forStack(nil, dir),
+			Error: func(err error) {
+				errs = append(errs, err)
+			},
+		}
+		conf.Check(name, fset, pkgs[name], nil)
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool {
+		p, q := errorPosition(errs[i]), errorPosition(errs[j])
+		if p.Filename != q.Filename {
+			return p.Filename < q.Filename
+		}
+		if p.Line != q.Line {
+			return p.Line < q.Line
+		}
+		return p.Column < q.Column
+	})
+	return errs, nil
+}
+
+// errorPosition returns the position of an error returned by Check.
+func errorPosition(err error) token.Position {
+	switch err := err.(type) {
+	case scanner.Error:
+		return err.Pos
+	case types.Error:
+		return err.Fset.Position(err.Pos)
+	}
+	return token.Position{}
+}
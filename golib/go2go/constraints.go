@@ -0,0 +1,140 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package go2go
+
+import (
+	"bytes"
+	"github.com/tdakkota/go2go/golib/build"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+)
+
+// Build constraints.
+//
+// The source files of a package are selected as the go command selects
+// .go files: a file is left out if its name ends in a GOOS or GOARCH
+// suffix, such as _linux.go2 or _amd64.go2, that does not match the
+// build context, or if its // +build lines are not satisfied. This is
+// decided by golib/build, with the build context set by SetBuildContext.
+//
+// The // +build lines of a .go2 file are copied to the .go file that it
+// is translated to, so that building the translated files with another
+// GOOS or GOARCH, or other tags, leaves out the same files. The
+// suffixes are kept by the file names.
+
+// SetBuildContext sets the build context selecting the source files of
+// packages. The file system functions of ctxt are replaced by ones
+// reading the file system of the Importer. The default is build.Default.
+func (imp *Importer) SetBuildContext(ctxt build.Context) {
+	ctxt.JoinPath = filepath.Join
+	ctxt.OpenFile = func(name string) (io.ReadCloser, error) {
+		data, err := imp.fs.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+	imp.ctxt = ctxt
+}
+
+// PackageFiles returns the .go2 files and the hand-written .go files in
+// dir that match the build context, sorted by name.
+func (imp *Importer) PackageFiles(dir string) (go2files, gofiles []string, err error) {
+	go2files, _, err = go2Files(imp.fs, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if go2files, err = imp.matchFiles(dir, go2files); err != nil {
+		return nil, nil, err
+	}
+	gofiles, err = HandWrittenFiles(imp.fs, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if gofiles, err = imp.matchFiles(dir, gofiles); err != nil {
+		return nil, nil, err
+	}
+	return go2files, gofiles, nil
+}
+
+// matchFiles returns the files among names in dir that match the
+// build context, sorted by name.
+func (imp *Importer) matchFiles(dir string, names []string) ([]string, error) {
+	var files []string
+	for _, name := range names {
+		match, err := imp.ctxt.MatchFile(dir, name)
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			files = append(files, name)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// scanConstraints records the // +build lines of the source of
+// filename, to be copied to its translation.
+func (imp *Importer) scanConstraints(filename string, src []byte) {
+	lines := buildConstraints(src)
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
+	if lines == nil {
+		delete(imp.constraints, filename)
+	} else {
+		imp.constraints[filename] = lines
+	}
+}
+
+// fileConstraints returns the // +build lines of filename,
+// as recorded by scanConstraints.
+func (imp *Importer) fileConstraints(filename string) []byte {
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
+	return imp.constraints[filename]
+}
+
+// buildConstraints returns the // +build lines of src, each followed
+// by a newline. As for the go command, they must be in the leading run
+// of // comments and blank lines, which must be followed by a blank
+// line.
+func buildConstraints(src []byte) []byte {
+	// Find the end of the run, at the last blank line.
+	end := 0
+	p := src
+	for len(p) > 0 {
+		line := p
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line, p = line[:i], p[i+1:]
+		} else {
+			p = p[len(p):]
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			end = len(src) - len(p)
+			continue
+		}
+		if !bytes.HasPrefix(line, []byte("//")) {
+			break
+		}
+	}
+
+	var out []byte
+	for _, line := range bytes.Split(src[:end], []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if !bytes.HasPrefix(line, []byte("//")) {
+			continue
+		}
+		f := bytes.Fields(line[len("//"):])
+		if len(f) > 0 && bytes.Equal(f[0], []byte("+build")) {
+			out = append(out, line...)
+			out = append(out, '\n')
+		}
+	}
+	return out
+}
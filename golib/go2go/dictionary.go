@@ -0,0 +1,1154 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package go2go
+
+import (
+	"fmt"
+	"github.com/tdakkota/go2go/golib/ast"
+	"github.com/tdakkota/go2go/golib/scanner"
+	"github.com/tdakkota/go2go/golib/token"
+	"github.com/tdakkota/go2go/golib/types"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Dictionary-passing translation.
+//
+// A generic function marked with dictionaryDirective is translated
+// once, into a shared function in which values of type parameter
+// type are held in empty interfaces. Operations on those values are
+// performed by calling closures held in a dictionary, a struct that
+// is passed as the first argument of the shared function. Each
+// instantiation is then a small wrapper function that passes the
+// dictionary for its type arguments to the shared function.
+//
+// For
+//
+//	//go2go:dictionary
+//	func Max(type T Ordered)(a, b T) T { if a < b { return b }; return a }
+//
+// the package declaring Max gets
+//
+//	type Dictionary୦Max struct {
+//		Zero୦T interface{}
+//		Op୦T୦lss func(interface{}, interface{}) bool
+//	}
+//	func Shared୦Max(dict୦ *Dictionary୦Max, a, b interface{}) interface{} {
+//		if dict୦.Op୦T୦lss(a, b) { return b }; return a
+//	}
+//
+// and the instantiation Max(int) is a dictionary variable
+// and a wrapper function calling Shared୦Max. With ReadableNames,
+// the parts of these names are separated by double underscores
+// instead, as in Shared__Max and Op__T__lss.
+
+// dictionaryDirective is the comment that selects dictionary-passing
+// translation. Before a generic function declaration, it applies to
+// that function. Before the package clause of any file of a package,
+// it applies to all the generic functions of the package.
+const dictionaryDirective = "//go2go:dictionary"
+
+// fileDirectives records the dictionary directives found in a file.
+type fileDirectives struct {
+	pkg   bool         // directive before the package clause
+	funcs map[int]bool // offsets of func keywords following a directive
+}
+
+// scanDirectives looks for dictionary directives in the source
+// of filename.
+func (imp *Importer) scanDirectives(filename string, src []byte) {
+	fset := token.NewFileSet()
+	file := fset.AddFile(filename, -1, len(src))
+	var s scanner.Scanner
+	s.Init(file, src, nil, scanner.ScanComments)
+
+	fd := &fileDirectives{funcs: make(map[int]bool)}
+	found := false
+	pending := false
+	for {
+		pos, tok, lit := s.Scan()
+		switch tok {
+		case token.EOF:
+			if found {
+				imp.mu.Lock()
+				imp.directives[filename] = fd
+				imp.mu.Unlock()
+			}
+			return
+		case token.COMMENT:
+			if strings.TrimSpace(lit) == dictionaryDirective {
+				pending = true
+				found = true
+			}
+			continue
+		case token.SEMICOLON:
+			if lit == "\n" {
+				continue
+			}
+		case token.PACKAGE:
+			fd.pkg = fd.pkg || pending
+		case token.FUNC:
+			if pending {
+				fd.funcs[file.Offset(pos)] = true
+			}
+		}
+		pending = false
+	}
+}
+
+// addDictionaryDecls records the generic functions in files that
+// are to be translated using dictionaries.
+func (imp *Importer) addDictionaryDecls(fset *token.FileSet, files []*ast.File) {
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
+	pkg := false
+	for _, f := range files {
+		if fd := imp.directives[fset.Position(f.Package).Filename]; fd != nil && fd.pkg {
+			pkg = true
+		}
+	}
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			fdecl, ok := decl.(*ast.FuncDecl)
+			if !ok || !isParameterizedFuncDecl(fdecl, imp.info) {
+				continue
+			}
+			pos := fset.Position(fdecl.Pos())
+			if fd := imp.directives[pos.Filename]; fd != nil && fd.funcs[pos.Offset] {
+				imp.dictDecls[fdecl] = true
+			} else if pkg {
+				imp.dictDecls[fdecl] = false
+			}
+		}
+	}
+}
+
+// A dictFunc describes a generic function translated using
+// a dictionary.
+type dictFunc struct {
+	decl    *ast.FuncDecl
+	tparams []*types.TypeParam
+	names   map[*types.TypeParam]string
+	objs    map[*types.TypeParam]types.Object
+
+	// The operators and methods used for each type parameter.
+	ops     map[*types.TypeParam]map[string]bool
+	methods map[*types.TypeParam]map[string]*types.Signature
+
+	// naming is used for the names that the translation introduces.
+	naming Naming
+
+	// If the function cannot be translated using a dictionary,
+	// err describes why, at errPos.
+	err    string
+	errPos token.Pos
+}
+
+// The names of the dictionary fields for operators.
+var dictBinaryOps = map[token.Token]string{
+	token.ADD:     "add",
+	token.SUB:     "sub",
+	token.MUL:     "mul",
+	token.QUO:     "quo",
+	token.REM:     "rem",
+	token.AND:     "and",
+	token.OR:      "or",
+	token.XOR:     "xor",
+	token.AND_NOT: "andnot",
+	token.LSS:     "lss",
+	token.LEQ:     "leq",
+	token.GTR:     "gtr",
+	token.GEQ:     "geq",
+}
+
+var dictUnaryOps = map[token.Token]string{
+	token.SUB: "neg",
+	token.XOR: "not",
+}
+
+// dictionaryFunc returns the description of the dictionary
+// translation of decl. It returns nil if decl is not to be
+// translated using a dictionary. If decl cannot be translated
+// using a dictionary, the err field of the result is set.
+func (imp *Importer) dictionaryFunc(decl *ast.FuncDecl) *dictFunc {
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
+	if _, ok := imp.dictDecls[decl]; !ok {
+		return nil
+	}
+	if df, ok := imp.dictFuncs[decl]; ok {
+		return df
+	}
+	df := imp.checkDictionaryFunc(decl)
+	imp.dictFuncs[decl] = df
+	return df
+}
+
+// ownDictionaryDirective reports whether decl is translated using
+// a dictionary because of its own directive.
+func (imp *Importer) ownDictionaryDirective(decl *ast.FuncDecl) bool {
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
+	return imp.dictDecls[decl]
+}
+
+// useDictionary returns the dictionary translation of decl,
+// or nil if decl is to be instantiated.
+func (imp *Importer) useDictionary(decl *ast.FuncDecl) *dictFunc {
+	if df := imp.dictionaryFunc(decl); df != nil && df.err == "" {
+		return df
+	}
+	return nil
+}
+
+// checkDictionaryFunc checks whether decl can be translated using
+// a dictionary, and collects the operations that the dictionary
+// must provide. Type parameter values may be used as operands of
+// arithmetic and comparison operators, as receivers of methods
+// whose parameters and results are type parameters or predeclared
+// types, and be assigned, passed and returned as values of their
+// own type or of an empty interface type. Types built from type
+// parameters, and constants of type parameter type, are not supported.
+func (imp *Importer) checkDictionaryFunc(decl *ast.FuncDecl) *dictFunc {
+	df := &dictFunc{
+		decl:    decl,
+		names:   make(map[*types.TypeParam]string),
+		objs:    make(map[*types.TypeParam]types.Object),
+		ops:     make(map[*types.TypeParam]map[string]bool),
+		methods: make(map[*types.TypeParam]map[string]*types.Signature),
+		naming:  imp.naming,
+	}
+	fail := func(pos token.Pos, format string, args ...interface{}) {
+		if df.err == "" {
+			df.err = fmt.Sprintf(format, args...)
+			df.errPos = pos
+		}
+	}
+
+	if decl.Recv != nil || decl.Type.TParams == nil {
+		fail(decl.Pos(), "methods of generic types are not supported")
+		return df
+	}
+	if decl.Body == nil {
+		fail(decl.Pos(), "function has no body")
+		return df
+	}
+	for _, f := range decl.Type.TParams.List {
+		for _, n := range f.Names {
+			obj, _ := imp.info.def(n)
+			if obj == nil {
+				fail(n.Pos(), "no object for type parameter %s", n.Name)
+				return df
+			}
+			tp, ok := obj.Type().(*types.TypeParam)
+			if !ok {
+				fail(n.Pos(), "%s is not a type parameter", n.Name)
+				return df
+			}
+			df.tparams = append(df.tparams, tp)
+			df.names[tp] = n.Name
+			df.objs[tp] = obj
+			df.ops[tp] = make(map[string]bool)
+			df.methods[tp] = make(map[string]*types.Signature)
+		}
+	}
+
+	// The parameters and results must be type parameters,
+	// or not refer to type parameters at all.
+	allowed := make(map[ast.Expr]bool)
+	for _, fl := range []*ast.FieldList{decl.Type.Params, decl.Type.Results} {
+		if fl == nil {
+			continue
+		}
+		for _, f := range fl.List {
+			typ := imp.info.TypeOf(f.Type)
+			if df.param(typ) != nil {
+				allowed[f.Type] = true
+			} else if df.contains(typ) {
+				fail(f.Type.Pos(), "parameter type %s refers to a type parameter", typ)
+			}
+		}
+	}
+	obj, _ := imp.info.def(decl.Name)
+	sig, _ := obj.Type().(*types.Signature)
+	if sig == nil {
+		fail(decl.Pos(), "no signature for %s", decl.Name.Name)
+		return df
+	}
+
+	// assign marks src as allowed if a value of type parameter
+	// type may be assigned to a value of type dst.
+	assign := func(dst types.Type, src ast.Expr) {
+		srcType := imp.info.TypeOf(src)
+		if df.param(srcType) == nil {
+			return
+		}
+		if dst == nil || types.Identical(dst, srcType) || isEmptyInterface(dst) {
+			allowed[src] = true
+		}
+	}
+
+	// Mark the uses of type parameter values that
+	// the shared function can handle.
+	ast.Inspect(decl.Body, func(n ast.Node) bool {
+		if e, ok := n.(ast.Expr); ok && !allowed[e] {
+			if tv, ok := imp.info.typeAndValue(e); ok {
+				switch {
+				case tv.Value != nil && df.contains(tv.Type):
+					fail(e.Pos(), "constant of type %s is not supported", tv.Type)
+				case df.param(tv.Type) != nil && !tv.IsType():
+					fail(e.Pos(), "this use of a value of type %s is not supported", tv.Type)
+				case df.contains(tv.Type):
+					fail(e.Pos(), "type %s is not supported", tv.Type)
+				}
+			}
+		}
+
+		switch n := n.(type) {
+		case *ast.ParenExpr:
+			if allowed[n] {
+				allowed[n.X] = true
+			}
+		case *ast.BinaryExpr:
+			tp := df.param(imp.info.TypeOf(n.X))
+			if tp == nil {
+				break
+			}
+			if n.Op == token.EQL || n.Op == token.NEQ {
+				allowed[n.X] = true
+				allowed[n.Y] = true
+			} else if name, ok := dictBinaryOps[n.Op]; ok {
+				allowed[n.X] = true
+				allowed[n.Y] = true
+				df.ops[tp][name] = true
+			}
+		case *ast.UnaryExpr:
+			tp := df.param(imp.info.TypeOf(n.X))
+			if tp == nil {
+				break
+			}
+			if name, ok := dictUnaryOps[n.Op]; ok {
+				allowed[n.X] = true
+				df.ops[tp][name] = true
+			}
+		case *ast.CallExpr:
+			ftv, _ := imp.info.typeAndValue(n.Fun)
+			if sel, ok := n.Fun.(*ast.SelectorExpr); ok {
+				if tp := df.param(imp.info.TypeOf(sel.X)); tp != nil {
+					msig, ok := ftv.Type.(*types.Signature)
+					if !ok || msig.Variadic() || n.Ellipsis.IsValid() {
+						break
+					}
+					if !df.methodTypesOK(msig) {
+						fail(sel.Sel.Pos(), "method %s has parameter or result types that are not supported", sel.Sel.Name)
+						break
+					}
+					if m, _ := imp.info.use(sel.Sel); isPointerMethod(m) {
+						// The value is held in an interface, so a
+						// method cannot modify it.
+						fail(sel.Sel.Pos(), "pointer method %s is not supported", sel.Sel.Name)
+						break
+					}
+					df.methods[tp][sel.Sel.Name] = msig
+					allowed[sel] = true
+					allowed[sel.X] = true
+					allowed[sel.Sel] = true
+					for i, arg := range n.Args {
+						assign(msig.Params().At(i).Type(), arg)
+					}
+					break
+				}
+			}
+			if ftv.IsBuiltin() || ftv.IsType() {
+				break
+			}
+			fsig, ok := ftv.Type.(*types.Signature)
+			if !ok || df.contains(fsig) {
+				break
+			}
+			for i, arg := range n.Args {
+				var ptype types.Type
+				switch {
+				case fsig.Variadic() && i >= fsig.Params().Len()-1 && !n.Ellipsis.IsValid():
+					ptype = fsig.Params().At(fsig.Params().Len() - 1).Type().(*types.Slice).Elem()
+				case i < fsig.Params().Len():
+					ptype = fsig.Params().At(i).Type()
+				default:
+					continue
+				}
+				if df.param(imp.info.TypeOf(arg)) != nil && isEmptyInterface(ptype) {
+					allowed[arg] = true
+				}
+			}
+		case *ast.AssignStmt:
+			if len(n.Lhs) != len(n.Rhs) {
+				// A call returning several results. A call
+				// of a function whose results refer to a type
+				// parameter is only valid for a method of a
+				// type parameter value, which is checked above.
+				allowed[n.Rhs[0]] = true
+				for _, lhs := range n.Lhs {
+					if df.param(imp.lhsType(lhs)) != nil {
+						allowed[lhs] = true
+					}
+				}
+				break
+			}
+			for i, lhs := range n.Lhs {
+				ltype := imp.lhsType(lhs)
+				switch n.Tok {
+				case token.ASSIGN, token.DEFINE:
+					if n.Tok == token.DEFINE {
+						ltype = nil
+					}
+					assign(ltype, n.Rhs[i])
+					if allowed[n.Rhs[i]] {
+						allowed[lhs] = true
+					}
+				default:
+					tp := df.param(ltype)
+					name, ok := dictBinaryOps[n.Tok-token.ADD_ASSIGN+token.ADD]
+					if tp != nil && ok && n.Tok >= token.ADD_ASSIGN && n.Tok <= token.AND_NOT_ASSIGN {
+						allowed[lhs] = true
+						allowed[n.Rhs[i]] = true
+						df.ops[tp][name] = true
+					}
+				}
+			}
+		case *ast.ValueSpec:
+			var vtype types.Type
+			if n.Type != nil {
+				vtype = imp.info.TypeOf(n.Type)
+				if df.param(vtype) != nil {
+					allowed[n.Type] = true
+				}
+			}
+			for _, v := range n.Values {
+				assign(vtype, v)
+			}
+		case *ast.ReturnStmt:
+			if len(n.Results) != sig.Results().Len() {
+				break
+			}
+			for i, r := range n.Results {
+				assign(sig.Results().At(i).Type(), r)
+			}
+		case *ast.IncDecStmt:
+			if df.param(imp.info.TypeOf(n.X)) != nil {
+				fail(n.Pos(), "%s of a type parameter value is not supported", n.Tok)
+			}
+		}
+		return df.err == ""
+	})
+	return df
+}
+
+// lhsType returns the type of the left hand side of an assignment.
+func (imp *Importer) lhsType(e ast.Expr) types.Type {
+	if typ := imp.info.TypeOf(e); typ != nil {
+		return typ
+	}
+	if id, ok := e.(*ast.Ident); ok {
+		if obj := imp.info.ObjectOf(id); obj != nil {
+			return obj.Type()
+		}
+	}
+	return nil
+}
+
+// param returns typ if it is one of the type parameters of df,
+// and nil otherwise.
+func (df *dictFunc) param(typ types.Type) *types.TypeParam {
+	if tp, ok := typ.(*types.TypeParam); ok {
+		if _, ok := df.names[tp]; ok {
+			return tp
+		}
+	}
+	return nil
+}
+
+// contains reports whether typ refers to a type parameter of df.
+func (df *dictFunc) contains(typ types.Type) bool {
+	switch typ := typ.(type) {
+	case nil, *types.Basic:
+		return false
+	case *types.TypeParam:
+		return df.param(typ) != nil
+	case *types.Pointer:
+		return df.contains(typ.Elem())
+	case *types.Slice:
+		return df.contains(typ.Elem())
+	case *types.Array:
+		return df.contains(typ.Elem())
+	case *types.Chan:
+		return df.contains(typ.Elem())
+	case *types.Map:
+		return df.contains(typ.Key()) || df.contains(typ.Elem())
+	case *types.Struct:
+		for i := 0; i < typ.NumFields(); i++ {
+			if df.contains(typ.Field(i).Type()) {
+				return true
+			}
+		}
+		return false
+	case *types.Tuple:
+		for i := 0; i < typ.Len(); i++ {
+			if df.contains(typ.At(i).Type()) {
+				return true
+			}
+		}
+		return false
+	case *types.Signature:
+		return df.contains(typ.Params()) || df.contains(typ.Results())
+	case *types.Interface:
+		for i := 0; i < typ.NumExplicitMethods(); i++ {
+			if df.contains(typ.ExplicitMethod(i).Type()) {
+				return true
+			}
+		}
+		for i := 0; i < typ.NumEmbeddeds(); i++ {
+			if df.contains(typ.EmbeddedType(i)) {
+				return true
+			}
+		}
+		return false
+	case *types.Named:
+		for _, targ := range typ.TArgs() {
+			if df.contains(targ) {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// methodTypesOK reports whether a dictionary entry can be written
+// for a method with signature sig.
+func (df *dictFunc) methodTypesOK(sig *types.Signature) bool {
+	for _, tuple := range []*types.Tuple{sig.Params(), sig.Results()} {
+		for i := 0; i < tuple.Len(); i++ {
+			if dictTypeName(tuple.At(i).Type()) == "" && df.param(tuple.At(i).Type()) == nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// dictTypeName returns the name of a predeclared type,
+// or the empty string if typ is not predeclared.
+func dictTypeName(typ types.Type) string {
+	if b, ok := typ.(*types.Basic); ok && b.Info()&types.IsUntyped == 0 && b.Kind() != types.UnsafePointer {
+		return b.Name()
+	}
+	if typ == types.Universe.Lookup("error").Type() {
+		return "error"
+	}
+	return ""
+}
+
+// isPointerMethod reports whether obj is a method that is in the method
+// set of pointers only, such as m in the contract C(T) { *T m() }.
+func isPointerMethod(obj types.Object) bool {
+	f, ok := obj.(*types.Func)
+	if !ok {
+		return false
+	}
+	recv := f.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return false
+	}
+	_, ok = recv.Type().(*types.Pointer)
+	return ok
+}
+
+// isEmptyInterface reports whether typ is an interface with no methods.
+func isEmptyInterface(typ types.Type) bool {
+	if typ == nil {
+		return false
+	}
+	if _, ok := typ.(*types.TypeParam); ok {
+		return false
+	}
+	it, ok := typ.Underlying().(*types.Interface)
+	return ok && it.Empty()
+}
+
+// typeName returns the name of the dictionary type of df.
+func (df *dictFunc) typeName() string {
+	return df.naming.generatedName("Dictionary", df.decl.Name.Name)
+}
+
+// sharedName returns the name of the shared function of df.
+func (df *dictFunc) sharedName() string {
+	return df.naming.generatedName("Shared", df.decl.Name.Name)
+}
+
+// paramName returns the name of the dictionary parameter
+// of the shared function of df.
+func (df *dictFunc) paramName() string {
+	return df.naming.generatedName("dict", "")
+}
+
+// zeroName returns the name of the dictionary field holding
+// the zero value of tp.
+func (df *dictFunc) zeroName(tp *types.TypeParam) string {
+	return df.naming.generatedName("Zero", df.names[tp])
+}
+
+// opName returns the name of the dictionary field for the
+// operator op applied to values of type tp.
+func (df *dictFunc) opName(tp *types.TypeParam, op string) string {
+	return df.naming.generatedName("Op", df.names[tp], op)
+}
+
+// methodName returns the name of the dictionary field for
+// the method m of tp.
+func (df *dictFunc) methodName(tp *types.TypeParam, m string) string {
+	return df.naming.generatedName("M", df.names[tp], m)
+}
+
+// localName returns the name of a parameter or variable of
+// a function generated for df.
+func (df *dictFunc) localName(prefix string, i int) string {
+	if i < 0 {
+		return df.naming.generatedName(prefix, "")
+	}
+	return df.naming.generatedName(prefix, strconv.Itoa(i))
+}
+
+// A dictField is a field of a dictionary.
+type dictField struct {
+	name   string
+	tparam *types.TypeParam
+	op     string           // operator name, or "" for zero and methods
+	method string           // method name
+	sig    *types.Signature // method signature
+}
+
+// fields returns the fields of the dictionary of df, in order.
+func (df *dictFunc) fields() []dictField {
+	var r []dictField
+	for _, tp := range df.tparams {
+		r = append(r, dictField{
+			name:   df.zeroName(tp),
+			tparam: tp,
+		})
+		ops := make([]string, 0, len(df.ops[tp]))
+		for op := range df.ops[tp] {
+			ops = append(ops, op)
+		}
+		sort.Strings(ops)
+		for _, op := range ops {
+			r = append(r, dictField{
+				name:   df.opName(tp, op),
+				tparam: tp,
+				op:     op,
+			})
+		}
+		methods := make([]string, 0, len(df.methods[tp]))
+		for m := range df.methods[tp] {
+			methods = append(methods, m)
+		}
+		sort.Strings(methods)
+		for _, m := range methods {
+			r = append(r, dictField{
+				name:   df.methodName(tp, m),
+				tparam: tp,
+				method: m,
+				sig:    df.methods[tp][m],
+			})
+		}
+	}
+	return r
+}
+
+// isCompare reports whether op names a comparison operator.
+func isCompare(op string) bool {
+	switch op {
+	case "lss", "leq", "gtr", "geq":
+		return true
+	}
+	return false
+}
+
+// isUnary reports whether op names a unary operator.
+func isUnary(op string) bool {
+	return op == "neg" || op == "not"
+}
+
+// emptyInterface returns the AST for interface{}.
+func emptyInterface() ast.Expr {
+	return &ast.InterfaceType{Methods: &ast.FieldList{}}
+}
+
+// dictFieldList returns a field list of unnamed fields.
+func dictFieldList(typs ...ast.Expr) *ast.FieldList {
+	fl := &ast.FieldList{}
+	for _, typ := range typs {
+		fl.List = append(fl.List, &ast.Field{Type: typ})
+	}
+	return fl
+}
+
+// methodTypeExpr returns the AST for a type in a method entry
+// of a dictionary. Type parameters are represented as interface{}.
+func (df *dictFunc) methodTypeExpr(typ types.Type) ast.Expr {
+	if df.param(typ) != nil {
+		return emptyInterface()
+	}
+	return ast.NewIdent(dictTypeName(typ))
+}
+
+// fieldType returns the type of the dictionary field f.
+func (df *dictFunc) fieldType(f dictField) ast.Expr {
+	switch {
+	case f.sig != nil:
+		params := []ast.Expr{emptyInterface()}
+		for i := 0; i < f.sig.Params().Len(); i++ {
+			params = append(params, df.methodTypeExpr(f.sig.Params().At(i).Type()))
+		}
+		var results []ast.Expr
+		for i := 0; i < f.sig.Results().Len(); i++ {
+			results = append(results, df.methodTypeExpr(f.sig.Results().At(i).Type()))
+		}
+		return &ast.FuncType{Params: dictFieldList(params...), Results: dictFieldList(results...)}
+	case f.op == "":
+		return emptyInterface()
+	case isUnary(f.op):
+		return &ast.FuncType{Params: dictFieldList(emptyInterface()), Results: dictFieldList(emptyInterface())}
+	case isCompare(f.op):
+		return &ast.FuncType{Params: dictFieldList(emptyInterface(), emptyInterface()), Results: dictFieldList(ast.NewIdent("bool"))}
+	default:
+		return &ast.FuncType{Params: dictFieldList(emptyInterface(), emptyInterface()), Results: dictFieldList(emptyInterface())}
+	}
+}
+
+// sharedDecls returns the declarations of the dictionary type and
+// the shared function for the generic function decl, or nil if decl
+// is to be instantiated. If decl was marked for dictionary translation
+// by its own directive but cannot be translated that way, sharedDecls
+// reports an error.
+func (t *translator) sharedDecls(decl *ast.FuncDecl) []ast.Decl {
+	df := t.importer.dictionaryFunc(decl)
+	if df == nil {
+		return nil
+	}
+	if df.err != "" {
+		if t.importer.ownDictionaryDirective(decl) {
+			t.errorf(df.errPos, Unsupported, "cannot translate %s using a dictionary: %s", decl.Name.Name, df.err)
+		}
+		return nil
+	}
+	if df.naming == ReadableNames {
+		for _, n := range []struct{ name, desc string }{
+			{df.typeName(), "dictionary type"},
+			{df.sharedName(), "shared function"},
+		} {
+			origin := fmt.Sprintf("%s of %s.%s", n.desc, t.tpkg.Path(), decl.Name.Name)
+			if err := t.recordName(decl.Name.Pos(), n.name, origin, origin); err != nil {
+				t.addError(decl.Name.Pos(), Unsupported, err)
+				return nil
+			}
+		}
+	}
+
+	var fields []*ast.Field
+	for _, f := range df.fields() {
+		fields = append(fields, &ast.Field{
+			Names: []*ast.Ident{ast.NewIdent(f.name)},
+			Type:  df.fieldType(f),
+		})
+	}
+	typeDecl := &ast.GenDecl{
+		TokPos: decl.Pos(),
+		Tok:    token.TYPE,
+		Specs: []ast.Spec{
+			&ast.TypeSpec{
+				Name: &ast.Ident{NamePos: decl.Name.NamePos, Name: df.typeName()},
+				Type: &ast.StructType{Fields: &ast.FieldList{List: fields}},
+			},
+		},
+	}
+
+	empty := types.NewInterfaceType(nil, nil)
+	empty.Complete()
+	ta := newTypeArgs(make([]types.Type, len(df.tparams)))
+	for i, tp := range df.tparams {
+		ta.types[i] = empty
+		ta.add(df.objs[tp], tp, emptyInterface(), empty)
+	}
+	ta.dict = df
+
+	ftype := t.instantiateExpr(ta, decl.Type).(*ast.FuncType)
+	params := &ast.FieldList{
+		Opening: ftype.Params.Opening,
+		List: append([]*ast.Field{{
+			Names: []*ast.Ident{ast.NewIdent(df.paramName())},
+			Type:  &ast.StarExpr{X: ast.NewIdent(df.typeName())},
+		}}, ftype.Params.List...),
+		Closing: ftype.Params.Closing,
+	}
+
+	// Named results of type parameter type start as the zero value.
+	var inits []ast.Stmt
+	if decl.Type.Results != nil {
+		for _, f := range decl.Type.Results.List {
+			tp := df.param(t.lookupType(f.Type))
+			if tp == nil {
+				continue
+			}
+			for _, n := range f.Names {
+				inits = append(inits, &ast.AssignStmt{
+					Lhs: []ast.Expr{ast.NewIdent(n.Name)},
+					Tok: token.ASSIGN,
+					Rhs: []ast.Expr{df.selector(df.zeroName(tp), n.Pos())},
+				})
+			}
+		}
+	}
+	body := t.instantiateBlockStmt(ta, decl.Body)
+	body = &ast.BlockStmt{
+		Lbrace: body.Lbrace,
+		List:   append(inits, body.List...),
+		Rbrace: body.Rbrace,
+	}
+
+	shared := &ast.FuncDecl{
+		Doc:  decl.Doc,
+		Name: &ast.Ident{NamePos: decl.Name.NamePos, Name: df.sharedName()},
+		Type: &ast.FuncType{
+			Func:    ftype.Func,
+			Params:  params,
+			Results: ftype.Results,
+		},
+		Body: body,
+	}
+	return []ast.Decl{typeDecl, shared}
+}
+
+// selector returns dict୦.name at pos.
+func (df *dictFunc) selector(name string, pos token.Pos) ast.Expr {
+	return &ast.SelectorExpr{
+		X:   &ast.Ident{NamePos: pos, Name: df.paramName()},
+		Sel: ast.NewIdent(name),
+	}
+}
+
+// dictOperation returns a call of the dictionary entry for the
+// operator op applied to args in a shared function. The orig
+// expression is the first operand in the generic function.
+// It returns nil if the operation does not use the dictionary.
+func (t *translator) dictOperation(ta *typeArgs, pos token.Pos, op token.Token, orig ast.Expr, args ...ast.Expr) ast.Expr {
+	if ta.dict == nil {
+		return nil
+	}
+	tp := ta.dict.param(t.lookupType(orig))
+	if tp == nil {
+		return nil
+	}
+	var name string
+	var ok bool
+	if len(args) == 1 {
+		name, ok = dictUnaryOps[op]
+	} else {
+		name, ok = dictBinaryOps[op]
+	}
+	if !ok {
+		return nil
+	}
+	return &ast.CallExpr{
+		Fun:  ta.dict.selector(ta.dict.opName(tp, name), pos),
+		Args: args,
+	}
+}
+
+// dictMethodCall returns a call of the dictionary entry for a
+// call of a method of a type parameter value in a shared function.
+// It returns nil if the call does not use the dictionary.
+func (t *translator) dictMethodCall(ta *typeArgs, call *ast.CallExpr) ast.Expr {
+	if ta.dict == nil {
+		return nil
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+	tp := ta.dict.param(t.lookupType(sel.X))
+	if tp == nil {
+		return nil
+	}
+	args, _ := t.instantiateExprList(ta, call.Args)
+	return &ast.CallExpr{
+		Fun:    ta.dict.selector(ta.dict.methodName(tp, sel.Sel.Name), sel.Sel.Pos()),
+		Lparen: call.Lparen,
+		Args:   append([]ast.Expr{t.instantiateExpr(ta, sel.X)}, args...),
+		Rparen: call.Rparen,
+	}
+}
+
+// dictAssign returns the translation of an assignment operation
+// such as x += y on a type parameter value in a shared function.
+// It returns nil if the assignment does not use the dictionary.
+func (t *translator) dictAssign(ta *typeArgs, s *ast.AssignStmt) ast.Stmt {
+	if ta.dict == nil || len(s.Lhs) != 1 || len(s.Rhs) != 1 || s.Tok < token.ADD_ASSIGN || s.Tok > token.AND_NOT_ASSIGN {
+		return nil
+	}
+	lhs := t.instantiateExpr(ta, s.Lhs[0])
+	rhs := t.instantiateExpr(ta, s.Rhs[0])
+	call := t.dictOperation(ta, s.TokPos, s.Tok-token.ADD_ASSIGN+token.ADD, s.Lhs[0], lhs, rhs)
+	if call == nil {
+		return nil
+	}
+	return &ast.AssignStmt{
+		Lhs:    []ast.Expr{lhs},
+		TokPos: s.TokPos,
+		Tok:    token.ASSIGN,
+		Rhs:    []ast.Expr{call},
+	}
+}
+
+// dictZero returns the initial values for a variable declaration
+// without values of type parameter type in a shared function.
+// It returns nil if the declaration does not use the dictionary.
+func (t *translator) dictZero(ta *typeArgs, s *ast.ValueSpec) []ast.Expr {
+	if ta.dict == nil || len(s.Values) > 0 || s.Type == nil {
+		return nil
+	}
+	tp := ta.dict.param(t.lookupType(s.Type))
+	if tp == nil {
+		return nil
+	}
+	values := make([]ast.Expr, len(s.Names))
+	for i, n := range s.Names {
+		values[i] = ta.dict.selector(ta.dict.zeroName(tp), n.Pos())
+	}
+	return values
+}
+
+// instantiateDictionaryFunction creates an instantiation of a
+// function translated using a dictionary: a dictionary variable
+// for the type arguments, and a wrapper function that calls
+// the shared function.
+func (t *translator) instantiateDictionaryFunction(qid qualifiedIdent, df *dictFunc, name string, astTypes []ast.Expr, typeTypes []types.Type) (*ast.Ident, error) {
+	decl := df.decl
+	ta, err := typeArgsFromFields(t, astTypes, typeTypes, decl.Type.TParams.List)
+	if err != nil {
+		return nil, err
+	}
+
+	// Positions in a generic function of another package
+	// are not valid in this package's files.
+	var pos, lbrace, rbrace token.Pos
+	if qid.pkg == nil || qid.pkg == t.tpkg {
+		pos, lbrace, rbrace = decl.Name.NamePos, decl.Body.Lbrace, decl.Body.Rbrace
+	}
+
+	qualify := func(name string) ast.Expr {
+		if qid.pkg == nil || qid.pkg == t.tpkg {
+			return ast.NewIdent(name)
+		}
+		return &ast.SelectorExpr{X: ast.NewIdent(qid.pkg.Name()), Sel: ast.NewIdent(name)}
+	}
+	targ := func(tp *types.TypeParam) ast.Expr {
+		e, _ := ta.ast(df.objs[tp])
+		return e
+	}
+
+	// The dictionary.
+	var elts []ast.Expr
+	for _, f := range df.fields() {
+		elts = append(elts, &ast.KeyValueExpr{
+			Key:   ast.NewIdent(f.name),
+			Value: t.dictEntry(df, f, targ),
+		})
+	}
+	dictName, err := t.dictionaryName(qid, name, typeTypes)
+	if err != nil {
+		return nil, err
+	}
+	t.newDecls = append(t.newDecls, &ast.GenDecl{
+		TokPos: pos,
+		Tok:    token.VAR,
+		Specs: []ast.Spec{
+			&ast.ValueSpec{
+				Names: []*ast.Ident{{NamePos: pos, Name: dictName}},
+				Values: []ast.Expr{&ast.CompositeLit{
+					Type: qualify(df.typeName()),
+					Elts: elts,
+				}},
+			},
+		},
+	})
+
+	// The wrapper.
+	obj, _ := t.importer.info.def(decl.Name)
+	sig := obj.Type().(*types.Signature)
+	ftype := t.instantiateExpr(ta, decl.Type).(*ast.FuncType)
+	args := []ast.Expr{&ast.UnaryExpr{Op: token.AND, X: ast.NewIdent(dictName)}}
+	params := &ast.FieldList{}
+	i := 0
+	var ellipsis token.Pos
+	for _, f := range ftype.Params.List {
+		nf := &ast.Field{Type: f.Type}
+		for j := 0; j < len(f.Names) || (j == 0 && len(f.Names) == 0); j++ {
+			id := ast.NewIdent(df.localName("p", i))
+			nf.Names = append(nf.Names, id)
+			args = append(args, ast.NewIdent(id.Name))
+			i++
+		}
+		if _, ok := f.Type.(*ast.Ellipsis); ok {
+			// The position must be valid for ... to be printed.
+			ellipsis = pos
+			if !ellipsis.IsValid() {
+				ellipsis = qid.ident.Pos()
+			}
+		}
+		params.List = append(params.List, nf)
+	}
+	call := &ast.CallExpr{
+		Fun:      qualify(df.sharedName()),
+		Args:     args,
+		Ellipsis: ellipsis,
+	}
+
+	var stmts []ast.Stmt
+	results := ftype.Results
+	nresults := sig.Results().Len()
+	hasParam := false
+	for i := 0; i < nresults; i++ {
+		if df.param(sig.Results().At(i).Type()) != nil {
+			hasParam = true
+		}
+	}
+	switch {
+	case nresults == 0:
+		stmts = []ast.Stmt{&ast.ExprStmt{X: call}}
+	case !hasParam:
+		stmts = []ast.Stmt{&ast.ReturnStmt{Results: []ast.Expr{call}}}
+	default:
+		// Convert the results from interface{}. A result of
+		// interface type may be nil, so use a comma-ok assertion.
+		results = &ast.FieldList{}
+		var tmps []ast.Expr
+		i := 0
+		for _, f := range ftype.Results.List {
+			nf := &ast.Field{Type: f.Type}
+			for j := 0; j < len(f.Names) || (j == 0 && len(f.Names) == 0); j++ {
+				nf.Names = append(nf.Names, ast.NewIdent(df.localName("r", i)))
+				tmps = append(tmps, ast.NewIdent(df.localName("x", i)))
+				i++
+			}
+			results.List = append(results.List, nf)
+		}
+		stmts = append(stmts, &ast.AssignStmt{Lhs: tmps, Tok: token.DEFINE, Rhs: []ast.Expr{call}})
+		for i := 0; i < nresults; i++ {
+			r := ast.NewIdent(df.localName("r", i))
+			x := ast.NewIdent(df.localName("x", i))
+			if tp := df.param(sig.Results().At(i).Type()); tp != nil {
+				stmts = append(stmts, &ast.AssignStmt{
+					Lhs: []ast.Expr{r, ast.NewIdent("_")},
+					Tok: token.ASSIGN,
+					Rhs: []ast.Expr{&ast.TypeAssertExpr{X: x, Type: targ(tp)}},
+				})
+			} else {
+				stmts = append(stmts, &ast.AssignStmt{Lhs: []ast.Expr{r}, Tok: token.ASSIGN, Rhs: []ast.Expr{x}})
+			}
+		}
+		stmts = append(stmts, &ast.ReturnStmt{})
+	}
+
+	instIdent := &ast.Ident{NamePos: pos, Name: name}
+	t.newDecls = append(t.newDecls, &ast.FuncDecl{
+		Name: instIdent,
+		Type: &ast.FuncType{
+			Func:    pos,
+			Params:  params,
+			Results: results,
+		},
+		Body: &ast.BlockStmt{
+			Lbrace: lbrace,
+			List:   stmts,
+			Rbrace: rbrace,
+		},
+	})
+	return instIdent, nil
+}
+
+// dictionaryName returns the name of the dictionary variable of the
+// instantiation name of qid with typeTypes.
+func (t *translator) dictionaryName(qid qualifiedIdent, name string, typeTypes []types.Type) (string, error) {
+	if t.importer.naming != ReadableNames {
+		return t.mangledName("Dictionary", qid, typeTypes)
+	}
+	dictName := t.importer.naming.generatedName("Dictionary", name)
+	origin := "dictionary of " + instantiationOrigin(t.genericPackage(qid), qid.ident.Name, typeTypes)
+	if err := t.recordName(qid.ident.Pos(), dictName, origin, origin); err != nil {
+		return "", err
+	}
+	return dictName, nil
+}
+
+// dictEntry returns the value of the dictionary field f
+// for the type arguments returned by targ.
+func (t *translator) dictEntry(df *dictFunc, f dictField, targ func(*types.TypeParam) ast.Expr) ast.Expr {
+	a := targ(f.tparam)
+	if f.op == "" && f.sig == nil {
+		// *new(T)
+		return &ast.StarExpr{X: &ast.CallExpr{Fun: ast.NewIdent("new"), Args: []ast.Expr{a}}}
+	}
+
+	ftype := df.fieldType(f).(*ast.FuncType)
+	var body ast.Stmt
+	operand := func(name string, tp *types.TypeParam) ast.Expr {
+		return &ast.TypeAssertExpr{X: ast.NewIdent(name), Type: targ(tp)}
+	}
+	x := df.localName("x", -1)
+	y := df.localName("y", -1)
+	switch {
+	case f.sig != nil:
+		ftype.Params.List[0].Names = []*ast.Ident{ast.NewIdent(x)}
+		var args []ast.Expr
+		for i := 0; i < f.sig.Params().Len(); i++ {
+			p := df.localName("p", i)
+			ftype.Params.List[i+1].Names = []*ast.Ident{ast.NewIdent(p)}
+			if tp := df.param(f.sig.Params().At(i).Type()); tp != nil {
+				args = append(args, operand(p, tp))
+			} else {
+				args = append(args, ast.NewIdent(p))
+			}
+		}
+		call := &ast.CallExpr{
+			Fun:  &ast.SelectorExpr{X: operand(x, f.tparam), Sel: ast.NewIdent(f.method)},
+			Args: args,
+		}
+		if f.sig.Results().Len() == 0 {
+			body = &ast.ExprStmt{X: call}
+		} else {
+			body = &ast.ReturnStmt{Results: []ast.Expr{call}}
+		}
+	case isUnary(f.op):
+		ftype.Params.List[0].Names = []*ast.Ident{ast.NewIdent(x)}
+		op := token.SUB
+		if f.op == "not" {
+			op = token.XOR
+		}
+		body = &ast.ReturnStmt{Results: []ast.Expr{&ast.UnaryExpr{Op: op, X: operand(x, f.tparam)}}}
+	default:
+		ftype.Params.List[0].Names = []*ast.Ident{ast.NewIdent(x)}
+		ftype.Params.List[1].Names = []*ast.Ident{ast.NewIdent(y)}
+		var op token.Token
+		for tok, name := range dictBinaryOps {
+			if name == f.op {
+				op = tok
+			}
+		}
+		body = &ast.ReturnStmt{Results: []ast.Expr{&ast.BinaryExpr{X: operand(x, f.tparam), Op: op, Y: operand(y, f.tparam)}}}
+	}
+	return &ast.FuncLit{Type: ftype, Body: &ast.BlockStmt{List: []ast.Stmt{body}}}
+}
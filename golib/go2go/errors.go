@@ -0,0 +1,122 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package go2go
+
+import (
+	"fmt"
+	"github.com/tdakkota/go2go/golib/token"
+	"sort"
+	"strings"
+)
+
+// An ErrorKind is the category of a translation error.
+type ErrorKind int
+
+const (
+	// Unsupported is a construct that the translator does not handle.
+	Unsupported ErrorKind = iota
+	// Instantiation is a failure to instantiate a generic function or type.
+	Instantiation
+	// Import is a failure to refer to an imported package.
+	Import
+	// Internal is an inconsistency within the translator.
+	Internal
+)
+
+var errorKindNames = [...]string{
+	Unsupported:   "unsupported",
+	Instantiation: "instantiation",
+	Import:        "import",
+	Internal:      "internal error",
+}
+
+// String returns a printable name for the error category.
+func (k ErrorKind) String() string {
+	if 0 <= k && int(k) < len(errorKindNames) {
+		return errorKindNames[k]
+	}
+	return fmt.Sprintf("ErrorKind(%d)", int(k))
+}
+
+// An Error describes a problem found while translating
+// Go with contracts to Go 1.
+// The position Pos, if valid, points to the offending node.
+type Error struct {
+	Pos  token.Position
+	Kind ErrorKind
+	Msg  string
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	if e.Pos.Filename != "" || e.Pos.IsValid() {
+		return fmt.Sprintf("%s: %s: %s", e.Pos, e.Kind, e.Msg)
+	}
+	return fmt.Sprintf("%s: %s", e.Kind, e.Msg)
+}
+
+// An ErrorList is a list of translation errors.
+// Rewrite, RewriteFiles and RewriteBuffer return an ErrorList
+// holding every problem found during translation.
+type ErrorList []*Error
+
+// Sort sorts an ErrorList by position.
+func (p ErrorList) Sort() {
+	sort.SliceStable(p, func(i, j int) bool {
+		e, f := &p[i].Pos, &p[j].Pos
+		if e.Filename != f.Filename {
+			return e.Filename < f.Filename
+		}
+		if e.Line != f.Line {
+			return e.Line < f.Line
+		}
+		return e.Column < f.Column
+	})
+}
+
+// Error implements the error interface.
+func (p ErrorList) Error() string {
+	var sb strings.Builder
+	for i, e := range p {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+		sb.WriteString(e.Error())
+	}
+	return sb.String()
+}
+
+// Err returns an error equivalent to this error list.
+// If the list is empty, Err returns nil.
+func (p ErrorList) Err() error {
+	if len(p) == 0 {
+		return nil
+	}
+	return p
+}
+
+// errorf records a translation error at pos.
+func (t *translator) errorf(pos token.Pos, kind ErrorKind, format string, args ...interface{}) {
+	t.errs = append(t.errs, t.newError(pos, kind, format, args...))
+}
+
+// newError returns a translation error at pos.
+func (t *translator) newError(pos token.Pos, kind ErrorKind, format string, args ...interface{}) *Error {
+	return &Error{
+		Pos:  t.fset.Position(pos),
+		Kind: kind,
+		Msg:  fmt.Sprintf(format, args...),
+	}
+}
+
+// addError records err. If err is not an *Error, it is recorded
+// as an error of kind at pos.
+func (t *translator) addError(pos token.Pos, kind ErrorKind, err error) {
+	if e, ok := err.(*Error); ok {
+		t.errs = append(t.errs, e)
+		return
+	}
+	t.errorf(pos, kind, "%v", err)
+}
@@ -0,0 +1,238 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package go2go
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/tdakkota/go2go/golib/ast"
+	"github.com/tdakkota/go2go/golib/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A FileSystem provides the source files that an Importer translates.
+// File names are file paths, as used with the os package.
+type FileSystem interface {
+	// ReadDir returns the names of the files in the directory dir.
+	ReadDir(dir string) ([]string, error)
+
+	// ReadFile returns the contents of the file name.
+	ReadFile(name string) ([]byte, error)
+}
+
+// OSFS is the FileSystem of the operating system.
+var OSFS FileSystem = osFS{}
+
+// osFS implements FileSystem using the os package.
+type osFS struct{}
+
+func (osFS) ReadDir(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return nil, fmt.Errorf("reading directory %s: %w", dir, err)
+	}
+	return names, nil
+}
+
+func (osFS) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(name)
+}
+
+// A MapFS is a FileSystem held in memory. It maps file names to
+// file contents. A directory exists if it holds a file.
+type MapFS map[string][]byte
+
+// ReadDir implements FileSystem.
+func (fsys MapFS) ReadDir(dir string) ([]string, error) {
+	dir = filepath.Clean(dir)
+	seen := make(map[string]bool)
+	var names []string
+	found := false
+	for name := range fsys {
+		rel, err := filepath.Rel(dir, filepath.Clean(name))
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		found = true
+		// A file in a subdirectory adds the subdirectory.
+		if i := strings.IndexRune(rel, filepath.Separator); i >= 0 {
+			rel = rel[:i]
+		}
+		if !seen[rel] {
+			seen[rel] = true
+			names = append(names, rel)
+		}
+	}
+	if !found {
+		return nil, &os.PathError{Op: "open", Path: dir, Err: os.ErrNotExist}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ReadFile implements FileSystem.
+func (fsys MapFS) ReadFile(name string) ([]byte, error) {
+	if data, ok := fsys[name]; ok {
+		return data, nil
+	}
+	for n, data := range fsys {
+		if filepath.Clean(n) == filepath.Clean(name) {
+			return data, nil
+		}
+	}
+	return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+}
+
+// NewImporterFS returns a new Importer that reads the sources of
+// packages from fsys, and that never writes to the disk. Translated
+// files are kept in memory: RewriteFS returns the translation of a
+// directory, and ImportedFiles the translations of imported packages.
+// Imported packages that are not found in fsys are imported using
+// the default Go importer.
+func NewImporterFS(fsys FileSystem) *Importer {
+	imp := NewImporter("")
+	imp.fs = fsys
+	imp.mem = make(map[string][]byte)
+	return imp
+}
+
+// inMemory reports whether imp keeps the translated files in memory.
+func (imp *Importer) inMemory() bool {
+	return imp.mem != nil
+}
+
+// RewriteFS translates the .go2 files in the directory dir of the
+// file system of an Importer returned by NewImporterFS, and returns
+// the translated .go files, keyed by file name. Nothing is written
+// to the disk, and no file is removed.
+// If the code cannot be translated, the error is an ErrorList
+// describing every problem that was found.
+func RewriteFS(importer *Importer, dir string) (map[string][]byte, error) {
+	if !importer.inMemory() {
+		return nil, fmt.Errorf("RewriteFS: Importer not created by NewImporterFS")
+	}
+	go2files, _, err := importer.PackageFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	importer.clearOutput(dir)
+	if _, err := rewriteFilesInPath(importer, nil, "", dir, dir, go2files); err != nil {
+		return nil, err
+	}
+	files, err := importer.outputFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// ImportedFiles returns the translated .go files of the packages
+// imported by an Importer returned by NewImporterFS, keyed by the
+// name that each file would have in the source directory of its
+// package.
+func (imp *Importer) ImportedFiles() map[string][]byte {
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
+	files := make(map[string][]byte)
+	for _, dir := range imp.translated {
+		dir = filepath.Clean(dir)
+		for name, data := range imp.mem {
+			if filepath.Dir(name) == dir {
+				files[name] = data
+			}
+		}
+	}
+	return files
+}
+
+// isDir reports whether dir is a directory in the file system of imp.
+func (imp *Importer) isDir(dir string) bool {
+	if imp.fs == OSFS {
+		fi, err := os.Stat(dir)
+		return err == nil && fi.IsDir()
+	}
+	_, err := imp.fs.ReadDir(dir)
+	return err == nil
+}
+
+// writeFile writes the translated file to filename. The build
+// constraint lines constraints, if any, precede the package clause.
+func (imp *Importer) writeFile(filename string, fset *token.FileSet, file *ast.File, constraints []byte) error {
+	var buf bytes.Buffer
+	fmt.Fprint(&buf, rewritePrefix)
+	if constraints != nil {
+		fmt.Fprintf(&buf, "%s\n", constraints)
+	}
+	if err := config.Fprint(&buf, fset, file); err != nil {
+		return err
+	}
+	return imp.writeOutput(filename, buf.Bytes())
+}
+
+// writeOutput writes data to the translated file filename,
+// on the disk or in memory.
+func (imp *Importer) writeOutput(filename string, data []byte) error {
+	if !imp.inMemory() {
+		return ioutil.WriteFile(filename, data, 0666)
+	}
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
+	imp.mem[filepath.Clean(filename)] = data
+	return nil
+}
+
+// outputFiles returns the translated .go files in dir, and the names
+// file, keyed by file name.
+func (imp *Importer) outputFiles(dir string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	if imp.inMemory() {
+		dir = filepath.Clean(dir)
+		imp.mu.Lock()
+		defer imp.mu.Unlock()
+		for name, data := range imp.mem {
+			if filepath.Dir(name) == dir {
+				files[filepath.Base(name)] = data
+			}
+		}
+		return files, nil
+	}
+	names, err := OSFS.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if filepath.Ext(name) != ".go" && name != namesFile {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		files[name] = data
+	}
+	return files, nil
+}
+
+// clearOutput forgets the translated files in dir that are held
+// in memory, so that a directory may be translated again.
+func (imp *Importer) clearOutput(dir string) {
+	dir = filepath.Clean(dir)
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
+	for name := range imp.mem {
+		if filepath.Dir(name) == dir {
+			delete(imp.mem, name)
+		}
+	}
+}
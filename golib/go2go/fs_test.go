@@ -0,0 +1,102 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package go2go_test
+
+import (
+	"github.com/tdakkota/go2go/golib/go2go"
+	"github.com/tdakkota/go2go/testutil/testenv"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestRewriteFS(t *testing.T) {
+	t.Parallel()
+	testenv.MustHaveGoBuild(t)
+
+	tmpdir, err := ioutil.TempDir("", "go2go-rewritefs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// The sources are only in memory; nothing exists under root.
+	root := filepath.Join(tmpdir, "m")
+	fsys := go2go.MapFS{
+		filepath.Join(root, "go.mod"): []byte("module example.com/m\n\ngo 1.13\n"),
+		filepath.Join(root, "list", "list.go2"): []byte(`package list
+
+type List(type T) []T
+
+func (l List(T)) Len() int { return len(l) }
+
+func Of(type T)(v ...T) List(T) { return List(T)(v) }
+`),
+		filepath.Join(root, "cmd", "main.go2"): []byte(`package main
+
+import "example.com/m/list"
+
+func main() {
+	println(list.Of(1, 2, 3).Len(), list.Of("a").Len())
+}
+`),
+	}
+	importer := go2go.NewImporterFS(fsys)
+	if _, err := importer.FindModule(root); err != nil {
+		t.Fatal(err)
+	}
+	files, err := go2go.RewriteFS(importer, filepath.Join(root, "cmd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(root); !os.IsNotExist(err) {
+		t.Fatalf("RewriteFS wrote to the disk: %v", err)
+	}
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if want := []string{"instantiations.go", "main.go"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("RewriteFS returned files %v, want %v", names, want)
+	}
+	imported := importer.ImportedFiles()
+	if _, ok := imported[filepath.Join(root, "list", "list.go")]; !ok || len(imported) != 1 {
+		var names []string
+		for name := range imported {
+			names = append(names, name)
+		}
+		t.Errorf("ImportedFiles returned %v, want list/list.go", names)
+	}
+
+	// The translation builds once written out.
+	for name, data := range files {
+		imported[filepath.Join(root, "cmd", name)] = data
+	}
+	imported[filepath.Join(root, "go.mod")] = fsys[filepath.Join(root, "go.mod")]
+	for name, data := range imported {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command(testenv.GoToolPath(t), "run", "./cmd")
+	cmd.Dir = root
+	cmd.Env = append(os.Environ(), "GO111MODULE=on")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("error running translation: %v\n%s", err, out)
+	}
+	if got, want := string(out), "3 1\n"; got != want {
+		t.Errorf("translation printed %q, want %q", got, want)
+	}
+}
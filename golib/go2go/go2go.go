@@ -22,10 +22,22 @@ import (
 // rewritePrefix is what we put at the start of each newly generated .go file.
 const rewritePrefix = "// Code generated by go2go; DO NOT EDIT.\n\n"
 
+// The instantiations of generic functions and types needed by a
+// package are written to InstantiationsFile. Instantiations needed
+// only by the tests of the package are written to testInstantiationsFile,
+// and those needed by an external test package to xtestInstantiationsFile.
+const (
+	InstantiationsFile      = "instantiations.go"
+	testInstantiationsFile  = "instantiations_test.go"
+	xtestInstantiationsFile = "instantiations_x_test.go"
+)
+
 // Rewrite rewrites the contents of a single directory.
 // It looks for all files with the extension .go2, and parses
 // them as a single package. It writes out a .go file with any
 // polymorphic code rewritten into normal code.
+// If the code cannot be translated, the error is an ErrorList
+// describing every problem that was found.
 func Rewrite(importer *Importer, dir string) error {
 	_, err := rewriteToPkgs(importer, "", dir)
 	return err
@@ -34,16 +46,29 @@ func Rewrite(importer *Importer, dir string) error {
 // rewriteToPkgs rewrites the contents of a single directory,
 // and returns the types.Packages that it computes.
 func rewriteToPkgs(importer *Importer, importPath, dir string) ([]*types.Package, error) {
-	go2files, gofiles, err := go2Files(dir)
+	go2files, gofiles, err := go2Files(importer.fs, dir)
 	if err != nil {
 		return nil, err
 	}
-
-	if err := checkAndRemoveGofiles(dir, gofiles); err != nil {
+	go2files, err = importer.matchFiles(dir, go2files)
+	if err != nil {
 		return nil, err
 	}
 
-	return rewriteFilesInPath(importer, importPath, dir, go2files)
+	// Every generated file is removed, whatever its build
+	// constraints, as it may be left from another build context.
+	if importer.inMemory() {
+		importer.clearOutput(dir)
+	} else {
+		if err := removeGenerated(dir, gofiles); err != nil {
+			return nil, err
+		}
+		if err := os.Remove(filepath.Join(dir, namesFile)); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	return rewriteFilesInPath(importer, nil, importPath, dir, dir, go2files)
 }
 
 // namedAST holds a file name and the AST parsed from that file.
@@ -54,62 +79,221 @@ type namedAST struct {
 
 // rewriteFiles rewrites a set of .go2 files in dir.
 func RewriteFiles(importer *Importer, dir string, go2files []string) ([]*types.Package, error) {
-	return rewriteFilesInPath(importer, "", dir, go2files)
+	return rewriteFilesInPath(importer, nil, "", dir, dir, go2files)
 }
 
-// rewriteFilesInPath rewrites a set of .go2 files in dir for importPath.
-func rewriteFilesInPath(importer *Importer, importPath, dir string, go2files []string) ([]*types.Package, error) {
+// rewriteFilesInPath rewrites a set of .go2 files in dir for importPath,
+// imported by the packages in stack. The .go files are written to outdir.
+// The //line directives in the .go files refer to the .go2 files in dir.
+// The hand-written .go files in dir are type checked with the .go2
+// files, and copied to outdir if it is not dir.
+func rewriteFilesInPath(importer *Importer, stack []string, importPath, dir, outdir string, go2files []string) ([]*types.Package, error) {
+	allGofiles, err := HandWrittenFiles(importer.fs, dir)
+	if err != nil {
+		return nil, err
+	}
+	gofiles, err := importer.matchFiles(dir, allGofiles)
+	if err != nil {
+		return nil, err
+	}
+	handWritten := make(map[string]bool)
+	for _, gof := range allGofiles {
+		switch gof {
+		case InstantiationsFile, testInstantiationsFile, xtestInstantiationsFile:
+			return nil, fmt.Errorf("%s: file name is reserved for instantiations", filepath.Join(dir, gof))
+		}
+		handWritten[gof] = true
+	}
+	for _, go2f := range go2files {
+		gof := strings.TrimSuffix(go2f, ".go2") + ".go"
+		switch gof {
+		case InstantiationsFile, testInstantiationsFile, xtestInstantiationsFile:
+			return nil, fmt.Errorf("%s: file name is reserved for instantiations", filepath.Join(dir, go2f))
+		}
+		if handWritten[gof] {
+			return nil, fmt.Errorf("%s: translation would overwrite hand-written file %s", filepath.Join(dir, go2f), gof)
+		}
+	}
+
 	fset := token.NewFileSet()
-	pkgs, err := parseFiles(dir, go2files, fset)
+	pkgs, err := parseFiles(importer, dir, go2files, gofiles, fset)
 	if err != nil {
 		return nil, err
 	}
 
+	key := importPath
+	if key == "" {
+		key = dir
+	}
+	stackImporter := importer.forStack(stack, key)
+
+	// The hand-written .go files are type checked along with the
+	// .go2 files, but only the .go2 files are translated.
 	var rpkgs []*types.Package
 	var tpkgs [][]namedAST
+	var checked []*ast.File
+	var errs ErrorList
 	for _, pkg := range pkgs {
-		pkgfiles := make([]namedAST, 0, len(pkg.Files))
+		var pkgfiles, go1files []namedAST
 		for n, f := range pkg.Files {
-			pkgfiles = append(pkgfiles, namedAST{n, f})
+			if filepath.Ext(n) == ".go" {
+				go1files = append(go1files, namedAST{n, f})
+			} else {
+				pkgfiles = append(pkgfiles, namedAST{n, f})
+			}
 		}
 		sort.Slice(pkgfiles, func(i, j int) bool {
 			return pkgfiles[i].name < pkgfiles[j].name
 		})
+		sort.Slice(go1files, func(i, j int) bool {
+			return go1files[i].name < go1files[j].name
+		})
 
 		asts := make([]*ast.File, 0, len(pkgfiles))
 		for _, a := range pkgfiles {
 			asts = append(asts, a.ast)
 		}
+		all := append([]*ast.File(nil), asts...)
+		for _, a := range go1files {
+			all = append(all, a.ast)
+		}
+		checked = append(checked, all...)
 
 		var merr multiErr
 		conf := types.Config{
-			Importer: importer,
+			Importer: stackImporter,
 			Error:    merr.add,
 		}
-		tpkg, err := conf.Check(pkg.Name, fset, asts, importer.info)
+		info := newInfo()
+		tpkg, err := conf.Check(pkg.Name, fset, all, info)
 		if err != nil {
 			return nil, fmt.Errorf("type checking failed for %s\n%v", pkg.Name, merr)
 		}
+		importer.info.merge(info)
+		errs = append(errs, checkHandWritten(fset, info, go1files)...)
 
 		if !strings.HasSuffix(pkg.Name, "_test") {
 			importer.record(pkgfiles, importPath, tpkg, asts)
+			importer.addDictionaryDecls(fset, asts)
 		}
 
 		rpkgs = append(rpkgs, tpkg)
 		tpkgs = append(tpkgs, pkgfiles)
 	}
+	if len(errs) > 0 {
+		errs.Sort()
+		return nil, errs
+	}
 
-	for i, tpkg := range tpkgs {
-		for j, pkgfile := range tpkg {
-			if err := rewriteFile(dir, fset, importer, importPath, rpkgs[i], pkgfile.name, pkgfile.ast, j == 0); err != nil {
+	// An imported package whose translation is cached
+	// need not be translated again.
+	var cacheKey string
+	if importPath != "" && importer.cacheDir != "" {
+		files := append(append([]string(nil), go2files...), gofiles...)
+		if key, err := importer.cacheKey(importPath, dir, files, checked); err == nil {
+			importer.mu.Lock()
+			importer.cacheKeys[importPath] = key
+			importer.mu.Unlock()
+			if importer.restoreCached(key, outdir, importedPackage(rpkgs)) {
+				return rpkgs, nil
+			}
+			cacheKey = key
+		}
+	}
+
+	// Translate every file before reporting errors,
+	// so that all translation problems are reported at once.
+	var sts []*pkgTranslation
+	addErr := func(err error) error {
+		if el, ok := err.(ErrorList); ok {
+			errs = append(errs, el...)
+			return nil
+		}
+		return err
+	}
+	for i, pkgfiles := range tpkgs {
+		tpkg := rpkgs[i]
+		xtest := strings.HasSuffix(tpkg.Name(), "_test")
+
+		// Test files are translated after the other files,
+		// so that they can use the same instantiations.
+		// Instantiations that only the tests need are written
+		// to a separate _test.go file.
+		var files, testFiles []namedAST
+		for _, pkgfile := range pkgfiles {
+			if xtest || strings.HasSuffix(pkgfile.name, "_test.go2") {
+				testFiles = append(testFiles, pkgfile)
+			} else {
+				files = append(files, pkgfile)
+			}
+		}
+
+		st := newPkgTranslation(importPath != "" && !xtest)
+		sts = append(sts, st)
+		for j, pkgfile := range append(files, testFiles...) {
+			if j == len(files) {
+				if err := addErr(rewriteInstantiations(outdir, fset, importer, importPath, tpkg, st, InstantiationsFile, files)); err != nil {
+					return nil, err
+				}
+				st.export = false
+				st.test = true
+			}
+			err := rewriteFile(outdir, fset, importer, importPath, tpkg, st, pkgfile.name, pkgfile.ast, j == 0)
+			if err := addErr(err); err != nil {
 				return nil, err
 			}
 		}
+		name := testInstantiationsFile
+		if xtest {
+			name = xtestInstantiationsFile
+		} else if len(testFiles) == 0 {
+			name = InstantiationsFile
+		}
+		if err := addErr(rewriteInstantiations(outdir, fset, importer, importPath, tpkg, st, name, pkgfiles)); err != nil {
+			return nil, err
+		}
+		importer.addRequests(tpkg, st.requests)
+	}
+	if len(errs) > 0 {
+		errs.Sort()
+		return nil, errs
+	}
+
+	if outdir != dir {
+		copies, err := importer.handWrittenCopies(dir, gofiles)
+		if err != nil {
+			return nil, err
+		}
+		for name, data := range copies {
+			if err := importer.writeOutput(filepath.Join(outdir, name), data); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := importer.writeNames(outdir, rpkgs, sts); err != nil {
+		return nil, err
+	}
+
+	if cacheKey != "" {
+		importer.storeCache(cacheKey, outdir, importedPackage(rpkgs))
 	}
 
 	return rpkgs, nil
 }
 
+// importedPackage returns the package that importing the directory
+// holding pkgs provides: the one package, or the one that is not an
+// external test package.
+func importedPackage(pkgs []*types.Package) *types.Package {
+	for _, pkg := range pkgs {
+		if !strings.HasSuffix(pkg.Name(), "_test") {
+			return pkg
+		}
+	}
+	return pkgs[0]
+}
+
 // RewriteBuffer rewrites the contents of a single file, in a buffer.
 // It returns a modified buffer. The filename parameter is only used
 // for error messages.
@@ -119,43 +303,41 @@ func RewriteBuffer(importer *Importer, filename string, file []byte) ([]byte, er
 	if err != nil {
 		return nil, err
 	}
+	importer.scanDirectives(filename, file)
 	var merr multiErr
 	conf := types.Config{
 		Importer: importer,
 		Error:    merr.add,
 	}
-	tpkg, err := conf.Check(pf.Name.Name, fset, []*ast.File{pf}, importer.info)
+	info := newInfo()
+	tpkg, err := conf.Check(pf.Name.Name, fset, []*ast.File{pf}, info)
 	if err != nil {
 		return nil, fmt.Errorf("type checking failed for %s\n%v", pf.Name.Name, merr)
 	}
+	importer.info.merge(info)
 	importer.addIDs(pf)
-	if err := rewriteAST(fset, importer, "", tpkg, pf, true); err != nil {
+	importer.addDictionaryDecls(fset, []*ast.File{pf})
+	if err := rewriteAST(fset, importer, "", tpkg, newPkgTranslation(false), pf, true, true); err != nil {
 		return nil, err
 	}
 	var buf bytes.Buffer
-	fmt.Fprintln(&buf, rewritePrefix)
+	fmt.Fprint(&buf, rewritePrefix)
+	if lines := buildConstraints(file); lines != nil {
+		fmt.Fprintf(&buf, "%s\n", lines)
+	}
 	if err := config.Fprint(&buf, fset, pf); err != nil {
 		return nil, err
 	}
 	return buf.Bytes(), nil
 }
 
-// go2Files returns the list of files in dir with a .go2 extension
-// and a list of files with a .go extension.
-// This returns an error if it finds any .go files that do not start
-// with rewritePrefix.
-func go2Files(dir string) (go2files []string, gofiles []string, err error) {
-	f, err := os.Open(dir)
+// go2Files returns the list of files in dir in fsys with a .go2
+// extension and a list of files with a .go extension.
+func go2Files(fsys FileSystem, dir string) (go2files []string, gofiles []string, err error) {
+	files, err := fsys.ReadDir(dir)
 	if err != nil {
 		return nil, nil, err
 	}
-	defer f.Close()
-
-	files, err := f.Readdirnames(0)
-	if err != nil {
-		return nil, nil, fmt.Errorf("reading directory %s: %w", dir, err)
-
-	}
 
 	go2files = make([]string, 0, len(files))
 	gofiles = make([]string, 0, len(files))
@@ -171,16 +353,50 @@ func go2Files(dir string) (go2files []string, gofiles []string, err error) {
 	return go2files, gofiles, nil
 }
 
-// checkAndRemoveGofiles looks through all the .go files.
+// HandWrittenFiles returns the .go files in dir in fsys that were not
+// written by go2go. They belong to the same package as the .go2 files
+// in dir: they are type checked along with them, and left as they are
+// when the .go2 files are translated.
+func HandWrittenFiles(fsys FileSystem, dir string) ([]string, error) {
+	_, gofiles, err := go2Files(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, f := range gofiles {
+		generated, err := isGenerated(fsys, dir, f)
+		if err != nil {
+			return nil, err
+		}
+		if !generated {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// RemoveTranslation removes the .go files that translating the
+// .go2 files in dir wrote there. Other .go files are left alone.
+func RemoveTranslation(dir string) error {
+	_, gofiles, err := go2Files(OSFS, dir)
+	if err != nil {
+		return err
+	}
+	return removeGenerated(dir, gofiles)
+}
+
+// removeGenerated looks through all the .go files.
 // Any .go file that starts with rewritePrefix is removed.
-// Any other .go file is reported as an error.
-// This is intended to make it harder for go2go to break a
-// traditional Go package.
-func checkAndRemoveGofiles(dir string, gofiles []string) error {
+// Any other .go file was written by hand, and is kept.
+func removeGenerated(dir string, gofiles []string) error {
 	for _, f := range gofiles {
-		if err := checkGoFile(dir, f); err != nil {
+		generated, err := isGenerated(OSFS, dir, f)
+		if err != nil {
 			return err
 		}
+		if !generated {
+			continue
+		}
 		if err := os.Remove(filepath.Join(dir, f)); err != nil {
 			return err
 		}
@@ -188,33 +404,48 @@ func checkAndRemoveGofiles(dir string, gofiles []string) error {
 	return nil
 }
 
-// checkGofile reports an error if the file does not start with rewritePrefix.
-func checkGoFile(dir, f string) error {
-	o, err := os.Open(filepath.Join(dir, f))
-	if err != nil {
-		return err
-	}
-	defer o.Close()
-	var buf [100]byte
-	n, err := o.Read(buf[:])
-	if n > 0 && !strings.HasPrefix(string(buf[:n]), rewritePrefix) {
-		return fmt.Errorf("Go file %s was not created by go2go", f)
+// isGenerated reports whether the file in fsys starts with
+// rewritePrefix. An empty file is taken to be generated.
+func isGenerated(fsys FileSystem, dir, f string) (bool, error) {
+	if fsys == OSFS {
+		o, err := os.Open(filepath.Join(dir, f))
+		if err != nil {
+			return false, err
+		}
+		defer o.Close()
+		var buf [100]byte
+		n, err := o.Read(buf[:])
+		if err != nil && err != io.EOF {
+			return false, err
+		}
+		return n == 0 || strings.HasPrefix(string(buf[:n]), rewritePrefix), nil
 	}
-	if err != nil && err != io.EOF {
-		return err
+	data, err := fsys.ReadFile(filepath.Join(dir, f))
+	if err != nil {
+		return false, err
 	}
-	return nil
+	return len(data) == 0 || bytes.HasPrefix(data, []byte(rewritePrefix)), nil
 }
 
-// parseFiles parses a list of .go2 files.
-func parseFiles(dir string, go2files []string, fset *token.FileSet) ([]*ast.Package, error) {
+// parseFiles parses a list of .go2 files, and a list of hand-written
+// .go files, in dir. The dictionary directives in the .go2 files are
+// recorded in importer.
+func parseFiles(importer *Importer, dir string, go2files, gofiles []string, fset *token.FileSet) ([]*ast.Package, error) {
 	pkgs := make(map[string]*ast.Package)
-	for _, go2f := range go2files {
-		filename := filepath.Join(dir, go2f)
-		pf, err := parser.ParseFile(fset, filename, nil, 0)
+	for _, f := range append(append([]string(nil), go2files...), gofiles...) {
+		filename := filepath.Join(dir, f)
+		src, err := importer.fs.ReadFile(filename)
 		if err != nil {
 			return nil, err
 		}
+		pf, err := parser.ParseFile(fset, filename, src, 0)
+		if err != nil {
+			return nil, err
+		}
+		if filepath.Ext(f) == ".go2" {
+			importer.scanDirectives(filename, src)
+			importer.scanConstraints(filename, src)
+		}
 
 		name := pf.Name.Name
 		pkg, ok := pkgs[name]
@@ -239,6 +470,85 @@ func parseFiles(dir string, go2files []string, fset *token.FileSet) ([]*ast.Pack
 	return rpkgs, nil
 }
 
+// checkHandWritten reports the generic declarations, and the uses of
+// generic functions and types, in the hand-written .go files of a
+// package. Those files are not translated, so they must be Go 1.
+func checkHandWritten(fset *token.FileSet, info *types.Info, files []namedAST) ErrorList {
+	var errs ErrorList
+	errorf := func(pos token.Pos, format string, args ...interface{}) {
+		errs = append(errs, &Error{
+			Pos:  fset.Position(pos),
+			Kind: Unsupported,
+			Msg:  fmt.Sprintf(format, args...),
+		})
+	}
+	for _, f := range files {
+		base := filepath.Base(f.name)
+		ast.Inspect(f.ast, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FuncDecl:
+				if isParameterizedFuncDecl(n, info) {
+					errorf(n.Name.Pos(), "generic function %s declared in Go 1 file %s; move it to a .go2 file", n.Name.Name, base)
+					return false
+				}
+			case *ast.TypeSpec:
+				if n.TParams != nil {
+					errorf(n.Name.Pos(), "generic type %s declared in Go 1 file %s; move it to a .go2 file", n.Name.Name, base)
+					return false
+				}
+			case *ast.ContractSpec:
+				errorf(n.Name.Pos(), "contract %s declared in Go 1 file %s; move it to a .go2 file", n.Name.Name, base)
+				return false
+			case *ast.Ident:
+				if obj := info.Uses[n]; obj != nil && isGenericObject(obj) {
+					errorf(n.Pos(), "generic %s used in Go 1 file %s; move the use to a .go2 file", n.Name, base)
+				}
+			}
+			return true
+		})
+	}
+	return errs
+}
+
+// isGenericObject reports whether obj is a generic function or type,
+// or a contract.
+func isGenericObject(obj types.Object) bool {
+	switch obj := obj.(type) {
+	case *types.Func:
+		sig, ok := obj.Type().(*types.Signature)
+		return ok && len(sig.TParams()) > 0
+	case *types.TypeName:
+		named, ok := obj.Type().(*types.Named)
+		return ok && len(named.TParams()) > 0 && len(named.TArgs()) == 0
+	case *types.Contract:
+		return true
+	}
+	return false
+}
+
+// handWrittenCopies returns the hand-written .go files gofiles in dir,
+// keyed by file name, as they are copied next to the translated files
+// when those are written elsewhere. A //line directive keeps the
+// positions reported by the compiler in the original files.
+func (imp *Importer) handWrittenCopies(dir string, gofiles []string) (map[string][]byte, error) {
+	copies := make(map[string][]byte)
+	for _, gof := range gofiles {
+		filename := filepath.Join(dir, gof)
+		data, err := imp.fs.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		if abs, err := filepath.Abs(filename); err == nil {
+			filename = abs
+		}
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "//line %s:1\n", filename)
+		buf.Write(data)
+		copies[gof] = buf.Bytes()
+	}
+	return copies, nil
+}
+
 // multiErr is an error value that accumulates type checking errors.
 type multiErr []error
 
@@ -13,7 +13,6 @@ import (
 	"github.com/tdakkota/go2go/golib/parser"
 	"github.com/tdakkota/go2go/golib/token"
 	"github.com/tdakkota/go2go/golib/types"
-	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
@@ -21,22 +20,47 @@ import (
 	"runtime"
 	"sort"
 	"strings"
+	"sync"
 )
 
 // Importer implements the types.ImporterFrom interface.
-// It looks for Go2 packages using GO2PATH.
+// It looks for Go2 packages using GO2PATH, or in the local
+// modules found by FindModule.
 // Imported Go2 packages are rewritten to normal Go packages.
 // This type also tracks references across imported packages.
 type Importer struct {
 	// Temporary directory used to rewrite packages.
 	tmpdir string
 
+	// File system holding the sources of packages.
+	fs FileSystem
+
+	// Map from file name to contents of the translated files, if
+	// they are kept in memory rather than written; see NewImporterFS.
+	mem map[string][]byte
+
 	// Aggregated info from go/types.
-	info *types.Info
+	info *sharedInfo
+
+	// mu protects the maps below, so that packages may be
+	// translated concurrently; see RewriteAll.
+	mu sync.Mutex
 
 	// Map from import path to directory holding rewritten files.
 	translated map[string]string
 
+	// Map from import path to a channel that is closed when the
+	// translation of the package finishes, for packages that are
+	// being translated.
+	translating map[string]chan struct{}
+
+	// Map from import path to the error translating the package.
+	importErrs map[string]error
+
+	// Map from a package being translated to the package whose
+	// translation it is waiting for.
+	waitsFor map[string]string
+
 	// Map from import path to package information.
 	packages map[string]*types.Package
 
@@ -49,28 +73,199 @@ type Importer struct {
 
 	// Map from Object to AST type definition for parameterized types.
 	idToTypeSpec map[types.Object]*ast.TypeSpec
+
+	// Map from AST type definition to the position of its type
+	// keyword, for type definitions that are not in a group.
+	typeSpecTok map[*ast.TypeSpec]token.Pos
+
+	// Map from Object of a parameterized function to the
+	// instantiations written in translated imported packages.
+	instantiations map[types.Object][]*instantiation
+
+	// Map from parameterized type to the instantiations
+	// written in translated imported packages.
+	typeInstantiations map[types.Type][]*typeInstantiation
+
+	// Modules whose packages are found in local directories,
+	// set by FindModule. If not nil, imported packages are
+	// translated into tmpdir/overlay rather than tmpdir/src.
+	modules []*module
+
+	// Map from source file name to translated file name for
+	// packages translated in module mode.
+	overlay map[string]string
+
+	// Map from file name to the dictionary directives in the file.
+	directives map[string]*fileDirectives
+
+	// Map from generic function to whether it is translated using
+	// a dictionary because of its own directive, rather than a
+	// directive for its package.
+	dictDecls map[*ast.FuncDecl]bool
+
+	// Map from generic function to its dictionary translation.
+	dictFuncs map[*ast.FuncDecl]*dictFunc
+
+	// Directory caching translated imported packages, set by
+	// SetCacheDir. If empty, nothing is cached.
+	cacheDir string
+
+	// Map from import path to the cache key of the translation
+	// of an imported package.
+	cacheKeys map[string]string
+
+	// How instantiations are named, set by SetNaming.
+	naming Naming
+
+	// Map from translated package to the instantiations that it uses.
+	requests map[*types.Package][]*request
+
+	// Map from import path to source directory for the imported
+	// Go 1 packages that were type checked from source.
+	go1Dirs map[string]string
+
+	// Build context selecting the source files of packages,
+	// set by SetBuildContext.
+	ctxt build.Context
+
+	// Map from .go2 file name to its // +build lines.
+	constraints map[string][]byte
 }
 
 var _ types.ImporterFrom = &Importer{}
 
-// NewImporter returns a new Importer.
-// The tmpdir will become a GOPATH with translated files.
-func NewImporter(tmpdir string) *Importer {
-	info := &types.Info{
+// newInfo returns a types.Info recording what the translator needs.
+func newInfo() *types.Info {
+	return &types.Info{
 		Types:    make(map[ast.Expr]types.TypeAndValue),
 		Inferred: make(map[*ast.CallExpr]types.Inferred),
 		Defs:     make(map[*ast.Ident]types.Object),
 		Uses:     make(map[*ast.Ident]types.Object),
 	}
-	return &Importer{
+}
+
+// A sharedInfo holds the types.Info of every package type checked
+// for an Importer. It is safe for concurrent use. Each package is
+// type checked with an Info of its own, which is then merged in.
+type sharedInfo struct {
+	mu   sync.RWMutex
+	info *types.Info
+}
+
+// A typeOfer is a types.Info or a sharedInfo.
+type typeOfer interface {
+	TypeOf(ast.Expr) types.Type
+}
+
+// merge adds the information in info.
+func (si *sharedInfo) merge(info *types.Info) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	for k, v := range info.Types {
+		si.info.Types[k] = v
+	}
+	for k, v := range info.Inferred {
+		si.info.Inferred[k] = v
+	}
+	for k, v := range info.Defs {
+		si.info.Defs[k] = v
+	}
+	for k, v := range info.Uses {
+		si.info.Uses[k] = v
+	}
+}
+
+// typeAndValue returns the type and value of e, if known.
+func (si *sharedInfo) typeAndValue(e ast.Expr) (types.TypeAndValue, bool) {
+	si.mu.RLock()
+	defer si.mu.RUnlock()
+	tv, ok := si.info.Types[e]
+	return tv, ok
+}
+
+// def returns the object defined by id, if any.
+func (si *sharedInfo) def(id *ast.Ident) (types.Object, bool) {
+	si.mu.RLock()
+	defer si.mu.RUnlock()
+	obj, ok := si.info.Defs[id]
+	return obj, ok
+}
+
+// use returns the object used by id, if any.
+func (si *sharedInfo) use(id *ast.Ident) (types.Object, bool) {
+	si.mu.RLock()
+	defer si.mu.RUnlock()
+	obj, ok := si.info.Uses[id]
+	return obj, ok
+}
+
+// setUse records that id, created by the translator, uses obj.
+func (si *sharedInfo) setUse(id *ast.Ident, obj types.Object) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	si.info.Uses[id] = obj
+}
+
+// inferred returns the inferred type arguments of call, if any.
+func (si *sharedInfo) inferred(call *ast.CallExpr) (types.Inferred, bool) {
+	si.mu.RLock()
+	defer si.mu.RUnlock()
+	inf, ok := si.info.Inferred[call]
+	return inf, ok
+}
+
+// setInferred records inferred type arguments for call,
+// created by the translator.
+func (si *sharedInfo) setInferred(call *ast.CallExpr, inf types.Inferred) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	si.info.Inferred[call] = inf
+}
+
+// TypeOf is like types.Info.TypeOf.
+func (si *sharedInfo) TypeOf(e ast.Expr) types.Type {
+	si.mu.RLock()
+	defer si.mu.RUnlock()
+	return si.info.TypeOf(e)
+}
+
+// ObjectOf is like types.Info.ObjectOf.
+func (si *sharedInfo) ObjectOf(id *ast.Ident) types.Object {
+	si.mu.RLock()
+	defer si.mu.RUnlock()
+	return si.info.ObjectOf(id)
+}
+
+// NewImporter returns a new Importer.
+// The tmpdir will become a GOPATH with translated files.
+func NewImporter(tmpdir string) *Importer {
+	imp := &Importer{
 		tmpdir:       tmpdir,
-		info:         info,
+		fs:           OSFS,
+		info:         &sharedInfo{info: newInfo()},
 		translated:   make(map[string]string),
+		translating:  make(map[string]chan struct{}),
+		importErrs:   make(map[string]error),
+		waitsFor:     make(map[string]string),
 		packages:     make(map[string]*types.Package),
 		imports:      make(map[string][]string),
 		idToFunc:     make(map[types.Object]*ast.FuncDecl),
 		idToTypeSpec: make(map[types.Object]*ast.TypeSpec),
-	}
+		typeSpecTok:  make(map[*ast.TypeSpec]token.Pos),
+
+		instantiations:     make(map[types.Object][]*instantiation),
+		typeInstantiations: make(map[types.Type][]*typeInstantiation),
+		overlay:            make(map[string]string),
+		directives:         make(map[string]*fileDirectives),
+		dictDecls:          make(map[*ast.FuncDecl]bool),
+		dictFuncs:          make(map[*ast.FuncDecl]*dictFunc),
+		cacheKeys:          make(map[string]string),
+		requests:           make(map[*types.Package][]*request),
+		go1Dirs:            make(map[string]string),
+		constraints:        make(map[string][]byte),
+	}
+	imp.SetBuildContext(build.Default)
+	return imp
 }
 
 // defaultImporter is the default Go 1 Importer.
@@ -87,83 +282,157 @@ func (imp *Importer) Import(path string) (*types.Package, error) {
 // ImportFrom looks for a Go2 package, and if not found tries the
 // default importer.
 func (imp *Importer) ImportFrom(importPath, dir string, mode types.ImportMode) (*types.Package, error) {
+	return imp.importFrom(importPath, dir, mode, nil)
+}
+
+// A stackImporter imports packages for the type checking of the
+// package at the top of an import stack. The stack lets the Importer
+// tell an import cycle from a package being translated concurrently.
+type stackImporter struct {
+	imp   *Importer
+	stack []string
+}
+
+var _ types.ImporterFrom = &stackImporter{}
+
+// forStack returns an importer for the type checking of the
+// package key, imported by the packages in stack.
+func (imp *Importer) forStack(stack []string, key string) *stackImporter {
+	return &stackImporter{
+		imp:   imp,
+		stack: append(stack[:len(stack):len(stack)], key),
+	}
+}
+
+// Import implements types.Importer.
+func (si *stackImporter) Import(path string) (*types.Package, error) {
+	return si.imp.Import(path)
+}
+
+// ImportFrom implements types.ImporterFrom.
+func (si *stackImporter) ImportFrom(importPath, dir string, mode types.ImportMode) (*types.Package, error) {
+	return si.imp.importFrom(importPath, dir, mode, si.stack)
+}
+
+// importFrom imports a package for the packages in stack.
+// If another goroutine is translating the package, importFrom
+// waits for it to finish, unless that would wait for a package
+// in the stack, which is an import cycle.
+func (imp *Importer) importFrom(importPath, dir string, mode types.ImportMode, stack []string) (*types.Package, error) {
 	if build.IsLocalImport(importPath) {
 		return imp.localImport(importPath, dir)
 	}
 
-	if imp.translated[importPath] != "" {
-		tpkg, ok := imp.packages[importPath]
-		if !ok {
+	imp.mu.Lock()
+	for imp.translated[importPath] != "" {
+		if tpkg, ok := imp.packages[importPath]; ok {
+			imp.mu.Unlock()
+			return tpkg, nil
+		}
+		if err, ok := imp.importErrs[importPath]; ok {
+			imp.mu.Unlock()
+			return nil, err
+		}
+		done := imp.translating[importPath]
+		if done == nil || imp.waitsForStack(importPath, stack) {
+			imp.mu.Unlock()
 			return nil, fmt.Errorf("circular import when processing %q", importPath)
 		}
-		return tpkg, nil
+		var waiter string
+		if len(stack) > 0 {
+			waiter = stack[len(stack)-1]
+			imp.waitsFor[waiter] = importPath
+		}
+		imp.mu.Unlock()
+		<-done
+		imp.mu.Lock()
+		delete(imp.waitsFor, waiter)
 	}
+	imp.mu.Unlock()
 
-	var pdir string
-	if go2path := os.Getenv("GO2PATH"); go2path != "" {
-		pdir = imp.findFromPath(go2path, importPath)
+	pdir, err := imp.findPackageDir(importPath, dir)
+	if err != nil {
+		return nil, err
 	}
 	if pdir == "" {
-		bpkg, err := build.Import(importPath, dir, build.FindOnly)
-		if err != nil {
-			return nil, err
-		}
-		pdir = bpkg.Dir
+		return defaultImporter.ImportFrom(importPath, dir, mode)
 	}
 
 	// If the directory holds .go2 files, we need to translate them.
-	fdir, err := os.Open(pdir)
+	// Any hand-written .go files are type checked along with them.
+	allGo2files, allGofiles, err := go2Files(imp.fs, pdir)
 	if err != nil {
 		return nil, err
 	}
-	defer fdir.Close()
-	names, err := fdir.Readdirnames(-1)
+	go2files, err := imp.matchFiles(pdir, allGo2files)
 	if err != nil {
 		return nil, err
 	}
-	var gofiles, go2files []string
-	for _, name := range names {
-		switch filepath.Ext(name) {
-		case ".go":
-			gofiles = append(gofiles, name)
-		case ".go2":
-			go2files = append(go2files, name)
-		}
-	}
 
 	if len(go2files) == 0 {
-		return imp.importGo1Package(importPath, dir, mode, pdir, gofiles)
-	}
-
-	if len(gofiles) > 0 {
-		for _, gofile := range gofiles {
-			if err := checkGoFile(pdir, gofile); err != nil {
-				return nil, err
-			}
+		if len(allGo2files) > 0 {
+			return nil, fmt.Errorf("importing %q: build constraints exclude all .go2 files in %s", importPath, pdir)
 		}
-	}
-
-	tdir := filepath.Join(imp.tmpdir, "src", importPath)
-	if err := os.MkdirAll(tdir, 0755); err != nil {
-		return nil, err
-	}
-	for _, name := range go2files {
-		data, err := ioutil.ReadFile(filepath.Join(pdir, name))
+		gofiles, err := imp.matchFiles(pdir, allGofiles)
 		if err != nil {
 			return nil, err
 		}
-		if err := ioutil.WriteFile(filepath.Join(tdir, name), data, 0644); err != nil {
+		return imp.importGo1Package(importPath, dir, mode, pdir, gofiles, stack)
+	}
+
+	// In memory, the translated files are kept next to the sources.
+	tdir := pdir
+	if !imp.inMemory() {
+		tdir = filepath.Join(imp.tmpdir, "src", importPath)
+		if imp.modules != nil {
+			tdir = filepath.Join(imp.tmpdir, "overlay", importPath)
+		}
+		if err := os.MkdirAll(tdir, 0755); err != nil {
 			return nil, err
 		}
 	}
 
+	// Another goroutine may have started translating the
+	// package while we were looking for it.
+	imp.mu.Lock()
+	if imp.translated[importPath] != "" {
+		imp.mu.Unlock()
+		return imp.importFrom(importPath, dir, mode, stack)
+	}
 	imp.translated[importPath] = tdir
+	done := make(chan struct{})
+	imp.translating[importPath] = done
+	imp.mu.Unlock()
+
+	tpkg, err := imp.translate(importPath, pdir, tdir, go2files, stack)
+
+	imp.mu.Lock()
+	if err != nil {
+		imp.importErrs[importPath] = err
+	}
+	delete(imp.translating, importPath)
+	close(done)
+	imp.mu.Unlock()
 
-	tpkgs, err := rewriteToPkgs(imp, importPath, tdir)
+	return tpkg, err
+}
+
+// translate translates the .go2 files of the package importPath
+// in pdir into tdir, and returns the imported package.
+func (imp *Importer) translate(importPath, pdir, tdir string, go2files, stack []string) (*types.Package, error) {
+	// Parse the .go2 files where they are, so that the //line
+	// directives in the translated files refer to the sources.
+	tpkgs, err := rewriteFilesInPath(imp, stack, importPath, pdir, tdir, go2files)
 	if err != nil {
 		return nil, err
 	}
 
+	if imp.modules != nil && !imp.inMemory() {
+		if err := imp.addOverlay(pdir, tdir); err != nil {
+			return nil, err
+		}
+	}
+
 	switch len(tpkgs) {
 	case 1:
 		return tpkgs[0], nil
@@ -178,6 +447,47 @@ func (imp *Importer) ImportFrom(importPath, dir string, mode types.ImportMode) (
 	return nil, fmt.Errorf("unexpected number of packages (%d) for %q (directory %q)", len(tpkgs), importPath, pdir)
 }
 
+// waitsForStack reports whether waiting for the translation of
+// importPath would wait, directly or through the packages that it
+// is waiting for, for one of the packages in stack.
+func (imp *Importer) waitsForStack(importPath string, stack []string) bool {
+	seen := make(map[string]bool)
+	for p := importPath; p != "" && !seen[p]; p = imp.waitsFor[p] {
+		seen[p] = true
+		for _, s := range stack {
+			if s == p {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findPackageDir returns the source directory of the package
+// importPath, imported from dir. An Importer that keeps translations
+// in memory only finds packages in modules and in GO2PATH; for other
+// packages findPackageDir returns the empty string.
+func (imp *Importer) findPackageDir(importPath, dir string) (string, error) {
+	if imp.modules != nil {
+		if pdir := imp.ModuleDir(importPath); pdir != "" {
+			return pdir, nil
+		}
+	}
+	if go2path := os.Getenv("GO2PATH"); go2path != "" {
+		if pdir := imp.findFromPath(go2path, importPath); pdir != "" {
+			return pdir, nil
+		}
+	}
+	if imp.inMemory() {
+		return "", nil
+	}
+	bpkg, err := build.Import(importPath, dir, build.FindOnly)
+	if err != nil {
+		return "", err
+	}
+	return bpkg.Dir, nil
+}
+
 // findFromPath looks for a directory under gopath.
 func (imp *Importer) findFromPath(gopath, dir string) string {
 	if filepath.IsAbs(dir) || build.IsLocalImport(dir) {
@@ -185,7 +495,7 @@ func (imp *Importer) findFromPath(gopath, dir string) string {
 	}
 	for _, pd := range strings.Split(gopath, ":") {
 		d := filepath.Join(pd, "src", dir)
-		if fi, err := os.Stat(d); err == nil && fi.IsDir() {
+		if imp.isDir(d) {
 			return d
 		}
 	}
@@ -198,7 +508,7 @@ func (imp *Importer) findFromPath(gopath, dir string) string {
 // "go install" won't work if the Go 1 package depends on a Go 2 package.
 // So use the default importer for a package in the standard library,
 // and otherwise use go/types.
-func (imp *Importer) importGo1Package(importPath, dir string, mode types.ImportMode, pdir string, gofiles []string) (*types.Package, error) {
+func (imp *Importer) importGo1Package(importPath, dir string, mode types.ImportMode, pdir string, gofiles, stack []string) (*types.Package, error) {
 	if goroot.IsStandardPackage(runtime.GOROOT(), "gc", importPath) {
 		return defaultImporter.ImportFrom(importPath, dir, mode)
 	}
@@ -207,40 +517,45 @@ func (imp *Importer) importGo1Package(importPath, dir string, mode types.ImportM
 		return nil, fmt.Errorf("importing %q: no Go files in %s", importPath, pdir)
 	}
 
+	sort.Strings(gofiles)
 	fset := token.NewFileSet()
-	filter := func(fi os.FileInfo) bool {
-		return !strings.HasSuffix(fi.Name(), "_test.go")
-	}
-	pkgs, err := parser.ParseDir(fset, pdir, filter, 0)
-	if err != nil {
-		return nil, err
-	}
-	if len(pkgs) > 1 {
-		return nil, fmt.Errorf("importing %q: multiple Go packages in %s", importPath, pdir)
-	}
-
-	var apkg *ast.Package
-	for _, apkg = range pkgs {
-		break
-	}
-
 	var asts []*ast.File
-	for _, f := range apkg.Files {
-		asts = append(asts, f)
+	for _, name := range gofiles {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		filename := filepath.Join(pdir, name)
+		src, err := imp.fs.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		pf, err := parser.ParseFile(fset, filename, src, 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(asts) > 0 && pf.Name.Name != asts[0].Name.Name {
+			return nil, fmt.Errorf("importing %q: multiple Go packages in %s", importPath, pdir)
+		}
+		asts = append(asts, pf)
+	}
+	if len(asts) == 0 {
+		return nil, fmt.Errorf("importing %q: no Go files in %s", importPath, pdir)
 	}
-	sort.Slice(asts, func(i, j int) bool {
-		return asts[i].Name.Name < asts[j].Name.Name
-	})
 
 	var merr multiErr
 	conf := types.Config{
-		Importer: imp,
+		Importer: imp.forStack(stack, importPath),
 		Error:    merr.add,
 	}
-	tpkg, err := conf.Check(apkg.Name, fset, asts, imp.info)
+	info := newInfo()
+	tpkg, err := conf.Check(asts[0].Name.Name, fset, asts, info)
 	if err != nil {
 		return nil, merr
 	}
+	imp.info.merge(info)
+	imp.mu.Lock()
+	imp.go1Dirs[importPath] = pdir
+	imp.mu.Unlock()
 
 	return tpkg, nil
 }
@@ -259,6 +574,8 @@ func (imp *Importer) installGo1Package(dir string) {
 // Register registers a package under an import path.
 // This is for tests that use directives like //compiledir.
 func (imp *Importer) Register(importPath string, tpkgs []*types.Package) error {
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
 	switch len(tpkgs) {
 	case 1:
 		imp.packages[importPath] = tpkgs[0]
@@ -279,7 +596,7 @@ func (imp *Importer) Register(importPath string, tpkgs []*types.Package) error {
 //     import "./a"
 // This is for tests that use directives like //compiledir.
 func (imp *Importer) localImport(importPath, dir string) (*types.Package, error) {
-	tpkg, ok := imp.packages[strings.TrimPrefix(importPath, "./")]
+	tpkg, ok := imp.lookupPackage(importPath)
 	if !ok {
 		return nil, fmt.Errorf("cannot find local import %q", importPath)
 	}
@@ -289,10 +606,13 @@ func (imp *Importer) localImport(importPath, dir string) (*types.Package, error)
 // record records information for a package, for use when working
 // with packages that import this one.
 func (imp *Importer) record(pkgfiles []namedAST, importPath string, tpkg *types.Package, asts []*ast.File) {
+	imports := imp.collectImports(asts)
+	imp.mu.Lock()
 	if importPath != "" {
 		imp.packages[importPath] = tpkg
 	}
-	imp.imports[importPath] = imp.collectImports(asts)
+	imp.imports[importPath] = imports
+	imp.mu.Unlock()
 	for _, nast := range pkgfiles {
 		imp.addIDs(nast.ast)
 	}
@@ -328,11 +648,13 @@ func (imp *Importer) collectImports(asts []*ast.File) []string {
 
 // addIDs finds IDs for generic functions and types and adds them to a map.
 func (imp *Importer) addIDs(f *ast.File) {
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
 	for _, decl := range f.Decls {
 		switch decl := decl.(type) {
 		case *ast.FuncDecl:
 			if isParameterizedFuncDecl(decl, imp.info) {
-				obj, ok := imp.info.Defs[decl.Name]
+				obj, ok := imp.info.def(decl.Name)
 				if !ok {
 					panic(fmt.Sprintf("no types.Object for %q", decl.Name.Name))
 				}
@@ -342,11 +664,14 @@ func (imp *Importer) addIDs(f *ast.File) {
 			if decl.Tok == token.TYPE {
 				for _, s := range decl.Specs {
 					ts := s.(*ast.TypeSpec)
-					obj, ok := imp.info.Defs[ts.Name]
+					obj, ok := imp.info.def(ts.Name)
 					if !ok {
 						panic(fmt.Sprintf("no types.Object for %q", ts.Name.Name))
 					}
 					imp.idToTypeSpec[obj] = ts
+					if !decl.Lparen.IsValid() {
+						imp.typeSpecTok[ts] = decl.TokPos
+					}
 				}
 			}
 		}
@@ -355,24 +680,75 @@ func (imp *Importer) addIDs(f *ast.File) {
 
 // lookupPackage looks up a package by path.
 func (imp *Importer) lookupPackage(path string) (*types.Package, bool) {
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
 	pkg, ok := imp.packages[strings.TrimPrefix(path, "./")]
 	return pkg, ok
 }
 
 // lookupFunc looks up a function by Object.
 func (imp *Importer) lookupFunc(obj types.Object) (*ast.FuncDecl, bool) {
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
 	decl, ok := imp.idToFunc[obj]
 	return decl, ok
 }
 
 // lookupTypeSpec looks up a type by Object.
 func (imp *Importer) lookupTypeSpec(obj types.Object) (*ast.TypeSpec, bool) {
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
 	ts, ok := imp.idToTypeSpec[obj]
 	return ts, ok
 }
 
+// addInstantiation records an instantiation of the function obj,
+// so that packages that import the instantiating package can use it.
+func (imp *Importer) addInstantiation(obj types.Object, inst *instantiation) {
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
+	imp.instantiations[obj] = append(imp.instantiations[obj], inst)
+}
+
+// lookupInstantiations returns the recorded instantiations of the
+// function obj.
+func (imp *Importer) lookupInstantiations(obj types.Object) []*instantiation {
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
+	return append([]*instantiation(nil), imp.instantiations[obj]...)
+}
+
+// addTypeInstantiation records an instantiation of the type typ,
+// so that packages that import the instantiating package can use it.
+func (imp *Importer) addTypeInstantiation(typ types.Type, inst *typeInstantiation) {
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
+	imp.typeInstantiations[typ] = append(imp.typeInstantiations[typ], inst)
+}
+
+// lookupTypeInstantiations returns the recorded instantiations of
+// the type typ.
+func (imp *Importer) lookupTypeInstantiations(typ types.Type) []*typeInstantiation {
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
+	return append([]*typeInstantiation(nil), imp.typeInstantiations[typ]...)
+}
+
+// typeSpecPos returns the position to use for the type keyword
+// of a copy of the type definition ts.
+func (imp *Importer) typeSpecPos(ts *ast.TypeSpec) token.Pos {
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
+	if pos, ok := imp.typeSpecTok[ts]; ok {
+		return pos
+	}
+	return ts.Name.NamePos
+}
+
 // transitiveImports returns all the transitive imports of an import path.
 func (imp *Importer) transitiveImports(path string) []string {
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
 	return imp.gatherTransitiveImports(path, make(map[string]bool))
 }
 
@@ -5,7 +5,6 @@
 package go2go
 
 import (
-	"fmt"
 	"github.com/tdakkota/go2go/golib/ast"
 	"github.com/tdakkota/go2go/golib/token"
 	"github.com/tdakkota/go2go/golib/types"
@@ -18,6 +17,10 @@ type typeArgs struct {
 	types []types.Type // type arguments in order
 	toAST map[types.Object]ast.Expr
 	toTyp map[*types.TypeParam]types.Type
+
+	// dict is set when translating a generic function into
+	// a shared function that uses a dictionary.
+	dict *dictFunc
 }
 
 // newTypeArgs returns a new typeArgs value.
@@ -29,46 +32,52 @@ func newTypeArgs(typeTypes []types.Type) *typeArgs {
 	}
 }
 
-// typeArgsFromTParams builds mappings from a list of type parameters
-// expressed as ast.Field values.
-func typeArgsFromFields(t *translator, astTypes []ast.Expr, typeTypes []types.Type, tparams []*ast.Field) *typeArgs {
+// typeArgsFromFields builds mappings from a list of type parameters
+// expressed as ast.Field values. It returns an error, and no mappings,
+// if any type parameter cannot be resolved.
+func typeArgsFromFields(t *translator, astTypes []ast.Expr, typeTypes []types.Type, tparams []*ast.Field) (*typeArgs, error) {
 	ta := newTypeArgs(typeTypes)
 	i := 0
 	for _, tf := range tparams {
 		for _, tn := range tf.Names {
-			obj, ok := t.importer.info.Defs[tn]
+			obj, ok := t.importer.info.def(tn)
 			if !ok {
-				panic(fmt.Sprintf("no object for type parameter %q", tn))
+				return nil, t.newError(tn.Pos(), Internal, "no object for type parameter %q", tn)
 			}
 			objType := obj.Type()
 			objParam, ok := objType.(*types.TypeParam)
 			if !ok {
-				panic(fmt.Sprintf("%v is not a TypeParam", objParam))
+				return nil, t.newError(tn.Pos(), Internal, "%v is not a TypeParam", objType)
 			}
 			ta.add(obj, objParam, astTypes[i], typeTypes[i])
 			i++
 		}
 	}
-	return ta
+	return ta, nil
 }
 
-// typeArgsFromTParams builds mappings from a list of type parameters
-// expressed as ast.Expr values.
-func typeArgsFromExprs(t *translator, astTypes []ast.Expr, typeTypes []types.Type, tparams []ast.Expr) *typeArgs {
+// typeArgsFromExprs builds mappings from a list of type parameters
+// expressed as ast.Expr values. It returns an error, and no mappings,
+// if any type parameter cannot be resolved.
+func typeArgsFromExprs(t *translator, astTypes []ast.Expr, typeTypes []types.Type, tparams []ast.Expr) (*typeArgs, error) {
 	ta := newTypeArgs(typeTypes)
 	for i, ti := range tparams {
-		obj, ok := t.importer.info.Defs[ti.(*ast.Ident)]
+		id, ok := ti.(*ast.Ident)
+		if !ok {
+			return nil, t.newError(ti.Pos(), Unsupported, "type parameter %v is not an identifier", ti)
+		}
+		obj, ok := t.importer.info.def(id)
 		if !ok {
-			panic(fmt.Sprintf("no object for type parameter %q", ti))
+			return nil, t.newError(ti.Pos(), Internal, "no object for type parameter %q", ti)
 		}
 		objType := obj.Type()
 		objParam, ok := objType.(*types.TypeParam)
 		if !ok {
-			panic(fmt.Sprintf("%v is not a TypeParam", objParam))
+			return nil, t.newError(ti.Pos(), Internal, "%v is not a TypeParam", objType)
 		}
 		ta.add(obj, objParam, astTypes[i], typeTypes[i])
 	}
-	return ta
+	return ta, nil
 }
 
 // add adds mappings for obj to ast and typ.
@@ -100,10 +109,22 @@ func (t *translator) instantiateFunction(qid qualifiedIdent, astTypes []ast.Expr
 	if err != nil {
 		return nil, err
 	}
+	if decl.Body == nil {
+		return nil, t.newError(qid.ident.Pos(), Unsupported, "cannot instantiate %q, which has no body", qid)
+	}
+	if df := t.importer.useDictionary(decl); df != nil {
+		return t.instantiateDictionaryFunction(qid, df, name, astTypes, typeTypes)
+	}
 
-	ta := typeArgsFromFields(t, astTypes, typeTypes, decl.Type.TParams.List)
+	ta, err := typeArgsFromFields(t, astTypes, typeTypes, decl.Type.TParams.List)
+	if err != nil {
+		return nil, err
+	}
 
-	instIdent := ast.NewIdent(name)
+	// The instantiated declaration keeps the positions of the
+	// generic declaration, so that the //line directives written
+	// for it refer back to the generic source.
+	instIdent := &ast.Ident{NamePos: decl.Name.NamePos, Name: name}
 
 	newDecl := &ast.FuncDecl{
 		Doc:  decl.Doc,
@@ -121,11 +142,11 @@ func (t *translator) instantiateFunction(qid qualifiedIdent, astTypes []ast.Expr
 func (t *translator) findFuncDecl(qid qualifiedIdent) (*ast.FuncDecl, error) {
 	obj := t.findTypesObject(qid)
 	if obj == nil {
-		return nil, fmt.Errorf("could not find Object for %q", qid)
+		return nil, t.newError(qid.ident.Pos(), Instantiation, "could not find Object for %q", qid)
 	}
 	decl, ok := t.importer.lookupFunc(obj)
 	if !ok {
-		return nil, fmt.Errorf("could not find function body for %q", qid)
+		return nil, t.newError(qid.ident.Pos(), Instantiation, "could not find function body for %q", qid)
 	}
 	return decl, nil
 }
@@ -134,7 +155,8 @@ func (t *translator) findFuncDecl(qid qualifiedIdent) (*ast.FuncDecl, error) {
 // It returns nil if the ID is not found.
 func (t *translator) findTypesObject(qid qualifiedIdent) types.Object {
 	if qid.pkg == nil {
-		return t.importer.info.Uses[qid.ident]
+		obj, _ := t.importer.info.use(qid.ident)
+		return obj
 	} else {
 		return qid.pkg.Scope().Lookup(qid.ident.Name)
 	}
@@ -152,9 +174,12 @@ func (t *translator) instantiateTypeDecl(qid qualifiedIdent, typ *types.Named, a
 		return nil, nil, err
 	}
 
-	ta := typeArgsFromFields(t, astTypes, typeTypes, spec.TParams.List)
+	ta, err := typeArgsFromFields(t, astTypes, typeTypes, spec.TParams.List)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	instIdent := ast.NewIdent(name)
+	instIdent := &ast.Ident{NamePos: spec.Name.NamePos, Name: name}
 
 	newSpec := &ast.TypeSpec{
 		Doc:     spec.Doc,
@@ -164,8 +189,9 @@ func (t *translator) instantiateTypeDecl(qid qualifiedIdent, typ *types.Named, a
 		Comment: spec.Comment,
 	}
 	newDecl := &ast.GenDecl{
-		Tok:   token.TYPE,
-		Specs: []ast.Spec{newSpec},
+		TokPos: t.importer.typeSpecPos(spec),
+		Tok:    token.TYPE,
+		Specs:  []ast.Spec{newSpec},
 	}
 	t.newDecls = append(t.newDecls, newDecl)
 
@@ -178,18 +204,24 @@ func (t *translator) instantiateTypeDecl(qid qualifiedIdent, typ *types.Named, a
 		method := typ.Method(i)
 		mast, ok := t.importer.lookupFunc(method)
 		if !ok {
-			panic(fmt.Sprintf("no AST for method %v", method))
+			t.errorf(method.Pos(), Instantiation, "no AST for method %v", method)
+			continue
 		}
 		rtyp := mast.Recv.List[0].Type
-		newRtype := ast.Expr(ast.NewIdent(name))
+		newRtype := ast.Expr(&ast.Ident{NamePos: rtyp.Pos(), Name: name})
 		if p, ok := rtyp.(*ast.StarExpr); ok {
 			rtyp = p.X
 			newRtype = &ast.StarExpr{
-				X: newRtype,
+				Star: p.Star,
+				X:    &ast.Ident{NamePos: p.X.Pos(), Name: name},
 			}
 		}
 		tparams := rtyp.(*ast.CallExpr).Args
-		ta := typeArgsFromExprs(t, astTypes, typeTypes, tparams)
+		ta, err := typeArgsFromExprs(t, astTypes, typeTypes, tparams)
+		if err != nil {
+			t.addError(mast.Pos(), Instantiation, err)
+			continue
+		}
 		newDecl := &ast.FuncDecl{
 			Doc: mast.Doc,
 			Recv: &ast.FieldList{
@@ -220,11 +252,11 @@ func (t *translator) instantiateTypeDecl(qid qualifiedIdent, typ *types.Named, a
 func (t *translator) findTypeSpec(qid qualifiedIdent) (*ast.TypeSpec, error) {
 	obj := t.findTypesObject(qid)
 	if obj == nil {
-		return nil, fmt.Errorf("could not find Object for %q", qid)
+		return nil, t.newError(qid.ident.Pos(), Instantiation, "could not find Object for %q", qid)
 	}
 	spec, ok := t.importer.lookupTypeSpec(obj)
 	if !ok {
-		return nil, fmt.Errorf("could not find type spec for %q", qid)
+		return nil, t.newError(qid.ident.Pos(), Instantiation, "could not find type spec for %q", qid)
 	}
 	return spec, nil
 }
@@ -259,7 +291,8 @@ func (t *translator) instantiateDecl(ta *typeArgs, d ast.Decl) ast.Decl {
 			Rparen: d.Rparen,
 		}
 	default:
-		panic(fmt.Sprintf("unimplemented Decl %T", d))
+		t.errorf(d.Pos(), Unsupported, "unimplemented Decl %T", d)
+		return d
 	}
 }
 
@@ -271,6 +304,9 @@ func (t *translator) instantiateSpec(ta *typeArgs, s ast.Spec) ast.Spec {
 	case *ast.ValueSpec:
 		typ := t.instantiateExpr(ta, s.Type)
 		values, changed := t.instantiateExprList(ta, s.Values)
+		if zero := t.dictZero(ta, s); zero != nil {
+			values, changed = zero, true
+		}
 		if typ == s.Type && !changed {
 			return s
 		}
@@ -282,7 +318,8 @@ func (t *translator) instantiateSpec(ta *typeArgs, s ast.Spec) ast.Spec {
 			Comment: s.Comment,
 		}
 	default:
-		panic(fmt.Sprintf("unimplemented Spec %T", s))
+		t.errorf(s.Pos(), Unsupported, "unimplemented Spec %T", s)
+		return s
 	}
 }
 
@@ -341,6 +378,9 @@ func (t *translator) instantiateStmt(ta *typeArgs, s ast.Stmt) ast.Stmt {
 			Tok:    s.Tok,
 		}
 	case *ast.AssignStmt:
+		if ds := t.dictAssign(ta, s); ds != nil {
+			return ds
+		}
 		lhs, lchanged := t.instantiateExprList(ta, s.Lhs)
 		rhs, rchanged := t.instantiateExprList(ta, s.Rhs)
 		if !lchanged && !rchanged {
@@ -490,7 +530,8 @@ func (t *translator) instantiateStmt(ta *typeArgs, s ast.Stmt) ast.Stmt {
 			Body:   body,
 		}
 	default:
-		panic(fmt.Sprintf("unimplemented Stmt %T", s))
+		t.errorf(s.Pos(), Unsupported, "unimplemented Stmt %T", s)
+		return s
 	}
 }
 
@@ -581,7 +622,7 @@ func (t *translator) instantiateExpr(ta *typeArgs, e ast.Expr) ast.Expr {
 		obj := t.importer.info.ObjectOf(e)
 		if obj != nil {
 			if typ, ok := ta.ast(obj); ok {
-				return typ
+				return t.reposition(typ, e.NamePos)
 			}
 		}
 		return e
@@ -680,9 +721,13 @@ func (t *translator) instantiateExpr(ta *typeArgs, e ast.Expr) ast.Expr {
 			Rparen: e.Rparen,
 		}
 	case *ast.CallExpr:
+		if call := t.dictMethodCall(ta, e); call != nil {
+			r = call
+			break
+		}
 		fun := t.instantiateExpr(ta, e.Fun)
 		args, argsChanged := t.instantiateExprList(ta, e.Args)
-		origInferred, haveInferred := t.importer.info.Inferred[e]
+		origInferred, haveInferred := t.importer.info.inferred(e)
 		var newInferred types.Inferred
 		inferredChanged := false
 		if haveInferred {
@@ -709,7 +754,7 @@ func (t *translator) instantiateExpr(ta *typeArgs, e ast.Expr) ast.Expr {
 			Rparen:   e.Rparen,
 		}
 		if haveInferred {
-			t.importer.info.Inferred[newCall] = newInferred
+			t.importer.info.setInferred(newCall, newInferred)
 		}
 		r = newCall
 	case *ast.StarExpr:
@@ -723,6 +768,10 @@ func (t *translator) instantiateExpr(ta *typeArgs, e ast.Expr) ast.Expr {
 		}
 	case *ast.UnaryExpr:
 		x := t.instantiateExpr(ta, e.X)
+		if call := t.dictOperation(ta, e.OpPos, e.Op, e.X, x); call != nil {
+			r = call
+			break
+		}
 		if x == e.X {
 			return e
 		}
@@ -734,6 +783,10 @@ func (t *translator) instantiateExpr(ta *typeArgs, e ast.Expr) ast.Expr {
 	case *ast.BinaryExpr:
 		x := t.instantiateExpr(ta, e.X)
 		y := t.instantiateExpr(ta, e.Y)
+		if call := t.dictOperation(ta, e.OpPos, e.Op, e.X, x, y); call != nil {
+			r = call
+			break
+		}
 		if x == e.X && y == e.Y {
 			return e
 		}
@@ -822,7 +875,8 @@ func (t *translator) instantiateExpr(ta *typeArgs, e ast.Expr) ast.Expr {
 			Value: value,
 		}
 	default:
-		panic(fmt.Sprintf("unimplemented Expr %T", e))
+		t.errorf(e.Pos(), Unsupported, "unimplemented Expr %T", e)
+		return e
 	}
 
 	if et := t.lookupType(e); et != nil {
@@ -832,6 +886,25 @@ func (t *translator) instantiateExpr(ta *typeArgs, e ast.Expr) ast.Expr {
 	return r
 }
 
+// reposition returns a type argument expression to use at pos.
+// A simple identifier is copied, so that it does not carry the
+// position of the instantiation into the generic code.
+// Other expressions are returned unchanged.
+func (t *translator) reposition(e ast.Expr, pos token.Pos) ast.Expr {
+	id, ok := e.(*ast.Ident)
+	if !ok || !pos.IsValid() {
+		return e
+	}
+	nid := &ast.Ident{NamePos: pos, Name: id.Name, Obj: id.Obj}
+	if typ := t.lookupType(id); typ != nil {
+		t.setType(nid, typ)
+	}
+	if obj, ok := t.importer.info.use(id); ok {
+		t.importer.info.setUse(nid, obj)
+	}
+	return nid
+}
+
 // instantiateExprList instantiates an expression list.
 func (t *translator) instantiateExprList(ta *typeArgs, el []ast.Expr) ([]ast.Expr, bool) {
 	nel := make([]ast.Expr, len(el))
@@ -0,0 +1,345 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package go2go
+
+import (
+	"fmt"
+	"github.com/tdakkota/go2go/golib/build"
+	"github.com/tdakkota/go2go/golib/parser"
+	"github.com/tdakkota/go2go/golib/token"
+	"github.com/tdakkota/go2go/golib/types"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A PackageInfo describes a .go2 package, as reported by List.
+// It is modelled on the output of go list -json.
+type PackageInfo struct {
+	Dir        string // directory holding the package sources
+	ImportPath string // import path of the package in Dir
+	Name       string // package name
+
+	Go2Files      []string `json:",omitempty"` // .go2 source files, excluding test files
+	TestGo2Files  []string `json:",omitempty"` // _test.go2 files of the package
+	XTestGo2Files []string `json:",omitempty"` // _test.go2 files of the external test package
+	Go1Files      []string `json:",omitempty"` // hand-written .go files, including test files
+	GoFiles       []string `json:",omitempty"` // .go files that translating the package writes
+	NamesFile     string   `json:",omitempty"` // names file that translating the package writes
+
+	Imports     []string `json:",omitempty"` // import paths used by the non-test files
+	Go2Imports  []string `json:",omitempty"` // the Imports that have .go2 files
+	Go1Imports  []string `json:",omitempty"` // the other Imports
+	TestImports []string `json:",omitempty"` // import paths used by the test files
+
+	Generics []*Generic `json:",omitempty"` // exported generic functions, types and contracts
+
+	Instantiations     []*Instance `json:",omitempty"` // instantiations used by the non-test files
+	TestInstantiations []*Instance `json:",omitempty"` // further instantiations used by the tests
+}
+
+// A Generic is an exported generic function or type, or a contract.
+type Generic struct {
+	Name       string
+	Kind       string   // "func", "type" or "contract"
+	TypeParams []string // names of the type parameters
+}
+
+// An Instance is an instantiation of a generic function or type
+// used by a package, whether the package translates it itself or uses
+// the one translated in a package that it imports.
+type Instance struct {
+	Package        string   // import path of the package declaring the generic object
+	Name           string   // name of the generic function or type
+	Kind           string   // "func" or "type"
+	TypeArgs       []string // type arguments, qualified by import path
+	InstantiatedIn string   // import path of the package holding the instantiation
+}
+
+// A request is an instantiation used by a translated package.
+type request struct {
+	obj   types.Object // generic function, or type name of a generic type
+	types []types.Type
+	pkg   *types.Package // package that holds the instantiation
+	test  bool           // whether the instantiation was first used by a test file
+}
+
+// addRequest records that the translated file uses the instantiation
+// of obj with typeList held in pkg.
+func (t *translator) addRequest(obj types.Object, typeList []types.Type, pkg *types.Package) {
+	origin := instantiationOrigin(obj.Pkg(), obj.Name(), typeList)
+	if t.requested[origin] {
+		return
+	}
+	t.requested[origin] = true
+	t.requests = append(t.requests, &request{obj: obj, types: typeList, pkg: pkg, test: t.test})
+}
+
+// addRequests records the instantiations used by the translated
+// package tpkg.
+func (imp *Importer) addRequests(tpkg *types.Package, requests []*request) {
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
+	imp.requests[tpkg] = requests
+}
+
+// List describes the .go2 package in the directory dir, including
+// the instantiations that it uses. The package, and the .go2 packages
+// that it imports, are translated to find them, so the Importer must
+// be one returned by NewImporterFS: nothing is written to the disk.
+// If the code cannot be translated, the error is an ErrorList
+// describing every problem that was found.
+func List(importer *Importer, dir string) (*PackageInfo, error) {
+	if !importer.inMemory() {
+		return nil, fmt.Errorf("List: Importer not created by NewImporterFS")
+	}
+	go2files, gofiles, err := importer.PackageFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(go2files) == 0 {
+		return nil, fmt.Errorf("no .go2 files in %s", dir)
+	}
+
+	info := &PackageInfo{
+		Dir:        dir,
+		ImportPath: importer.dirImportPath(dir),
+	}
+
+	// Only the package clauses and imports are needed
+	// to sort the files.
+	fset := token.NewFileSet()
+	imports := make(map[string]bool)
+	testImports := make(map[string]bool)
+	for _, name := range append(go2files, gofiles...) {
+		filename := filepath.Join(dir, name)
+		src, err := importer.fs.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		pf, err := parser.ParseFile(fset, filename, src, parser.ImportsOnly)
+		if err != nil {
+			return nil, err
+		}
+		m := imports
+		test := strings.HasSuffix(strings.TrimSuffix(name, filepath.Ext(name)), "_test")
+		switch {
+		case filepath.Ext(name) == ".go":
+			info.Go1Files = append(info.Go1Files, name)
+			if test {
+				m = testImports
+			}
+		case !test:
+			info.Go2Files = append(info.Go2Files, name)
+		case strings.HasSuffix(pf.Name.Name, "_test"):
+			info.XTestGo2Files = append(info.XTestGo2Files, name)
+			m = testImports
+		default:
+			info.TestGo2Files = append(info.TestGo2Files, name)
+			m = testImports
+		}
+		for _, spec := range pf.Imports {
+			if path, err := strconv.Unquote(spec.Path.Value); err == nil {
+				m[path] = true
+			}
+		}
+	}
+	info.Imports = sortedKeys(imports)
+	info.TestImports = sortedKeys(testImports)
+	for _, path := range info.Imports {
+		if importer.isGo2Import(path, dir) {
+			info.Go2Imports = append(info.Go2Imports, path)
+		} else {
+			info.Go1Imports = append(info.Go1Imports, path)
+		}
+	}
+
+	importer.clearOutput(dir)
+	tpkgs, err := rewriteFilesInPath(importer, nil, "", dir, dir, go2files)
+	if err != nil {
+		return nil, err
+	}
+	files, err := importer.outputFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	for name := range files {
+		if name == namesFile {
+			info.NamesFile = name
+		} else {
+			info.GoFiles = append(info.GoFiles, name)
+		}
+	}
+	sort.Strings(info.GoFiles)
+
+	tpkg := importedPackage(tpkgs)
+	info.Name = tpkg.Name()
+
+	// Translated packages are type checked with their names as
+	// paths; report their import paths instead.
+	paths := make(map[*types.Package]string)
+	importer.mu.Lock()
+	for path, p := range importer.packages {
+		paths[p] = path
+	}
+	importer.mu.Unlock()
+	for _, p := range tpkgs {
+		paths[p] = info.ImportPath
+		if p != tpkg {
+			paths[p] += "_test"
+		}
+	}
+	pkgPath := func(pkg *types.Package) string {
+		if path, ok := paths[pkg]; ok {
+			return path
+		}
+		return pkg.Path()
+	}
+
+	scope := tpkg.Scope()
+	for _, name := range scope.Names() {
+		obj := scope.Lookup(name)
+		if !obj.Exported() {
+			continue
+		}
+		var kind string
+		var tparams []*types.TypeName
+		switch obj := obj.(type) {
+		case *types.Func:
+			kind, tparams = "func", obj.Type().(*types.Signature).TParams()
+		case *types.TypeName:
+			if named, ok := obj.Type().(*types.Named); ok {
+				kind, tparams = "type", named.TParams()
+			}
+		case *types.Contract:
+			kind, tparams = "contract", obj.TParams
+		}
+		if len(tparams) == 0 {
+			continue
+		}
+		g := &Generic{Name: name, Kind: kind}
+		for _, tp := range tparams {
+			g.TypeParams = append(g.TypeParams, tp.Name())
+		}
+		info.Generics = append(info.Generics, g)
+	}
+
+	seen := make(map[string]bool)
+	importer.mu.Lock()
+	for _, p := range tpkgs {
+		for _, r := range importer.requests[p] {
+			inst := &Instance{
+				Package:        pkgPath(r.obj.Pkg()),
+				Name:           r.obj.Name(),
+				Kind:           "func",
+				InstantiatedIn: pkgPath(r.pkg),
+			}
+			if _, ok := r.obj.(*types.TypeName); ok {
+				inst.Kind = "type"
+			}
+			for _, typ := range r.types {
+				inst.TypeArgs = append(inst.TypeArgs, types.TypeString(typ, pkgPath))
+			}
+			key := inst.Package + "." + inst.Name + "(" + strings.Join(inst.TypeArgs, ", ") + ")"
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if r.test {
+				info.TestInstantiations = append(info.TestInstantiations, inst)
+			} else {
+				info.Instantiations = append(info.Instantiations, inst)
+			}
+		}
+	}
+	importer.mu.Unlock()
+	sortInstantiations(info.Instantiations)
+	sortInstantiations(info.TestInstantiations)
+
+	return info, nil
+}
+
+// dirImportPath returns the import path of the package in dir: its
+// path in the module or GO2PATH directory holding it, or, as for the
+// go command, an underscore followed by the directory.
+func (imp *Importer) dirImportPath(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+	within := func(root string) (string, bool) {
+		rel, err := filepath.Rel(root, abs)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", false
+		}
+		return filepath.ToSlash(rel), true
+	}
+
+	// The innermost module holding dir provides its path.
+	importPath, depth := "", -1
+	for _, m := range imp.modules {
+		if rel, ok := within(m.dir); ok && len(m.dir) > depth {
+			importPath, depth = path.Join(m.path, rel), len(m.dir)
+		}
+	}
+	if importPath != "" {
+		return importPath
+	}
+	if go2path := os.Getenv("GO2PATH"); go2path != "" {
+		for _, pd := range strings.Split(go2path, ":") {
+			if rel, ok := within(filepath.Join(pd, "src")); ok && rel != "." {
+				return rel
+			}
+		}
+	}
+	return "_" + filepath.ToSlash(abs)
+}
+
+// isGo2Import reports whether the package importPath, imported from
+// dir, has .go2 files to translate.
+func (imp *Importer) isGo2Import(importPath, dir string) bool {
+	var pdir string
+	if build.IsLocalImport(importPath) {
+		pdir = filepath.Join(dir, importPath)
+	} else {
+		var err error
+		pdir, err = imp.findPackageDir(importPath, dir)
+		if err != nil || pdir == "" {
+			return false
+		}
+	}
+	go2files, _, err := imp.PackageFiles(pdir)
+	return err == nil && len(go2files) > 0
+}
+
+// sortedKeys returns the keys of m in increasing order.
+func sortedKeys(m map[string]bool) []string {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortInstantiations sorts insts by package, name and type arguments.
+func sortInstantiations(insts []*Instance) {
+	sort.Slice(insts, func(i, j int) bool {
+		a, b := insts[i], insts[j]
+		if a.Package != b.Package {
+			return a.Package < b.Package
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return strings.Join(a.TypeArgs, ", ") < strings.Join(b.TypeArgs, ", ")
+	})
+}
@@ -0,0 +1,684 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package go2go
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/tdakkota/go2go/golib/ast"
+	"github.com/tdakkota/go2go/golib/parser"
+	"github.com/tdakkota/go2go/golib/token"
+	"github.com/tdakkota/go2go/golib/types"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Migration to Go 1.18 syntax.
+//
+// Rather than printing a rewritten AST, migration edits the source
+// text, so that comments and layout are kept. A type parameter list
+//
+//	func Max(type T Ordered)(a, b T) T
+//
+// becomes
+//
+//	func Max[T Ordered](a, b T) T
+//
+// an instantiation List(int) becomes List[int], and a type list in an
+// interface becomes a union. A contract becomes a constraint interface
+// for each of its type parameters. A contract with a single type
+// parameter keeps its name; otherwise the name of the type parameter
+// is appended to the contract name, so that
+//
+//	contract G(Node, Edge) {
+//		Node Edges() []Edge
+//		Edge Nodes() (a, b Node)
+//	}
+//
+// becomes the interfaces GNode[Node, Edge any] and GEdge[Node, Edge any],
+// and a type parameter list (type Node, Edge G) becomes
+// [Node GNode[Node, Edge], Edge GEdge[Node, Edge]].
+
+// Migrate converts the .go2 files in dir from the contracts draft
+// design to Go source using type parameters, as supported by Go 1.18
+// and later. It returns the converted source of each file, keyed by
+// the file name with the .go2 extension replaced by .go. The
+// hand-written .go files in dir are type checked with the .go2 files,
+// but are not converted. Only the files that match the build context
+// of the Importer are converted; their build constraints are kept.
+// If some code cannot be converted, the error is an ErrorList.
+func Migrate(importer *Importer, dir string) (map[string][]byte, error) {
+	go2files, gofiles, err := importer.PackageFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	allGofiles, err := HandWrittenFiles(importer.fs, dir)
+	if err != nil {
+		return nil, err
+	}
+	handWritten := make(map[string]bool)
+	for _, gof := range allGofiles {
+		handWritten[gof] = true
+	}
+
+	fset := token.NewFileSet()
+	srcs := make(map[*ast.File][]byte)
+	pkgs := make(map[string][]*ast.File)
+	var names []string
+	for _, f := range append(go2files, gofiles...) {
+		if gof := strings.TrimSuffix(f, ".go2") + ".go"; f != gof && handWritten[gof] {
+			return nil, fmt.Errorf("%s: migration would overwrite hand-written file %s", filepath.Join(dir, f), gof)
+		}
+		filename := filepath.Join(dir, f)
+		src, err := importer.fs.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		pf, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		srcs[pf] = src
+		if _, ok := pkgs[pf.Name.Name]; !ok {
+			names = append(names, pf.Name.Name)
+		}
+		pkgs[pf.Name.Name] = append(pkgs[pf.Name.Name], pf)
+	}
+	sort.Strings(names)
+
+	out := make(map[string][]byte)
+	var errs ErrorList
+	for _, name := range names {
+		info, err := migrateCheck(importer, fset, name, pkgs[name])
+		if err != nil {
+			return nil, err
+		}
+		for _, pf := range pkgs[name] {
+			filename := fset.File(pf.Pos()).Name()
+			if filepath.Ext(filename) != ".go2" {
+				continue
+			}
+			m := newMigrator(fset, info, pf, srcs[pf])
+			out[strings.TrimSuffix(filepath.Base(filename), ".go2")+".go"] = m.migrate()
+			errs = append(errs, m.errs...)
+		}
+	}
+	if len(errs) > 0 {
+		errs.Sort()
+		return nil, errs
+	}
+	return out, nil
+}
+
+// MigrateBuffer converts the contents of a single .go2 file,
+// in a buffer, to Go source using type parameters.
+// The filename parameter is only used for error messages.
+func MigrateBuffer(importer *Importer, filename string, src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	pf, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	info, err := migrateCheck(importer, fset, pf.Name.Name, []*ast.File{pf})
+	if err != nil {
+		return nil, err
+	}
+	m := newMigrator(fset, info, pf, src)
+	out := m.migrate()
+	if len(m.errs) > 0 {
+		m.errs.Sort()
+		return nil, m.errs
+	}
+	return out, nil
+}
+
+// migrateCheck type checks the files of a package
+// and returns the information that migration needs.
+func migrateCheck(importer *Importer, fset *token.FileSet, name string, files []*ast.File) (*types.Info, error) {
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Defs:  make(map[*ast.Ident]types.Object),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+	var merr multiErr
+	conf := types.Config{
+		Importer: importer,
+		Error:    merr.add,
+	}
+	if _, err := conf.Check(name, fset, files, info); err != nil {
+		return nil, fmt.Errorf("type checking failed for %s\n%v", name, merr)
+	}
+	return info, nil
+}
+
+// An edit replaces the source bytes [start, end) with text.
+type edit struct {
+	start, end int
+	text       string
+}
+
+// A migrator converts a single file.
+type migrator struct {
+	fset  *token.FileSet
+	info  *types.Info
+	file  *ast.File
+	tfile *token.File
+	src   []byte
+	edits []edit
+	errs  ErrorList
+}
+
+// newMigrator returns a migrator for the file f with source src.
+func newMigrator(fset *token.FileSet, info *types.Info, f *ast.File, src []byte) *migrator {
+	return &migrator{
+		fset:  fset,
+		info:  info,
+		file:  f,
+		tfile: fset.File(f.Pos()),
+		src:   src,
+	}
+}
+
+// errorf records a migration error at pos.
+func (m *migrator) errorf(pos token.Pos, format string, args ...interface{}) {
+	m.errs = append(m.errs, &Error{
+		Pos:  m.fset.Position(pos),
+		Kind: Unsupported,
+		Msg:  fmt.Sprintf(format, args...),
+	})
+}
+
+// migrate returns the converted source of the file.
+func (m *migrator) migrate() []byte {
+	// Instantiations and type lists in interfaces come first,
+	// as the larger edits below include their converted text.
+	ast.Inspect(m.file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			if m.isInstantiation(n) {
+				m.bracket(n)
+			}
+		case *ast.FuncDecl:
+			if n.Recv != nil && len(n.Recv.List) > 0 {
+				if call, ok := recvCall(n.Recv.List[0].Type); ok {
+					m.bracket(call)
+				}
+			}
+		case *ast.InterfaceType:
+			m.typeLists(n)
+		}
+		return true
+	})
+
+	var big []edit
+	for _, decl := range m.file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Type.TParams != nil {
+				big = append(big, m.tparams(decl.Type.TParams))
+			}
+		case *ast.GenDecl:
+			switch decl.Tok {
+			case token.TYPE:
+				for _, spec := range decl.Specs {
+					if ts := spec.(*ast.TypeSpec); ts.TParams != nil {
+						big = append(big, m.tparams(ts.TParams))
+					}
+				}
+			case token.IDENT:
+				big = append(big, m.contractDecl(decl)...)
+			}
+		}
+	}
+	m.edits = append(m.edits, big...)
+	return []byte(m.text(0, len(m.src), nil))
+}
+
+// recvCall returns the instantiated type of a method receiver.
+func recvCall(typ ast.Expr) (*ast.CallExpr, bool) {
+	for {
+		switch t := typ.(type) {
+		case *ast.ParenExpr:
+			typ = t.X
+		case *ast.StarExpr:
+			typ = t.X
+		case *ast.CallExpr:
+			return t, true
+		default:
+			return nil, false
+		}
+	}
+}
+
+// isInstantiation reports whether call instantiates a generic type,
+// or explicitly instantiates a generic function.
+func (m *migrator) isInstantiation(call *ast.CallExpr) bool {
+	if tv, ok := m.info.Types[call]; ok && tv.IsType() {
+		return true
+	}
+	sig, ok := m.info.TypeOf(call.Fun).(*types.Signature)
+	if !ok || len(sig.TParams()) == 0 || len(call.Args) == 0 {
+		return false
+	}
+	for _, arg := range call.Args {
+		if tv, ok := m.info.Types[arg]; !ok || !tv.IsType() {
+			return false
+		}
+	}
+	return true
+}
+
+// bracket replaces the parentheses of an instantiation with brackets.
+func (m *migrator) bracket(call *ast.CallExpr) {
+	m.edits = append(m.edits,
+		edit{m.offset(call.Lparen), m.offset(call.Lparen) + 1, "["},
+		edit{m.offset(call.Rparen), m.offset(call.Rparen) + 1, "]"})
+}
+
+// typeLists converts the type lists in an interface type to unions.
+// All the types of a type list are fields sharing the name "type".
+func (m *migrator) typeLists(it *ast.InterfaceType) {
+	if it.Methods == nil {
+		return
+	}
+	var prev *ast.Field
+	for _, f := range it.Methods.List {
+		if len(f.Names) != 1 || f.Names[0].Name != "type" {
+			prev = nil
+			continue
+		}
+		if prev != nil && prev.Names[0] == f.Names[0] {
+			m.separator(prev.Type.End(), f.Type.Pos(), " |")
+		} else {
+			// Remove the type keyword.
+			m.edits = append(m.edits, edit{m.offset(f.Names[0].Pos()), m.offset(f.Type.Pos()), ""})
+		}
+		m.tilde(f.Type)
+		prev = f
+	}
+}
+
+// tilde prefixes typ, an element of a type list, with ~ unless it is
+// a defined type, so that the union permits every type with that
+// underlying type, as the type list did.
+func (m *migrator) tilde(typ ast.Expr) {
+	if _, ok := m.info.TypeOf(typ).(*types.Named); ok {
+		return
+	}
+	m.edits = append(m.edits, edit{m.offset(typ.Pos()), m.offset(typ.Pos()), "~"})
+}
+
+// separator replaces the comma between from and to with sep.
+func (m *migrator) separator(from, to token.Pos, sep string) {
+	start, end := m.offset(from), m.offset(to)
+	if i := bytes.IndexByte(m.src[start:end], ','); i >= 0 {
+		m.edits = append(m.edits, edit{start + i, start + i + 1, sep})
+	}
+}
+
+// tparams returns the edit that converts a type parameter list.
+func (m *migrator) tparams(list *ast.FieldList) edit {
+	// An instantiated contract C(A, B) sets the bounds of
+	// the type parameters A and B, wherever they are declared.
+	// A type parameter constrained by multiple contracts gets
+	// an interface embedding all of its bounds.
+	bounds := make(map[string][]string)
+	for _, f := range list.List {
+		call, ok := f.Type.(*ast.CallExpr)
+		if !ok {
+			continue
+		}
+		c, qual := m.contract(call.Fun)
+		if c == nil {
+			continue
+		}
+		args := m.exprTexts(call.Args)
+		for i, arg := range args {
+			bounds[arg] = append(bounds[arg], m.constraint(c, i, qual, args))
+		}
+	}
+
+	var elems []string
+	for _, f := range list.List {
+		names := identNames(f.Names)
+		c, qual := m.contract(f.Type)
+		switch {
+		case c != nil && !isCall(f.Type):
+			for i, name := range names {
+				elems = append(elems, name+" "+m.constraint(c, i, qual, names))
+			}
+		case c != nil || f.Type == nil:
+			var group []string
+			for _, name := range names {
+				if b, ok := bounds[name]; ok {
+					elems = append(elems, anyGroup(group)...)
+					elems = append(elems, name+" "+embedAll(b))
+					group = nil
+				} else {
+					group = append(group, name)
+				}
+			}
+			elems = append(elems, anyGroup(group)...)
+		default:
+			typ := m.text(m.offset(f.Type.Pos()), m.offset(f.Type.End()), nil)
+			var group []string
+			for _, name := range names {
+				if b, ok := bounds[name]; ok {
+					if len(group) > 0 {
+						elems = append(elems, strings.Join(group, ", ")+" "+typ)
+					}
+					elems = append(elems, name+" "+embedAll(append([]string{typ}, b...)))
+					group = nil
+				} else {
+					group = append(group, name)
+				}
+			}
+			if len(group) > 0 {
+				elems = append(elems, strings.Join(group, ", ")+" "+typ)
+			}
+		}
+	}
+	return edit{m.offset(list.Opening), m.offset(list.Closing) + 1, "[" + strings.Join(elems, ", ") + "]"}
+}
+
+// embedAll returns the constraint satisfied by the types that
+// satisfy all of the given constraints.
+func embedAll(constraints []string) string {
+	if len(constraints) == 1 {
+		return constraints[0]
+	}
+	return "interface{ " + strings.Join(constraints, "; ") + " }"
+}
+
+// anyGroup returns a type parameter list element declaring the
+// type parameters in group without constraint.
+func anyGroup(group []string) []string {
+	if len(group) == 0 {
+		return nil
+	}
+	return []string{strings.Join(group, ", ") + " any"}
+}
+
+// isCall reports whether x is an instantiated contract.
+func isCall(x ast.Expr) bool {
+	_, ok := x.(*ast.CallExpr)
+	return ok
+}
+
+// identNames returns the names of the identifiers in list.
+func identNames(list []*ast.Ident) []string {
+	names := make([]string, 0, len(list))
+	for _, id := range list {
+		names = append(names, id.Name)
+	}
+	return names
+}
+
+// exprTexts returns the converted source of the expressions in list.
+func (m *migrator) exprTexts(list []ast.Expr) []string {
+	texts := make([]string, 0, len(list))
+	for _, x := range list {
+		texts = append(texts, m.text(m.offset(x.Pos()), m.offset(x.End()), nil))
+	}
+	return texts
+}
+
+// contract returns the contract that x, a contract name or an
+// instantiated contract, refers to, and the package qualifier
+// of the name, if any. It returns nil if x is not a contract.
+func (m *migrator) contract(x ast.Expr) (*types.Contract, string) {
+	if call, ok := x.(*ast.CallExpr); ok {
+		x = call.Fun
+	}
+	switch x := x.(type) {
+	case *ast.Ident:
+		c, _ := m.info.Uses[x].(*types.Contract)
+		return c, ""
+	case *ast.SelectorExpr:
+		c, _ := m.info.Uses[x.Sel].(*types.Contract)
+		return c, m.text(m.offset(x.X.Pos()), m.offset(x.X.End()), nil) + "."
+	}
+	return nil, ""
+}
+
+// constraint returns the constraint for the i'th type parameter of
+// the contract c, qualified by qual, with the type arguments args.
+func (m *migrator) constraint(c *types.Contract, i int, qual string, args []string) string {
+	if c.Pkg() == nil {
+		// The predeclared comparable contract.
+		return c.Name()
+	}
+	name := qual + contractIfaceName(c, i)
+	if contractParameterized(c, i) {
+		name += "[" + strings.Join(args, ", ") + "]"
+	}
+	return name
+}
+
+// contractIfaceName returns the name of the interface converted
+// from the i'th type parameter of the contract c.
+func contractIfaceName(c *types.Contract, i int) string {
+	if len(c.TParams) == 1 {
+		return c.Name()
+	}
+	return c.Name() + c.TParams[i].Name()
+}
+
+// contractParameterized reports whether the interface converted from
+// the i'th type parameter of c has type parameters. That is so for a
+// contract with more than one type parameter, for a contract with
+// a method whose signature refers to its type parameter, and for a
+// contract embedding other contracts (which may be instantiated with
+// its type parameter).
+func contractParameterized(c *types.Contract, i int) bool {
+	if len(c.TParams) > 1 {
+		return true
+	}
+	iface, ok := c.Bounds[i].Underlying().(*types.Interface)
+	return ok && (iface.NumEmbeddeds() > 0 || types.IsParameterized(iface.Complete()))
+}
+
+// contractDecl returns the edits that convert a contract declaration.
+func (m *migrator) contractDecl(decl *ast.GenDecl) []edit {
+	grouped := decl.Lparen.IsValid()
+	var edits []edit
+	if grouped {
+		edits = append(edits, edit{m.offset(decl.TokPos), m.offset(decl.Lparen), "type "})
+	}
+	for _, spec := range decl.Specs {
+		cs := spec.(*ast.ContractSpec)
+		c, _ := m.info.Defs[cs.Name].(*types.Contract)
+		if c == nil {
+			m.errorf(cs.Pos(), "contract %s was not type checked", cs.Name.Name)
+			continue
+		}
+		var ifaces []string
+		for i := range cs.TParams {
+			iface := contractIfaceName(c, i)
+			if !grouped {
+				iface = "type " + iface
+			}
+			if contractParameterized(c, i) {
+				iface += "[" + strings.Join(identNames(cs.TParams), ", ") + " any]"
+			}
+			body := m.text(m.offset(cs.Lbrace)+1, m.offset(cs.Rbrace), m.constraintEdits(cs, i))
+			ifaces = append(ifaces, iface+" interface {"+body+"}")
+		}
+		start := m.offset(cs.Pos())
+		if !grouped {
+			start = m.offset(decl.TokPos)
+		}
+		sep := "\n\n"
+		if grouped {
+			sep = "\n\t"
+		}
+		edits = append(edits, edit{start, m.offset(cs.Rbrace) + 1, strings.Join(ifaces, sep)})
+	}
+	return edits
+}
+
+// constraintEdits returns the edits that turn the body of the
+// contract cs into the body of the interface for its i'th type
+// parameter. Constraints on other type parameters are removed.
+func (m *migrator) constraintEdits(cs *ast.ContractSpec, i int) []edit {
+	tparam := cs.TParams[i].Name
+	var edits []edit
+	for _, c := range cs.Constraints {
+		if c.Param == nil {
+			// An embedded contract.
+			call, ok := c.Types[0].(*ast.CallExpr)
+			if !ok {
+				m.errorf(c.Types[0].Pos(), "unexpected embedded contract")
+				continue
+			}
+			ec, qual := m.contract(call)
+			args := m.exprTexts(call.Args)
+			var embeds []string
+			for j, arg := range args {
+				if ec != nil && arg == tparam {
+					embeds = append(embeds, m.constraint(ec, j, qual, args))
+				}
+			}
+			if len(embeds) == 0 {
+				edits = append(edits, m.deleteConstraint(c))
+				continue
+			}
+			sep := "\n" + string(m.indent(m.offset(call.Pos())))
+			edits = append(edits, edit{m.offset(call.Pos()), m.offset(call.End()), strings.Join(embeds, sep)})
+			continue
+		}
+
+		if c.Param.Name != tparam {
+			edits = append(edits, m.deleteConstraint(c))
+			continue
+		}
+		if c.Star.IsValid() {
+			m.errorf(c.Star, "pointer method constraint on %s has no Go 1.18 equivalent", tparam)
+			edits = append(edits, m.deleteConstraint(c))
+			continue
+		}
+		first := c.Types[0].Pos()
+		if c.MNames[0] != nil {
+			first = c.MNames[0].Pos()
+		}
+		edits = append(edits, edit{m.offset(c.Param.Pos()), m.offset(first), ""})
+		for j, typ := range c.Types {
+			if c.MNames[j] == nil {
+				m.tildeTo(&edits, typ)
+			}
+			if j+1 < len(c.Types) {
+				next := c.Types[j+1].Pos()
+				sep := " |"
+				if c.MNames[j+1] != nil {
+					next = c.MNames[j+1].Pos()
+					sep = ";"
+				} else if c.MNames[j] != nil {
+					sep = ";"
+				}
+				start, end := m.offset(typ.End()), m.offset(next)
+				if k := bytes.IndexByte(m.src[start:end], ','); k >= 0 {
+					edits = append(edits, edit{start + k, start + k + 1, sep})
+				}
+			}
+		}
+	}
+	return edits
+}
+
+// tildeTo is like tilde, but appends the edit to edits.
+func (m *migrator) tildeTo(edits *[]edit, typ ast.Expr) {
+	saved := m.edits
+	m.edits = nil
+	m.tilde(typ)
+	*edits = append(*edits, m.edits...)
+	m.edits = saved
+}
+
+// deleteConstraint returns an edit removing the constraint c,
+// along with the lines it occupies and a comment directly above it.
+func (m *migrator) deleteConstraint(c *ast.Constraint) edit {
+	start := m.lineStart(m.offset(c.Pos()))
+	end := m.offset(c.Types[len(c.Types)-1].End())
+	for _, cg := range m.file.Comments {
+		cstart, cend := m.offset(cg.Pos()), m.offset(cg.End())
+		switch {
+		case cend <= start && m.lineStart(cstart) == cstart-len(m.indent(cstart)) &&
+			m.tfile.Line(cg.End())+1 == m.tfile.Line(c.Pos()):
+			start = m.lineStart(cstart)
+		case cstart >= end && m.tfile.Line(cg.Pos()) == m.tfile.Line(c.Types[len(c.Types)-1].End()):
+			end = cend
+		}
+	}
+	for end < len(m.src) && (m.src[end] == ' ' || m.src[end] == '\t' || m.src[end] == ';') {
+		end++
+	}
+	if end < len(m.src) && m.src[end] == '\n' {
+		end++
+	}
+	return edit{start, end, ""}
+}
+
+// lineStart returns the offset of the start of the line holding off,
+// if there is only white space before off on that line. Otherwise it
+// returns off.
+func (m *migrator) lineStart(off int) int {
+	ls := off - len(m.indent(off))
+	if ls == 0 || m.src[ls-1] == '\n' {
+		return ls
+	}
+	return off
+}
+
+// indent returns the blanks directly before off.
+func (m *migrator) indent(off int) []byte {
+	i := off
+	for i > 0 && (m.src[i-1] == ' ' || m.src[i-1] == '\t') {
+		i--
+	}
+	return m.src[i:off]
+}
+
+// offset returns the offset of pos in the source.
+func (m *migrator) offset(pos token.Pos) int {
+	return m.tfile.Offset(pos)
+}
+
+// text returns the source bytes [start, end) with the recorded edits
+// and extra applied. An edit that is within an earlier, larger edit
+// is dropped, as the text of the larger edit already includes it.
+func (m *migrator) text(start, end int, extra []edit) string {
+	var edits []edit
+	for _, e := range append(m.edits[:len(m.edits):len(m.edits)], extra...) {
+		if start <= e.start && e.end <= end {
+			edits = append(edits, e)
+		}
+	}
+	sort.SliceStable(edits, func(i, j int) bool {
+		e, f := edits[i], edits[j]
+		if e.start != f.start {
+			return e.start < f.start
+		}
+		// Insertions go before replacements at the same offset,
+		// and larger replacements before the ones they contain.
+		if (e.start == e.end) != (f.start == f.end) {
+			return e.start == e.end
+		}
+		return e.end > f.end
+	})
+
+	var sb strings.Builder
+	cur := start
+	for _, e := range edits {
+		if e.start < cur {
+			continue
+		}
+		sb.Write(m.src[cur:e.start])
+		sb.WriteString(e.text)
+		cur = e.end
+	}
+	sb.Write(m.src[cur:end])
+	return sb.String()
+}
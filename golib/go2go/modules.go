@@ -0,0 +1,211 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package go2go
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A module is a Go module whose source is in a local directory:
+// the main module, or a module that the main module replaces with
+// a directory.
+type module struct {
+	path string // module path
+	dir  string // directory holding go.mod
+}
+
+// A modReplace is a replace directive in a go.mod file.
+type modReplace struct {
+	old, new string // module paths; new may be a file path
+}
+
+// FindModule looks for a go.mod file in dir or one of its parents.
+// If it finds one, the Importer resolves imports of packages in that
+// main module, and in modules that the main module replaces with
+// local directories, from the module source directories. Imported
+// packages are then translated into a module-shaped overlay directory;
+// see Overlay. FindModule reports whether a go.mod file was found.
+func (imp *Importer) FindModule(dir string) (bool, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return false, err
+	}
+	for {
+		if _, err := imp.fs.ReadFile(filepath.Join(dir, "go.mod")); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false, nil
+		}
+		dir = parent
+	}
+
+	path, replaces, err := readModFile(imp.fs, filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return false, err
+	}
+	mods := []*module{{path: path, dir: dir}}
+	for _, r := range replaces {
+		if !isFilePath(r.new) {
+			continue
+		}
+		rdir := r.new
+		if !filepath.IsAbs(rdir) {
+			rdir = filepath.Join(dir, rdir)
+		}
+		mods = append(mods, &module{path: r.old, dir: filepath.Clean(rdir)})
+	}
+
+	// Look for the longest matching module path first,
+	// so that nested modules are found.
+	sort.SliceStable(mods, func(i, j int) bool {
+		return len(mods[i].path) > len(mods[j].path)
+	})
+	imp.modules = mods
+	return true, nil
+}
+
+// ModuleDir returns the directory of importPath if it is in the
+// main module or in a module that it replaces with a directory.
+// It returns the empty string if the package is not found there.
+func (imp *Importer) ModuleDir(importPath string) string {
+	for _, m := range imp.modules {
+		var d string
+		switch {
+		case importPath == m.path:
+			d = m.dir
+		case strings.HasPrefix(importPath, m.path+"/"):
+			d = filepath.Join(m.dir, filepath.FromSlash(strings.TrimPrefix(importPath, m.path+"/")))
+		default:
+			continue
+		}
+		if imp.isDir(d) {
+			return d
+		}
+	}
+	return ""
+}
+
+// Overlay returns the replacements for the .go files of imported
+// packages translated in module mode. It maps a file name in the
+// package source directory to the name of the translated file,
+// or to the empty string if an old generated file should be ignored.
+// This is the Replace map of the go command's -overlay flag.
+func (imp *Importer) Overlay() map[string]string {
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
+	return imp.overlay
+}
+
+// addOverlay records that the package in the source directory pdir
+// was translated into the directory tdir.
+func (imp *Importer) addOverlay(pdir, tdir string) error {
+	translated, err := ioutil.ReadDir(tdir)
+	if err != nil {
+		return err
+	}
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
+	for _, fi := range translated {
+		if filepath.Ext(fi.Name()) == ".go" {
+			imp.overlay[filepath.Join(pdir, fi.Name())] = filepath.Join(tdir, fi.Name())
+		}
+	}
+
+	// Hide any files generated by an earlier translation.
+	old, err := ioutil.ReadDir(pdir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range old {
+		name := filepath.Join(pdir, fi.Name())
+		if _, ok := imp.overlay[name]; !ok && filepath.Ext(fi.Name()) == ".go" {
+			imp.overlay[name] = ""
+		}
+	}
+	return nil
+}
+
+// readModFile reads a go.mod file in fsys and returns the module path
+// and the replace directives.
+func readModFile(fsys FileSystem, file string) (string, []modReplace, error) {
+	data, err := fsys.ReadFile(file)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var path string
+	var replaces []modReplace
+	block := ""
+	for i, line := range strings.Split(string(data), "\n") {
+		if j := strings.Index(line, "//"); j >= 0 {
+			line = line[:j]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if block != "" {
+			if fields[0] == ")" {
+				block = ""
+				continue
+			}
+			fields = append([]string{block}, fields...)
+		} else if len(fields) == 2 && fields[1] == "(" {
+			block = fields[0]
+			continue
+		}
+
+		switch fields[0] {
+		case "module":
+			if len(fields) != 2 {
+				return "", nil, fmt.Errorf("%s:%d: malformed module directive", file, i+1)
+			}
+			path = unquoteModPath(fields[1])
+		case "replace":
+			// replace old [version] => new [version]
+			arrow := -1
+			for k, f := range fields {
+				if f == "=>" {
+					arrow = k
+				}
+			}
+			if arrow < 2 || arrow > 3 || len(fields) < arrow+2 || len(fields) > arrow+3 {
+				return "", nil, fmt.Errorf("%s:%d: malformed replace directive", file, i+1)
+			}
+			replaces = append(replaces, modReplace{
+				old: unquoteModPath(fields[1]),
+				new: unquoteModPath(fields[arrow+1]),
+			})
+		}
+	}
+	if path == "" {
+		return "", nil, fmt.Errorf("%s: no module directive", file)
+	}
+	return path, replaces, nil
+}
+
+// unquoteModPath returns a module path or file path from a go.mod
+// file, removing any quotes.
+func unquoteModPath(s string) string {
+	if u, err := strconv.Unquote(s); err == nil {
+		return u
+	}
+	return s
+}
+
+// isFilePath reports whether the target of a replace directive is
+// a directory rather than a module path.
+func isFilePath(s string) bool {
+	return filepath.IsAbs(s) || s == "." || s == ".." ||
+		strings.HasPrefix(s, "./") || strings.HasPrefix(s, "../") ||
+		strings.HasPrefix(s, `.\`) || strings.HasPrefix(s, `..\`)
+}
@@ -5,10 +5,17 @@
 package go2go
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"github.com/tdakkota/go2go/golib/token"
 	"github.com/tdakkota/go2go/golib/types"
+	"path/filepath"
+	"sort"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 // We use Oriya digit zero as a separator.
@@ -33,12 +40,203 @@ var nameCodes = map[rune]int{
 	'.':       10,
 	nameSep:   11,
 	nameIntro: 12,
+	'<':       13, // channel directions
+	'-':       14,
+}
+
+// Naming selects how instantiated functions and types are named.
+type Naming int
+
+const (
+	// MangledNames names an instantiation by its generic function
+	// or type and its type arguments, using Oriya digits to separate
+	// them and to encode the characters of the type arguments.
+	// For example, List(int) becomes Instantiate୦୦List୦int.
+	MangledNames Naming = iota
+
+	// ReadableNames names an instantiation using ASCII characters,
+	// separating the generic name and the type arguments with
+	// double underscores. A type argument that is not a predeclared
+	// or defined type is written as T followed by eight hexadecimal
+	// digits of a hash of the type. For example, List(int) becomes
+	// List__int, and list.List(int), instantiated outside package
+	// list, becomes List_List__int.
+	// A name that conflicts with another declaration is reported as
+	// an error. The generated names are recorded in the file
+	// instantiations.names, next to the translated files.
+	// The other names introduced by the translation, such as those
+	// of the dictionary translation, also use double underscores;
+	// package-level ones are recorded in the names file as well.
+	ReadableNames
+)
+
+// namesFile is the file recording the generic function or type and
+// the type arguments of each instantiation named using ReadableNames.
+const namesFile = "instantiations.names"
+
+// SetNaming sets how instantiations are named. The default is
+// MangledNames.
+func (imp *Importer) SetNaming(naming Naming) {
+	imp.naming = naming
 }
 
 // instantiatedName returns the name of a newly instantiated function.
 func (t *translator) instantiatedName(qid qualifiedIdent, types []types.Type) (string, error) {
+	if t.importer.naming == ReadableNames {
+		return t.readableName(qid, types)
+	}
+	return t.mangledName("Instantiate", qid, types)
+}
+
+// readableName returns the ReadableNames name of qid instantiated
+// with typeList, and records it in the names of the package.
+func (t *translator) readableName(qid qualifiedIdent, typeList []types.Type) (string, error) {
+	pkg := t.genericPackage(qid)
+
+	var sb strings.Builder
+	// The name is exported, so that packages that import this one
+	// can use the instantiation rather than creating their own.
+	if pkg != t.tpkg {
+		sb.WriteString(exportedName(pkg.Name()))
+		sb.WriteByte('_')
+		sb.WriteString(qid.ident.Name)
+	} else {
+		sb.WriteString(exportedName(qid.ident.Name))
+	}
+	for _, typ := range typeList {
+		sb.WriteString("__")
+		sb.WriteString(t.readableTypeName(typ))
+	}
+	name := sb.String()
+
+	origin := instantiationOrigin(pkg, qid.ident.Name, typeList)
+	if err := t.recordName(qid.ident.Pos(), name, "instantiation "+origin, origin); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// genericPackage returns the package that declares the generic
+// function or type qid.
+func (t *translator) genericPackage(qid qualifiedIdent) *types.Package {
+	// An identifier in an instantiated declaration of another
+	// package refers to that package, though it is not qualified.
+	pkg := qid.pkg
+	if obj := t.findTypesObject(qid); obj != nil {
+		pkg = obj.Pkg()
+	}
+	if pkg == nil {
+		pkg = t.tpkg
+	}
+	return pkg
+}
+
+// recordName records name, generated using ReadableNames, with
+// origin in the names of the package. It reports an error at pos,
+// using desc to describe the named declaration, if name is already
+// in use.
+func (t *translator) recordName(pos token.Pos, name, desc, origin string) error {
+	if prev, ok := t.names[name]; ok && prev != origin {
+		return t.newError(pos, Unsupported, "name %s of %s conflicts with %s", name, desc, prev)
+	}
+	if obj := t.tpkg.Scope().Lookup(name); obj != nil {
+		return t.newError(pos, Unsupported, "name %s of %s conflicts with %s declared in package %s", name, desc, obj.Name(), t.tpkg.Name())
+	}
+	t.names[name] = origin
+	return nil
+}
+
+// generatedName returns the name of a declaration, field or variable
+// introduced by the translation, made of parts. MangledNames separates
+// the parts with nameSep, and ReadableNames with double underscores.
+func (n Naming) generatedName(parts ...string) string {
+	sep := string(nameSep)
+	if n == ReadableNames {
+		sep = "__"
+	}
+	return strings.Join(parts, sep)
+}
+
+// readableTypeName returns the part of a ReadableNames name for the
+// type argument typ.
+func (t *translator) readableTypeName(typ types.Type) string {
+	s := types.TypeString(typ, func(pkg *types.Package) string {
+		if pkg == t.tpkg {
+			return ""
+		}
+		return pkg.Name()
+	})
+	ok := true
+	for _, r := range s {
+		if !(r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.')) {
+			ok = false
+			break
+		}
+	}
+	if ok {
+		return strings.Replace(s, ".", "_", -1)
+	}
+	h := sha256.Sum256([]byte(types.TypeString(typ, (*types.Package).Path)))
+	return "T" + hex.EncodeToString(h[:4])
+}
+
+// exportedName returns name with its first letter in upper case.
+func exportedName(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	if unicode.IsUpper(r) {
+		return name
+	}
+	if !unicode.IsLetter(r) {
+		return "X" + name
+	}
+	return string(unicode.ToUpper(r)) + name[size:]
+}
+
+// instantiationOrigin describes the instantiation of the generic
+// function or type name of pkg with typeList, for the names file.
+func instantiationOrigin(pkg *types.Package, name string, typeList []types.Type) string {
+	targs := make([]string, len(typeList))
+	for i, typ := range typeList {
+		targs[i] = types.TypeString(typ, (*types.Package).Path)
+	}
+	return fmt.Sprintf("%s.%s(%s)", pkg.Path(), name, strings.Join(targs, ", "))
+}
+
+// writeNames writes the names of the instantiations made for pkgs,
+// with their generic functions or types and type arguments, to the
+// names file in dir. Nothing is written if there are none.
+func (imp *Importer) writeNames(dir string, pkgs []*types.Package, sts []*pkgTranslation) error {
+	var buf bytes.Buffer
+	for i, st := range sts {
+		if len(st.names) == 0 {
+			continue
+		}
+		if buf.Len() == 0 {
+			fmt.Fprintf(&buf, "# Code generated by go2go; DO NOT EDIT.\n")
+		}
+		fmt.Fprintf(&buf, "package %s\n", pkgs[i].Name())
+		names := make([]string, 0, len(st.names))
+		for name := range st.names {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(&buf, "%s\t%s\n", name, st.names[name])
+		}
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	return imp.writeOutput(filepath.Join(dir, namesFile), buf.Bytes())
+}
+
+// mangledName returns a name starting with prefix for qid
+// instantiated with types.
+func (t *translator) mangledName(prefix string, qid qualifiedIdent, types []types.Type) (string, error) {
 	var sb strings.Builder
-	fmt.Fprintf(&sb, "instantiate%c", nameSep)
+	// The name is exported, so that packages that import this one
+	// can use the instantiation rather than creating their own.
+	fmt.Fprintf(&sb, "%s%c", prefix, nameSep)
 	if qid.pkg != nil {
 		fmt.Fprintf(&sb, qid.pkg.Name())
 	}
@@ -56,7 +254,7 @@ func (t *translator) instantiatedName(qid qualifiedIdent, types []types.Type) (s
 			} else {
 				code, ok := nameCodes[r]
 				if !ok {
-					panic(fmt.Sprintf("%s: unexpected type string character %q in %q", t.fset.Position(qid.ident.Pos()), r, s))
+					return "", t.newError(qid.ident.Pos(), Unsupported, "unexpected type string character %q in %q", r, s)
 				}
 				fmt.Fprintf(&sb, "%c%x", nameIntro, code)
 			}
@@ -68,5 +266,5 @@ func (t *translator) instantiatedName(qid qualifiedIdent, types []types.Type) (s
 // importableName returns a name that we define in each package, so that
 // we have something to import to avoid an unused package error.
 func (t *translator) importableName() string {
-	return "Importable" + string(nameSep)
+	return t.importer.naming.generatedName("Importable", "")
 }
@@ -0,0 +1,235 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package go2go
+
+import (
+	"fmt"
+	"github.com/tdakkota/go2go/golib/build"
+	"github.com/tdakkota/go2go/golib/internal/goroot"
+	"github.com/tdakkota/go2go/golib/parser"
+	"github.com/tdakkota/go2go/golib/token"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// A pkgNode is a package in the import graph of the directories
+// passed to RewriteAll.
+type pkgNode struct {
+	path   string     // import path; empty for a listed directory
+	dir    string     // source directory
+	srcDir string     // directory of the first package importing it
+	go2    bool       // whether the package has .go2 files
+	deps   []*pkgNode // the non-standard packages that it imports
+	done   chan struct{}
+	err    error
+}
+
+// RewriteAll rewrites the contents of each of dirs, as Rewrite does.
+// The .go2 packages that they import, directly or indirectly, are
+// translated as well, with up to parallel packages being translated
+// at once. A package is translated after the packages that it imports,
+// so packages that do not depend on each other are translated in
+// parallel. If a directory cannot be translated, RewriteAll returns
+// the error for the first such directory in dirs.
+func RewriteAll(importer *Importer, dirs []string, parallel int) error {
+	if parallel <= 1 {
+		for _, dir := range dirs {
+			if err := Rewrite(importer, dir); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	g := &importGraph{
+		imp:   importer,
+		nodes: make(map[string]*pkgNode),
+	}
+	var roots []*pkgNode
+	for _, dir := range dirs {
+		root := &pkgNode{dir: dir, go2: true}
+		if err := g.scan(root); err != nil {
+			return err
+		}
+		roots = append(roots, root)
+		g.order = append(g.order, root)
+	}
+	if err := g.checkCycles(roots); err != nil {
+		return err
+	}
+
+	sem := make(chan struct{}, parallel)
+	for _, n := range g.order {
+		n.done = make(chan struct{})
+	}
+	for _, n := range g.order {
+		go func(n *pkgNode) {
+			defer close(n.done)
+			for _, dep := range n.deps {
+				<-dep.done
+			}
+			if !n.go2 {
+				return
+			}
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if n.path == "" {
+				n.err = Rewrite(importer, n.dir)
+			} else {
+				// An error is reported by the packages
+				// that import this one.
+				importer.ImportFrom(n.path, n.srcDir, 0)
+			}
+		}(n)
+	}
+	for _, root := range roots {
+		<-root.done
+	}
+	for _, root := range roots {
+		if root.err != nil {
+			return root.err
+		}
+	}
+	return nil
+}
+
+// An importGraph is the graph of packages imported by the
+// directories passed to RewriteAll.
+type importGraph struct {
+	imp   *Importer
+	nodes map[string]*pkgNode // by import path
+	order []*pkgNode          // every node, including the roots
+}
+
+// scan finds the packages imported by the non-test files of n,
+// and adds them to the graph. The imports of test files are not
+// followed, as a test may import a package that imports the package
+// under test; they are translated when the tests are type checked.
+func (g *importGraph) scan(n *pkgNode) error {
+	paths, err := g.imp.scanImports(n.dir, n.go2)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if path == "C" || build.IsLocalImport(path) || goroot.IsStandardPackage(runtime.GOROOT(), "gc", path) {
+			continue
+		}
+		dep, ok := g.nodes[path]
+		if !ok {
+			dir, err := g.imp.findPackageDir(path, n.dir)
+			if err != nil || dir == "" {
+				// Leave it to the type checker to report.
+				continue
+			}
+			go2files, _, err := g.imp.PackageFiles(dir)
+			if err != nil {
+				continue
+			}
+			dep = &pkgNode{
+				path:   path,
+				dir:    dir,
+				srcDir: n.dir,
+				go2:    len(go2files) > 0,
+			}
+			g.nodes[path] = dep
+			g.order = append(g.order, dep)
+			if err := g.scan(dep); err != nil {
+				return err
+			}
+		}
+		n.deps = append(n.deps, dep)
+	}
+	return nil
+}
+
+// checkCycles reports an error if the graph has an import cycle.
+func (g *importGraph) checkCycles(roots []*pkgNode) error {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[*pkgNode]int)
+	var stack []string
+	var visit func(n *pkgNode) error
+	visit = func(n *pkgNode) error {
+		switch state[n] {
+		case visiting:
+			i := len(stack) - 1
+			for stack[i] != n.path {
+				i--
+			}
+			cycle := append(stack[i:len(stack):len(stack)], n.path)
+			return fmt.Errorf("import cycle not allowed: %s", strings.Join(cycle, " -> "))
+		case visited:
+			return nil
+		}
+		state[n] = visiting
+		stack = append(stack, n.path)
+		for _, dep := range n.deps {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[n] = visited
+		return nil
+	}
+	for _, root := range roots {
+		if err := visit(root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanImports returns the import paths of the non-test .go2 and
+// hand-written .go files in dir, or of the non-test .go files if go2 is
+// false, that match the build context. Only the import declarations of
+// the files are parsed.
+func (imp *Importer) scanImports(dir string, go2 bool) ([]string, error) {
+	go2files, gofiles, err := imp.PackageFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := append(go2files, gofiles...)
+	if !go2 {
+		_, all, err := go2Files(imp.fs, dir)
+		if err != nil {
+			return nil, err
+		}
+		if names, err = imp.matchFiles(dir, all); err != nil {
+			return nil, err
+		}
+	}
+
+	fset := token.NewFileSet()
+	seen := make(map[string]bool)
+	var paths []string
+	for _, name := range names {
+		if strings.HasSuffix(strings.TrimSuffix(name, filepath.Ext(name)), "_test") {
+			continue
+		}
+		filename := filepath.Join(dir, name)
+		src, err := imp.fs.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		pf, err := parser.ParseFile(fset, filename, src, parser.ImportsOnly)
+		if err != nil {
+			return nil, err
+		}
+		for _, spec := range pf.Imports {
+			path, err := strconv.Unquote(spec.Path.Value)
+			if err != nil || seen[path] {
+				continue
+			}
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
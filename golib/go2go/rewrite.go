@@ -5,26 +5,27 @@
 package go2go
 
 import (
-	"bufio"
 	"fmt"
 	"github.com/tdakkota/go2go/golib/ast"
 	"github.com/tdakkota/go2go/golib/printer"
 	"github.com/tdakkota/go2go/golib/token"
 	"github.com/tdakkota/go2go/golib/types"
-	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 )
 
+// config is the printer configuration used for generated files.
+// The SourcePos and SourceColumn modes emit //line directives,
+// so that compiler errors and panics refer to the .go2 sources.
 var config = printer.Config{
-	Mode:     printer.UseSpaces | printer.TabIndent | printer.SourcePos,
+	Mode:     printer.UseSpaces | printer.TabIndent | printer.SourcePos | printer.SourceColumn,
 	Tabwidth: 8,
 }
 
 // isParameterizedFuncDecl reports whether fd is a parameterized function.
-func isParameterizedFuncDecl(fd *ast.FuncDecl, info *types.Info) bool {
+func isParameterizedFuncDecl(fd *ast.FuncDecl, info typeOfer) bool {
 	if fd.Type.TParams != nil {
 		return true
 	}
@@ -54,73 +55,167 @@ func isParameterizedTypeDecl(s ast.Spec) bool {
 
 // A translator is used to translate a file from Go with contracts to Go 1.
 type translator struct {
-	fset               *token.FileSet
-	importer           *Importer
-	tpkg               *types.Package
+	fset       *token.FileSet
+	importer   *Importer
+	importPath string
+	imports    map[string]bool // packages imported by the translated file
+	tpkg       *types.Package
+	newDecls   []ast.Decl
+
+	// The instantiations are shared by all the files of a package.
+	*pkgTranslation
+
+	// errs holds the errors seen during this translation.
+	errs ErrorList
+}
+
+// A pkgTranslation holds the state shared by the translations of
+// all the files of a package. Each generic function or type is
+// instantiated at most once for each list of type arguments.
+type pkgTranslation struct {
 	types              map[ast.Expr]types.Type
-	instantiations     map[string][]*instantiation
-	newDecls           []ast.Decl
+	instantiations     map[types.Object][]*instantiation
 	typeInstantiations map[types.Type][]*typeInstantiation
 
-	// err is set if we have seen an error during this translation.
-	// This is used by the rewrite methods.
-	err error
+	// pending holds instantiated declarations that have not yet
+	// been written to a file.
+	pending []ast.Decl
+
+	// export reports whether new instantiations are recorded in
+	// the Importer, for use by packages that import this one.
+	export bool
+
+	// names maps the name of each instantiation named using
+	// ReadableNames to a description of the instantiation.
+	names map[string]string
+
+	// requests lists the instantiations that the package uses,
+	// including those held in imported packages; requested holds
+	// their origins, as returned by instantiationOrigin.
+	requests  []*request
+	requested map[string]bool
+
+	// test reports whether test files are being translated.
+	test bool
+}
+
+// newPkgTranslation returns a new pkgTranslation.
+func newPkgTranslation(export bool) *pkgTranslation {
+	return &pkgTranslation{
+		types:              make(map[ast.Expr]types.Type),
+		instantiations:     make(map[types.Object][]*instantiation),
+		typeInstantiations: make(map[types.Type][]*typeInstantiation),
+		export:             export,
+		names:              make(map[string]string),
+		requested:          make(map[string]bool),
+	}
 }
 
 // An instantiation is a single instantiation of a function.
 type instantiation struct {
 	types []types.Type
+	keys  []string // for a cached instantiation, typeKeys rather than types
 	decl  *ast.Ident
+	pkg   *types.Package // package that holds the instantiation
 }
 
 // A typeInstantiation is a single instantiation of a type.
 type typeInstantiation struct {
 	types []types.Type
+	keys  []string // for a cached instantiation, typeKeys rather than types
 	decl  *ast.Ident
 	typ   types.Type
+	pkg   *types.Package // package that holds the instantiation
 }
 
-// rewrite rewrites the contents of one file.
-func rewriteFile(dir string, fset *token.FileSet, importer *Importer, importPath string, tpkg *types.Package, filename string, file *ast.File, addImportableName bool) (err error) {
-	if err := rewriteAST(fset, importer, importPath, tpkg, file, addImportableName); err != nil {
+// rewriteFile rewrites the contents of one file, writing the
+// resulting .go file, with the build constraints of the file, into
+// dir. The declarations of any instantiations that the file needs
+// are left in st.pending.
+func rewriteFile(dir string, fset *token.FileSet, importer *Importer, importPath string, tpkg *types.Package, st *pkgTranslation, filename string, file *ast.File, addImportableName bool) (err error) {
+	if err := rewriteAST(fset, importer, importPath, tpkg, st, file, addImportableName, false); err != nil {
 		return err
 	}
 
+	constraints := importer.fileConstraints(filename)
 	filename = filepath.Base(filename)
 	goFile := strings.TrimSuffix(filename, filepath.Ext(filename)) + ".go"
-	o, err := os.Create(filepath.Join(dir, goFile))
-	if err != nil {
-		return err
+	return importer.writeFile(filepath.Join(dir, goFile), fset, file, constraints)
+}
+
+// rewriteInstantiations writes the pending instantiated declarations
+// in st into the file name in dir. The file imports everything that
+// is imported by files, the other files in the package.
+func rewriteInstantiations(dir string, fset *token.FileSet, importer *Importer, importPath string, tpkg *types.Package, st *pkgTranslation, name string, files []namedAST) error {
+	if len(st.pending) == 0 {
+		return nil
 	}
-	defer func() {
-		if closeErr := o.Close(); err == nil {
-			err = closeErr
-		}
-	}()
 
-	w := bufio.NewWriter(o)
-	defer func() {
-		if flushErr := w.Flush(); err == nil {
-			err = flushErr
+	file := &ast.File{
+		Name: &ast.Ident{
+			NamePos: files[0].ast.Name.NamePos,
+			Name:    files[0].ast.Name.Name,
+		},
+	}
+
+	// Instantiated code may refer to any package imported by
+	// the generic code, under the name used in that file.
+	var specs []ast.Spec
+	paths := make(map[string]bool)
+	names := make(map[string]string)
+	for _, f := range files {
+		for _, is := range f.ast.Imports {
+			path := strings.TrimPrefix(strings.TrimSuffix(is.Path.Value, `"`), `"`)
+			if is.Name == nil {
+				if !paths[path] {
+					paths[path] = true
+					specs = append(specs, &ast.ImportSpec{
+						Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(path)},
+					})
+				}
+				continue
+			}
+			name := is.Name.Name
+			if name == "_" || name == "." {
+				continue
+			}
+			if p, ok := names[name]; ok {
+				if p != path {
+					return ErrorList{&Error{
+						Pos:  fset.Position(is.Pos()),
+						Kind: Unsupported,
+						Msg:  fmt.Sprintf("import name %s refers to both %q and %q", name, p, path),
+					}}
+				}
+				continue
+			}
+			names[name] = path
+			specs = append(specs, &ast.ImportSpec{
+				Name: ast.NewIdent(name),
+				Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(path)},
+			})
 		}
-	}()
-	fmt.Fprintln(w, rewritePrefix)
+	}
+	sort.Slice(specs, func(i, j int) bool {
+		return specs[i].(*ast.ImportSpec).Path.Value < specs[j].(*ast.ImportSpec).Path.Value
+	})
+	if len(specs) > 0 {
+		file.Decls = append(file.Decls, &ast.GenDecl{
+			Tok:   token.IMPORT,
+			Specs: specs,
+		})
+	}
 
-	return config.Fprint(w, fset, file)
+	if err := rewriteAST(fset, importer, importPath, tpkg, st, file, false, true); err != nil {
+		return err
+	}
+	return importer.writeFile(filepath.Join(dir, name), fset, file, nil)
 }
 
 // rewriteAST rewrites the AST for a file.
-func rewriteAST(fset *token.FileSet, importer *Importer, importPath string, tpkg *types.Package, file *ast.File, addImportableName bool) (err error) {
-	t := translator{
-		fset:               fset,
-		importer:           importer,
-		tpkg:               tpkg,
-		types:              make(map[ast.Expr]types.Type),
-		instantiations:     make(map[string][]*instantiation),
-		typeInstantiations: make(map[types.Type][]*typeInstantiation),
-	}
-	t.translate(file)
-
+// If instantiate is set, the pending instantiations in st are
+// translated and added to the file.
+func rewriteAST(fset *token.FileSet, importer *Importer, importPath string, tpkg *types.Package, st *pkgTranslation, file *ast.File, addImportableName, instantiate bool) (err error) {
 	// Add all the transitive imports. This is more than we need,
 	// but we're not trying to be elegant here.
 	imps := make(map[string]bool)
@@ -156,6 +251,19 @@ func rewriteAST(fset *token.FileSet, importer *Importer, importPath string, tpkg
 	}
 	file.Decls = decls
 
+	t := translator{
+		fset:           fset,
+		importer:       importer,
+		importPath:     importPath,
+		imports:        imps,
+		tpkg:           tpkg,
+		pkgTranslation: st,
+	}
+	t.translate(file)
+	if instantiate {
+		t.translateInstantiations(file)
+	}
+
 	paths := make([]string, 0, len(imps))
 	for p := range imps {
 		paths = append(paths, p)
@@ -216,7 +324,8 @@ func rewriteAST(fset *token.FileSet, importer *Importer, importPath string, tpkg
 				fileDir := filepath.Dir(fset.Position(file.Name.Pos()).Filename)
 				pkg, err := importer.ImportFrom(path, fileDir, 0)
 				if err != nil {
-					return err
+					t.errorf(imp.Pos(), Import, "%v", err)
+					continue
 				}
 				scope := pkg.Scope()
 				names := scope.Names()
@@ -242,7 +351,8 @@ func rewriteAST(fset *token.FileSet, importer *Importer, importPath string, tpkg
 					}
 				}
 				if importableName == "" {
-					return fmt.Errorf("can't find any importable name in package %q", path)
+					t.errorf(imp.Pos(), Import, "can't find any importable name in package %q", path)
+					continue
 				}
 			}
 
@@ -275,7 +385,8 @@ func rewriteAST(fset *token.FileSet, importer *Importer, importPath string, tpkg
 					},
 				}
 			default:
-				panic("can't happen")
+				t.errorf(imp.Pos(), Internal, "unexpected token %v for reference to package %q", tok, path)
+				continue
 			}
 			file.Decls = append(file.Decls,
 				&ast.GenDecl{
@@ -285,63 +396,88 @@ func rewriteAST(fset *token.FileSet, importer *Importer, importPath string, tpkg
 		}
 	}
 
-	return t.err
+	t.errs.Sort()
+	return t.errs.Err()
 }
 
 // translate translates the AST for a file from Go with contracts to Go 1.
+// The declarations of new instantiations are added to t.pending.
 func (t *translator) translate(file *ast.File) {
-	declsToDo := file.Decls
-	file.Decls = nil
-	for len(declsToDo) > 0 {
-		newDecls := make([]ast.Decl, 0, len(declsToDo))
-		for i, decl := range declsToDo {
-			switch decl := decl.(type) {
-			case *ast.FuncDecl:
-				if !isParameterizedFuncDecl(decl, t.importer.info) {
-					t.translateFuncDecl(&declsToDo[i])
-					newDecls = append(newDecls, decl)
-				}
-			case *ast.GenDecl:
-				switch decl.Tok {
-				case token.TYPE:
-					newSpecs := make([]ast.Spec, 0, len(decl.Specs))
-					for j := range decl.Specs {
-						if !isParameterizedTypeDecl(decl.Specs[j]) {
-							t.translateTypeSpec(&decl.Specs[j])
-							newSpecs = append(newSpecs, decl.Specs[j])
-						}
-					}
-					if len(newSpecs) == 0 {
-						decl = nil
-					} else {
-						decl.Specs = newSpecs
+	file.Decls = t.translateDecls(file.Decls)
+	t.pending = append(t.pending, t.newDecls...)
+	t.newDecls = nil
+}
+
+// translateInstantiations translates the pending instantiated
+// declarations, and any instantiations that they require in turn,
+// and adds them to file.
+func (t *translator) translateInstantiations(file *ast.File) {
+	for len(t.pending) > 0 {
+		declsToDo := t.pending
+		t.pending = nil
+		file.Decls = append(file.Decls, t.translateDecls(declsToDo)...)
+		t.pending = t.newDecls
+		t.newDecls = nil
+	}
+}
+
+// translateDecls translates a list of declarations from Go with
+// contracts to Go 1. It returns the declarations to keep.
+func (t *translator) translateDecls(declsToDo []ast.Decl) []ast.Decl {
+	newDecls := make([]ast.Decl, 0, len(declsToDo))
+	for i, decl := range declsToDo {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if !isParameterizedFuncDecl(decl, t.importer.info) {
+				t.translateFuncDecl(&declsToDo[i])
+				newDecls = append(newDecls, decl)
+			} else if shared := t.sharedDecls(decl); shared != nil {
+				for j := range shared {
+					if _, ok := shared[j].(*ast.FuncDecl); ok {
+						t.translateFuncDecl(&shared[j])
 					}
-				case token.VAR, token.CONST:
-					for j := range decl.Specs {
-						t.translateValueSpec(&decl.Specs[j])
+				}
+				newDecls = append(newDecls, shared...)
+			}
+		case *ast.GenDecl:
+			switch decl.Tok {
+			case token.TYPE:
+				newSpecs := make([]ast.Spec, 0, len(decl.Specs))
+				for j := range decl.Specs {
+					if !isParameterizedTypeDecl(decl.Specs[j]) {
+						t.translateTypeSpec(&decl.Specs[j])
+						newSpecs = append(newSpecs, decl.Specs[j])
 					}
-				case token.IDENT:
-					// A contract.
+				}
+				if len(newSpecs) == 0 {
 					decl = nil
+				} else {
+					decl.Specs = newSpecs
 				}
-				if decl != nil {
-					newDecls = append(newDecls, decl)
+			case token.VAR, token.CONST:
+				for j := range decl.Specs {
+					t.translateValueSpec(&decl.Specs[j])
 				}
-			default:
+			case token.IDENT:
+				// A contract.
+				decl = nil
+			}
+			if decl != nil {
 				newDecls = append(newDecls, decl)
 			}
+		default:
+			newDecls = append(newDecls, decl)
 		}
-		file.Decls = append(file.Decls, newDecls...)
-		declsToDo = t.newDecls
-		t.newDecls = nil
 	}
+	return newDecls
 }
 
 // translateTypeSpec translates a type from Go with contracts to Go 1.
 func (t *translator) translateTypeSpec(ps *ast.Spec) {
 	ts := (*ps).(*ast.TypeSpec)
 	if ts.TParams != nil {
-		panic("parameterized type")
+		t.errorf(ts.Pos(), Internal, "unexpected parameterized type %s", ts.Name.Name)
+		return
 	}
 	t.translateExpr(&ts.Type)
 }
@@ -358,12 +494,10 @@ func (t *translator) translateValueSpec(ps *ast.Spec) {
 
 // translateFuncDecl translates a function from Go with contracts to Go 1.
 func (t *translator) translateFuncDecl(pd *ast.Decl) {
-	if t.err != nil {
-		return
-	}
 	fd := (*pd).(*ast.FuncDecl)
 	if fd.Type.TParams != nil {
-		panic("parameterized function")
+		t.errorf(fd.Pos(), Internal, "unexpected parameterized function %s", fd.Name.Name)
+		return
 	}
 	if fd.Recv != nil {
 		t.translateFieldList(fd.Recv)
@@ -383,9 +517,6 @@ func (t *translator) translateBlockStmt(pbs *ast.BlockStmt) {
 
 // translateStmt translates a statement from Go with contracts to Go 1.
 func (t *translator) translateStmt(ps *ast.Stmt) {
-	if t.err != nil {
-		return
-	}
 	if *ps == nil {
 		return
 	}
@@ -402,7 +533,7 @@ func (t *translator) translateStmt(ps *ast.Stmt) {
 				t.translateValueSpec(&d.Specs[i])
 			}
 		default:
-			panic(fmt.Sprintf("unknown decl type %v", d.Tok))
+			t.errorf(d.Pos(), Unsupported, "unknown decl type %v", d.Tok)
 		}
 	case *ast.EmptyStmt:
 	case *ast.LabeledStmt:
@@ -462,7 +593,7 @@ func (t *translator) translateStmt(ps *ast.Stmt) {
 		t.translateExpr(&s.X)
 		t.translateBlockStmt(s.Body)
 	default:
-		panic(fmt.Sprintf("unimplemented Stmt %T", s))
+		t.errorf(s.Pos(), Unsupported, "unimplemented Stmt %T", s)
 	}
 }
 
@@ -476,9 +607,6 @@ func (t *translator) translateStmtList(sl []ast.Stmt) {
 
 // translateExpr translates an expression from Go with contracts to Go 1.
 func (t *translator) translateExpr(pe *ast.Expr) {
-	if t.err != nil {
-		return
-	}
 	if *pe == nil {
 		return
 	}
@@ -546,7 +674,7 @@ func (t *translator) translateExpr(pe *ast.Expr) {
 	case *ast.ChanType:
 		t.translateExpr(&e.Value)
 	default:
-		panic(fmt.Sprintf("unimplemented Expr %T", e))
+		t.errorf(e.Pos(), Unsupported, "unimplemented Expr %T", e)
 	}
 }
 
@@ -613,33 +741,38 @@ func (t *translator) translateField(f *ast.Field) {
 // to Go 1.
 func (t *translator) translateFunctionInstantiation(pe *ast.Expr) {
 	call := (*pe).(*ast.CallExpr)
-	qid := t.instantiatedIdent(call)
+	qid, ok := t.instantiatedIdent(call)
+	if !ok {
+		return
+	}
 	argList, typeList, typeArgs := t.instantiationTypes(call)
 
-	var instIdent *ast.Ident
-	key := qid.String()
-	instantiations := t.instantiations[key]
-	for _, inst := range instantiations {
-		if t.sameTypes(typeList, inst.types) {
-			instIdent = inst.decl
-			break
-		}
+	obj := t.findTypesObject(qid)
+	if obj == nil {
+		t.errorf(call.Pos(), Instantiation, "could not find Object for %q", qid)
+		return
 	}
 
-	if instIdent == nil {
-		var err error
-		instIdent, err = t.instantiateFunction(qid, argList, typeList)
+	inst := t.findInstantiation(obj, typeList)
+	if inst == nil {
+		decl, err := t.instantiateFunction(qid, argList, typeList)
 		if err != nil {
-			t.err = err
+			t.addError(call.Pos(), Instantiation, err)
 			return
 		}
 
-		n := &instantiation{
+		inst = &instantiation{
 			types: typeList,
-			decl:  instIdent,
+			decl:  decl,
+			pkg:   t.tpkg,
+		}
+		t.instantiations[obj] = append(t.instantiations[obj], inst)
+		if t.export {
+			t.importer.addInstantiation(obj, inst)
 		}
-		t.instantiations[key] = append(instantiations, n)
 	}
+	t.addRequest(obj, typeList, inst.pkg)
+	instIdent := t.instantiationIdent(inst.pkg, inst.decl, call.Fun.Pos())
 
 	if typeArgs {
 		*pe = instIdent
@@ -653,24 +786,26 @@ func (t *translator) translateFunctionInstantiation(pe *ast.Expr) {
 // translateTypeInstantiation translates an instantiated type to Go 1.
 func (t *translator) translateTypeInstantiation(pe *ast.Expr) {
 	call := (*pe).(*ast.CallExpr)
-	qid := t.instantiatedIdent(call)
+	qid, ok := t.instantiatedIdent(call)
+	if !ok {
+		return
+	}
 	typ := t.lookupType(call.Fun).(*types.Named)
 	argList, typeList, typeArgs := t.instantiationTypes(call)
 	if !typeArgs {
-		panic("no type arguments for type")
+		t.errorf(call.Pos(), Instantiation, "no type arguments for type %s", qid)
+		return
 	}
 
-	instantiations := t.typeInstantiations[typ]
-	for _, inst := range instantiations {
-		if t.sameTypes(typeList, inst.types) {
-			*pe = inst.decl
-			return
-		}
+	if inst := t.findTypeInstantiation(typ, typeList); inst != nil {
+		t.addRequest(typ.Obj(), typeList, inst.pkg)
+		*pe = t.instantiationIdent(inst.pkg, inst.decl, call.Fun.Pos())
+		return
 	}
 
 	instIdent, instType, err := t.instantiateTypeDecl(qid, typ, argList, typeList)
 	if err != nil {
-		t.err = err
+		t.addError(call.Pos(), Instantiation, err)
 		return
 	}
 
@@ -678,24 +813,29 @@ func (t *translator) translateTypeInstantiation(pe *ast.Expr) {
 		types: typeList,
 		decl:  instIdent,
 		typ:   instType,
+		pkg:   t.tpkg,
+	}
+	t.typeInstantiations[typ] = append(t.typeInstantiations[typ], n)
+	if t.export {
+		t.importer.addTypeInstantiation(typ, n)
 	}
-	t.typeInstantiations[typ] = append(instantiations, n)
+	t.addRequest(typ.Obj(), typeList, t.tpkg)
 
-	*pe = instIdent
+	*pe = t.instantiationIdent(t.tpkg, instIdent, call.Fun.Pos())
 }
 
 // instantiatedIdent returns the qualified identifer that is being
-// instantiated.
-func (t *translator) instantiatedIdent(call *ast.CallExpr) qualifiedIdent {
+// instantiated. It reports whether the identifier was found.
+func (t *translator) instantiatedIdent(call *ast.CallExpr) (qualifiedIdent, bool) {
 	switch fun := call.Fun.(type) {
 	case *ast.Ident:
-		return qualifiedIdent{ident: fun}
+		return qualifiedIdent{ident: fun}, true
 	case *ast.SelectorExpr:
 		pkgname, ok := fun.X.(*ast.Ident)
 		if !ok {
 			break
 		}
-		pkgobj, ok := t.importer.info.Uses[pkgname]
+		pkgobj, ok := t.importer.info.use(pkgname)
 		if !ok {
 			break
 		}
@@ -703,23 +843,25 @@ func (t *translator) instantiatedIdent(call *ast.CallExpr) qualifiedIdent {
 		if !ok {
 			break
 		}
-		return qualifiedIdent{pkg: pn.Imported(), ident: fun.Sel}
+		return qualifiedIdent{pkg: pn.Imported(), ident: fun.Sel}, true
 	}
-	panic(fmt.Sprintf("instantiated object %T %v is not an identifier", call.Fun, call.Fun))
+	t.errorf(call.Fun.Pos(), Unsupported, "instantiated object %T %v is not an identifier", call.Fun, call.Fun)
+	return qualifiedIdent{}, false
 }
 
 // instantiationTypes returns the type arguments of an instantiation.
 // It also returns the AST arguments if they are present.
 // The typeArgs result reports whether the AST arguments are types.
 func (t *translator) instantiationTypes(call *ast.CallExpr) (argList []ast.Expr, typeList []types.Type, typeArgs bool) {
-	inferred, haveInferred := t.importer.info.Inferred[call]
+	inferred, haveInferred := t.importer.info.inferred(call)
 
 	if !haveInferred {
 		argList = call.Args
 		typeList = make([]types.Type, 0, len(argList))
 		for _, arg := range argList {
 			if at := t.lookupType(arg); at == nil {
-				panic(fmt.Sprintf("%s: no type found for %T %v", t.fset.Position(arg.Pos()), arg, arg))
+				t.errorf(arg.Pos(), Internal, "no type found for %T %v", arg, arg)
+				typeList = append(typeList, types.Typ[types.Invalid])
 			} else {
 				typeList = append(typeList, at)
 			}
@@ -758,7 +900,8 @@ func (t *translator) lookupInstantiatedType(typ *types.Named) (types.Type, *ast.
 	name := typ.Obj().Name()
 	fields := strings.Split(name, ".")
 	if len(fields) > 2 {
-		panic(fmt.Sprintf("unparseable instantiated name %q", name))
+		t.errorf(typ.Obj().Pos(), Internal, "unparseable instantiated name %q", name)
+		return typ, nil
 	}
 	if len(fields) > 1 {
 		name = fields[1]
@@ -767,28 +910,96 @@ func (t *translator) lookupInstantiatedType(typ *types.Named) (types.Type, *ast.
 	tpkg := typ.Obj().Pkg()
 	nobj := tpkg.Scope().Lookup(name)
 	if nobj == nil {
-		panic(fmt.Sprintf("can't find %q in scope of package %q", name, tpkg.Name()))
+		t.errorf(typ.Obj().Pos(), Instantiation, "can't find %q in scope of package %q", name, tpkg.Name())
+		return typ, nil
 	}
 
 	targs := typ.TArgs()
-	instantiations := t.typeInstantiations[nobj.Type()]
-	for _, inst := range instantiations {
-		if t.sameTypes(targs, inst.types) {
-			newName := inst.decl.Name
-			nm := typ.NumMethods()
-			methods := make([]*types.Func, 0, nm)
-			for i := 0; i < nm; i++ {
-				methods = append(methods, typ.Method(i))
-			}
-			obj := typ.Obj()
-			obj = types.NewTypeName(obj.Pos(), obj.Pkg(), newName, nil)
-			nt := types.NewNamed(obj, typ.Underlying(), methods)
-			nt.SetTArgs(targs)
-			return nt, inst.decl
+	if inst := t.findTypeInstantiation(nobj.Type(), targs); inst != nil {
+		instIdent := t.instantiationIdent(inst.pkg, inst.decl, token.NoPos)
+		nm := typ.NumMethods()
+		methods := make([]*types.Func, 0, nm)
+		for i := 0; i < nm; i++ {
+			methods = append(methods, typ.Method(i))
+		}
+		obj := typ.Obj()
+		obj = types.NewTypeName(obj.Pos(), inst.pkg, inst.decl.Name, nil)
+		nt := types.NewNamed(obj, typ.Underlying(), methods)
+		nt.SetTArgs(targs)
+		return nt, instIdent
+	}
+
+	t.errorf(typ.Obj().Pos(), Instantiation, "did not find instantiation for %v %v", typ, typ.Underlying())
+	return typ, nil
+}
+
+// findInstantiation returns an existing instantiation of the
+// generic function obj with the type arguments typeList.
+// It returns nil if there is no such instantiation.
+func (t *translator) findInstantiation(obj types.Object, typeList []types.Type) *instantiation {
+	for _, inst := range t.instantiations[obj] {
+		if t.sameTypes(typeList, inst.types) {
+			return inst
+		}
+	}
+	for _, inst := range t.importer.lookupInstantiations(obj) {
+		if t.imports[inst.pkg.Path()] && t.sameInstTypes(typeList, inst.types, inst.keys) {
+			return inst
+		}
+	}
+	return nil
+}
+
+// findTypeInstantiation returns an existing instantiation of the
+// generic type typ with the type arguments typeList.
+// It returns nil if there is no such instantiation.
+func (t *translator) findTypeInstantiation(typ types.Type, typeList []types.Type) *typeInstantiation {
+	for _, inst := range t.typeInstantiations[typ] {
+		// Entries without a declaration only cache the
+		// results of instantiateType.
+		if inst.decl != nil && t.sameTypes(typeList, inst.types) {
+			return inst
+		}
+	}
+	for _, inst := range t.importer.lookupTypeInstantiations(typ) {
+		if t.imports[inst.pkg.Path()] && t.sameInstTypes(typeList, inst.types, inst.keys) {
+			return inst
 		}
 	}
+	return nil
+}
+
+// instantiationIdent returns an identifier at pos that refers to the
+// instantiation decl in pkg. An instantiation in another package
+// is referenced using the package name.
+func (t *translator) instantiationIdent(pkg *types.Package, decl *ast.Ident, pos token.Pos) *ast.Ident {
+	name := decl.Name
+	if pkg != nil && pkg != t.tpkg {
+		name = pkg.Name() + "." + name
+	}
+	id := &ast.Ident{NamePos: pos, Name: name}
+	if typ := t.lookupType(decl); typ != nil {
+		t.setType(id, typ)
+	}
+	return id
+}
 
-	panic(fmt.Sprintf("did not find instantiation for %v %v\n", typ, typ.Underlying()))
+// sameInstTypes reports whether typeList matches the type arguments
+// of an instantiation, given either as types or, for an instantiation
+// restored from the translation cache, as typeKeys.
+func (t *translator) sameInstTypes(typeList, instTypes []types.Type, keys []string) bool {
+	if instTypes == nil && keys != nil {
+		if len(typeList) != len(keys) {
+			return false
+		}
+		for i, key := range typeKeys(typeList) {
+			if key != keys[i] {
+				return false
+			}
+		}
+		return true
+	}
+	return t.sameTypes(typeList, instTypes)
 }
 
 // sameTypes reports whether two type slices are the same.
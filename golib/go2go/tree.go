@@ -0,0 +1,130 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package go2go
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RewriteTo translates the .go2 packages in dirs, and the .go2
+// packages that they import, directly or indirectly, and writes the
+// translations, with any hand-written .go files, into a tree of Go 1
+// sources under outdir. The files of the package with import path p
+// are written to outdir/src/p, so that the import paths in the
+// translated files refer to the translated packages. The Go 1
+// packages that they import from the main module or from GO2PATH are
+// copied into the tree as well, so that it holds every package but
+// those of the standard library and of other modules. The tree may be
+// built with GOPATH set to outdir, or vendored.
+//
+// Each of dirs must be in the main module or in GO2PATH, so that it has
+// an import path. The Importer must be one returned by NewImporterFS:
+// the source directories are left untouched. Files already in outdir
+// are replaced, but not removed.
+func RewriteTo(importer *Importer, dirs []string, outdir string) error {
+	if !importer.inMemory() {
+		return fmt.Errorf("RewriteTo: Importer not created by NewImporterFS")
+	}
+	for _, dir := range dirs {
+		importPath := importer.dirImportPath(dir)
+		if strings.HasPrefix(importPath, "_") {
+			return fmt.Errorf("cannot determine import path of %s: not in the main module or in GO2PATH", dir)
+		}
+		if _, err := importer.ImportFrom(importPath, dir, 0); err != nil {
+			return err
+		}
+	}
+
+	importer.mu.Lock()
+	pkgs := make(map[string]map[string][]byte)
+	translated := make(map[string]string)
+	for importPath, dir := range importer.translated {
+		dir = filepath.Clean(dir)
+		files := make(map[string][]byte)
+		for name, data := range importer.mem {
+			if filepath.Dir(name) == dir {
+				files[filepath.Base(name)] = data
+			}
+		}
+		pkgs[importPath] = files
+		translated[importPath] = dir
+	}
+	go1Dirs := make(map[string]string)
+	for importPath, dir := range importer.go1Dirs {
+		go1Dirs[importPath] = dir
+	}
+	importer.mu.Unlock()
+
+	// In memory, the translated files are kept next to the
+	// sources, which may include hand-written .go files.
+	for importPath, dir := range translated {
+		_, gofiles, err := importer.PackageFiles(dir)
+		if err != nil {
+			return err
+		}
+		copies, err := importer.handWrittenCopies(dir, gofiles)
+		if err != nil {
+			return err
+		}
+		for name, data := range copies {
+			pkgs[importPath][name] = data
+		}
+	}
+	for importPath, dir := range go1Dirs {
+		files, err := importer.readPackageFiles(dir)
+		if err != nil {
+			return err
+		}
+		pkgs[importPath] = files
+	}
+
+	// Write the packages in a fixed order, so that errors are
+	// reported consistently.
+	paths := make([]string, 0, len(pkgs))
+	for importPath := range pkgs {
+		paths = append(paths, importPath)
+	}
+	sort.Strings(paths)
+	for _, importPath := range paths {
+		tdir := filepath.Join(outdir, "src", filepath.FromSlash(importPath))
+		if err := os.MkdirAll(tdir, 0755); err != nil {
+			return err
+		}
+		for name, data := range pkgs[importPath] {
+			if err := ioutil.WriteFile(filepath.Join(tdir, name), data, 0644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readPackageFiles returns the contents of the files in the package
+// source directory dir, keyed by file name. Subdirectories, which hold
+// other packages, are skipped.
+func (imp *Importer) readPackageFiles(dir string) (map[string][]byte, error) {
+	names, err := imp.fs.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][]byte)
+	for _, name := range names {
+		filename := filepath.Join(dir, name)
+		if imp.isDir(filename) {
+			continue
+		}
+		data, err := imp.fs.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = data
+	}
+	return files, nil
+}
@@ -5,15 +5,15 @@
 package go2go
 
 import (
-	"fmt"
 	"github.com/tdakkota/go2go/golib/ast"
+	"github.com/tdakkota/go2go/golib/token"
 	"github.com/tdakkota/go2go/golib/types"
 )
 
 // lookupType returns the types.Type for an AST expression.
 // Returns nil if the type is not known.
 func (t *translator) lookupType(e ast.Expr) types.Type {
-	if typ, ok := t.importer.info.Types[e]; ok {
+	if typ, ok := t.importer.info.typeAndValue(e); ok {
 		return typ.Type
 	}
 	if typ, ok := t.types[e]; ok {
@@ -26,15 +26,15 @@ func (t *translator) lookupType(e ast.Expr) types.Type {
 // AST expressions created during function instantiation.
 // Uninstantiated AST expressions will be listed in t.importer.info.Types.
 func (t *translator) setType(e ast.Expr, nt types.Type) {
-	if ot, ok := t.importer.info.Types[e]; ok {
+	if ot, ok := t.importer.info.typeAndValue(e); ok {
 		if !types.Identical(ot.Type, nt) {
-			panic("expression type changed")
+			t.errorf(e.Pos(), Internal, "expression type changed from %v to %v", ot.Type, nt)
 		}
 		return
 	}
 	if ot, ok := t.types[e]; ok {
 		if !types.Identical(ot, nt) {
-			panic("expression type changed")
+			t.errorf(e.Pos(), Internal, "expression type changed from %v to %v", ot, nt)
 		}
 		return
 	}
@@ -200,7 +200,8 @@ func (t *translator) doInstantiateType(ta *typeArgs, typ types.Type) types.Type
 		}
 		return typ
 	default:
-		panic(fmt.Sprintf("unimplemented Type %T", typ))
+		t.errorf(token.NoPos, Unsupported, "unimplemented Type %T", typ)
+		return typ
 	}
 }
 
@@ -0,0 +1,153 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package go2go
+
+import (
+	"fmt"
+	"github.com/tdakkota/go2go/golib/ast"
+	"github.com/tdakkota/go2go/golib/token"
+	"github.com/tdakkota/go2go/golib/types"
+	"sort"
+	"strings"
+)
+
+// An Analyzer checks a type checked .go2 package for likely mistakes.
+// Analyzers see the code as written, with generic functions and types
+// and their type parameters, rather than the translated code.
+type Analyzer struct {
+	// Name is the name of the analyzer, a short lower case word.
+	Name string
+
+	// Doc describes what the analyzer reports, in a sentence.
+	Doc string
+
+	// Run reports the problems found in the package of pass.
+	Run func(pass *Pass)
+}
+
+// A Pass holds a package being analyzed by an Analyzer.
+type Pass struct {
+	Analyzer  *Analyzer
+	Fset      *token.FileSet
+	Files     []*ast.File
+	Pkg       *types.Package
+	TypesInfo *types.Info
+
+	diags *[]Diagnostic
+}
+
+// Reportf reports a problem at pos.
+func (pass *Pass) Reportf(pos token.Pos, format string, args ...interface{}) {
+	*pass.diags = append(*pass.diags, Diagnostic{
+		Pos:      pass.Fset.Position(pos),
+		Analyzer: pass.Analyzer.Name,
+		Msg:      fmt.Sprintf(format, args...),
+	})
+}
+
+// A Diagnostic is a problem reported by an Analyzer,
+// at a position in a .go2 file.
+type Diagnostic struct {
+	Pos      token.Position
+	Analyzer string
+	Msg      string
+}
+
+// String returns the diagnostic in the usual form,
+// file:line:column: message.
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s", d.Pos, d.Msg)
+}
+
+// Analyzers is the list of analyzers run by go2go vet.
+var Analyzers = []*Analyzer{
+	PrintfAnalyzer,
+	ShadowAnalyzer,
+	UnreachableAnalyzer,
+	UnusedResultAnalyzer,
+}
+
+// Vet type checks the .go2 files in dir, with the hand-written .go
+// files, including test files, and runs the analyzers over each
+// package found. It returns the problems
+// reported, sorted by position. The files are not translated, though
+// the .go2 packages that they import are, as for Rewrite.
+func Vet(importer *Importer, dir string, analyzers []*Analyzer) ([]Diagnostic, error) {
+	go2files, gofiles, err := importer.PackageFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	pkgs, err := parseFiles(importer, dir, go2files, gofiles, fset)
+	if err != nil {
+		return nil, err
+	}
+
+	var diags []Diagnostic
+	for _, pkg := range pkgs {
+		names := make([]string, 0, len(pkg.Files))
+		for name := range pkg.Files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		asts := make([]*ast.File, 0, len(names))
+		for _, name := range names {
+			asts = append(asts, pkg.Files[name])
+		}
+
+		var merr multiErr
+		conf := types.Config{
+			Importer: importer.forStack(nil, dir),
+			Error:    merr.add,
+		}
+		info := &types.Info{
+			Types:      make(map[ast.Expr]types.TypeAndValue),
+			Inferred:   make(map[*ast.CallExpr]types.Inferred),
+			Defs:       make(map[*ast.Ident]types.Object),
+			Uses:       make(map[*ast.Ident]types.Object),
+			Implicits:  make(map[ast.Node]types.Object),
+			Selections: make(map[*ast.SelectorExpr]*types.Selection),
+			Scopes:     make(map[ast.Node]*types.Scope),
+		}
+		tpkg, err := conf.Check(pkg.Name, fset, asts, info)
+		if err != nil {
+			return nil, fmt.Errorf("type checking failed for %s\n%v", pkg.Name, merr)
+		}
+
+		for _, a := range analyzers {
+			a.Run(&Pass{
+				Analyzer:  a,
+				Fset:      fset,
+				Files:     asts,
+				Pkg:       tpkg,
+				TypesInfo: info,
+				diags:     &diags,
+			})
+		}
+	}
+
+	sort.SliceStable(diags, func(i, j int) bool {
+		p, q := &diags[i].Pos, &diags[j].Pos
+		if p.Filename != q.Filename {
+			return p.Filename < q.Filename
+		}
+		if p.Line != q.Line {
+			return p.Line < q.Line
+		}
+		return p.Column < q.Column
+	})
+	return diags, nil
+}
+
+// LookupAnalyzer returns the analyzer in Analyzers named name,
+// or nil if there is none.
+func LookupAnalyzer(name string) *Analyzer {
+	for _, a := range Analyzers {
+		if a.Name == strings.ToLower(name) {
+			return a
+		}
+	}
+	return nil
+}
@@ -0,0 +1,587 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package go2go
+
+import (
+	"github.com/tdakkota/go2go/golib/ast"
+	"github.com/tdakkota/go2go/golib/constant"
+	"github.com/tdakkota/go2go/golib/token"
+	"github.com/tdakkota/go2go/golib/types"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The analyzers run by go2go vet.
+
+// PrintfAnalyzer checks calls of printf-like functions.
+var PrintfAnalyzer = &Analyzer{
+	Name: "printf",
+	Doc:  "check that the arguments of printf-like calls match the format, and that print-like calls have no format",
+	Run:  runPrintf,
+}
+
+// ShadowAnalyzer checks for shadowed variables.
+var ShadowAnalyzer = &Analyzer{
+	Name: "shadow",
+	Doc:  "check for variables that shadow a variable of the same type that is used after the shadowing scope",
+	Run:  runShadow,
+}
+
+// UnreachableAnalyzer checks for unreachable code.
+var UnreachableAnalyzer = &Analyzer{
+	Name: "unreachable",
+	Doc:  "check for statements that follow a return, panic or branch statement",
+	Run:  runUnreachable,
+}
+
+// UnusedResultAnalyzer checks for unused results of calls to
+// functions without side effects.
+var UnusedResultAnalyzer = &Analyzer{
+	Name: "unusedresult",
+	Doc:  "check for unused results of calls to functions such as fmt.Sprintf and methods such as String",
+	Run:  runUnusedResult,
+}
+
+// callee returns the function or method called by call,
+// or nil if it is not a declared function.
+func callee(info *types.Info, call *ast.CallExpr) *types.Func {
+	fun := unparen(call.Fun)
+	// A generic function may be instantiated explicitly.
+	if inst, ok := fun.(*ast.CallExpr); ok {
+		if tv, ok := info.Types[inst.Fun]; ok && tv.IsValue() {
+			if _, ok := tv.Type.(*types.Signature); ok {
+				fun = unparen(inst.Fun)
+			}
+		}
+	}
+	var id *ast.Ident
+	switch fun := fun.(type) {
+	case *ast.Ident:
+		id = fun
+	case *ast.SelectorExpr:
+		id = fun.Sel
+	default:
+		return nil
+	}
+	fn, _ := info.Uses[id].(*types.Func)
+	return fn
+}
+
+// funcName returns the name of fn, called by call, as used in
+// diagnostics, such as fmt.Sprintf or (*pkg.List).Len. The type
+// parameters of the receiver of a method are omitted. The receiver
+// of a method of a type parameter is the type parameter bound, whose
+// name is internal to the type checker; such a method is named as
+// written in call, such as x.String.
+func funcName(info *types.Info, call *ast.CallExpr, fn *types.Func) string {
+	recv := fn.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return fn.FullName()
+	}
+	if sel, ok := unparen(call.Fun).(*ast.SelectorExpr); ok {
+		if tv, ok := info.Types[sel.X]; ok && isTypeParam(tv.Type) {
+			return types.ExprString(sel)
+		}
+	}
+	typ, ptr := recv.Type(), ""
+	if p, ok := typ.(*types.Pointer); ok {
+		typ, ptr = p.Elem(), "*"
+	}
+	named, ok := typ.(*types.Named)
+	if !ok {
+		return fn.FullName()
+	}
+	obj := named.Obj()
+	name := obj.Name()
+	if obj.Pkg() != nil {
+		name = obj.Pkg().Name() + "." + name
+	}
+	return "(" + ptr + name + ")." + fn.Name()
+}
+
+// isTypeParam reports whether typ is a type parameter,
+// or a pointer to a type parameter.
+func isTypeParam(typ types.Type) bool {
+	if p, ok := typ.(*types.Pointer); ok {
+		typ = p.Elem()
+	}
+	_, ok := typ.(*types.TypeParam)
+	return ok
+}
+
+// unparen returns e with any enclosing parentheses stripped.
+func unparen(e ast.Expr) ast.Expr {
+	for {
+		p, ok := e.(*ast.ParenExpr)
+		if !ok {
+			return e
+		}
+		e = p.X
+	}
+}
+
+var (
+	// printfFuncs are the functions of package fmt that take a format.
+	printfFuncs = map[string]bool{
+		"Errorf":  true,
+		"Fprintf": true,
+		"Printf":  true,
+		"Sprintf": true,
+	}
+
+	// printFuncs are the functions of package fmt that do not.
+	printFuncs = map[string]bool{
+		"Fprint":   true,
+		"Fprintln": true,
+		"Print":    true,
+		"Println":  true,
+		"Sprint":   true,
+		"Sprintln": true,
+	}
+)
+
+// printfKind reports whether fn is printf-like, print-like, or
+// neither. A function is also printf-like if its name ends in f,
+// and its last parameters are a string and ...interface{}, and
+// print-like if its name ends in ln and its last parameter is
+// ...interface{}. For a printf-like function, printfKind returns
+// the index of the format parameter.
+func printfKind(fn *types.Func) (printf, print bool, format int) {
+	sig := fn.Type().(*types.Signature)
+	params := sig.Params()
+	if fn.Pkg() != nil && fn.Pkg().Path() == "fmt" && sig.Recv() == nil {
+		switch {
+		case printfFuncs[fn.Name()]:
+			return true, false, params.Len() - 2
+		case printFuncs[fn.Name()]:
+			return false, true, 0
+		}
+		return false, false, 0
+	}
+	if !sig.Variadic() {
+		return false, false, 0
+	}
+	last, ok := params.At(params.Len() - 1).Type().(*types.Slice)
+	if !ok {
+		return false, false, 0
+	}
+	if it, ok := last.Elem().Underlying().(*types.Interface); !ok || !it.Empty() {
+		return false, false, 0
+	}
+	switch {
+	case strings.HasSuffix(fn.Name(), "f") && params.Len() >= 2:
+		if b, ok := params.At(params.Len() - 2).Type().(*types.Basic); ok && b.Kind() == types.String {
+			return true, false, params.Len() - 2
+		}
+	case strings.HasSuffix(fn.Name(), "ln"):
+		return false, true, 0
+	}
+	return false, false, 0
+}
+
+func runPrintf(pass *Pass) {
+	for _, f := range pass.Files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || call.Ellipsis.IsValid() {
+				return true
+			}
+			fn := callee(pass.TypesInfo, call)
+			if fn == nil {
+				return true
+			}
+			printf, print, format := printfKind(fn)
+			switch {
+			case printf:
+				checkPrintf(pass, call, fn, format)
+			case print:
+				checkPrint(pass, call, fn)
+			}
+			return true
+		})
+	}
+}
+
+// checkPrintf checks that the arguments of a call of the printf-like
+// function fn match the format, the argument at index format.
+func checkPrintf(pass *Pass, call *ast.CallExpr, fn *types.Func, format int) {
+	if format >= len(call.Args) {
+		return
+	}
+	tv, ok := pass.TypesInfo.Types[call.Args[format]]
+	if !ok || tv.Value == nil || tv.Value.Kind() != constant.String {
+		return
+	}
+	s := constant.StringVal(tv.Value)
+	nargs := len(call.Args) - format - 1
+
+	verbs := 0
+	hasVerbs := false
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			continue
+		}
+		i++
+		if i < len(s) && s[i] == '%' {
+			continue
+		}
+		hasVerbs = true
+		for i < len(s) && strings.IndexByte("+-# 0", s[i]) >= 0 {
+			i++
+		}
+		// Explicit argument indexes are not checked.
+		if i < len(s) && s[i] == '[' {
+			return
+		}
+		for _, precision := range []bool{false, true} {
+			if precision {
+				if i >= len(s) || s[i] != '.' {
+					break
+				}
+				i++
+			}
+			if i < len(s) && s[i] == '*' {
+				verbs++
+				i++
+				continue
+			}
+			for i < len(s) && '0' <= s[i] && s[i] <= '9' {
+				i++
+			}
+		}
+		if i >= len(s) {
+			pass.Reportf(call.Pos(), "%s format %s is missing verb at end of string", funcName(pass.TypesInfo, call, fn), strconv.Quote(s))
+			return
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size - 1
+		verbs++
+		if verbs > nargs {
+			pass.Reportf(call.Pos(), "%s format %s reads arg #%d, but call has %s", funcName(pass.TypesInfo, call, fn), strconv.Quote(s), verbs, count(nargs, "arg"))
+			return
+		}
+	}
+	switch {
+	case !hasVerbs && nargs > 0:
+		pass.Reportf(call.Pos(), "%s call has arguments but no formatting directives", funcName(pass.TypesInfo, call, fn))
+	case verbs < nargs:
+		pass.Reportf(call.Pos(), "%s call needs %s but has %s", funcName(pass.TypesInfo, call, fn), count(verbs, "arg"), count(nargs, "arg"))
+	}
+}
+
+// checkPrint checks that a call of the print-like function fn
+// has no format.
+func checkPrint(pass *Pass, call *ast.CallExpr, fn *types.Func) {
+	for _, arg := range call.Args {
+		tv, ok := pass.TypesInfo.Types[arg]
+		if !ok || tv.Value == nil || tv.Value.Kind() != constant.String {
+			continue
+		}
+		s := constant.StringVal(tv.Value)
+		if i := strings.IndexByte(s, '%'); i >= 0 && i+1 < len(s) && strings.IndexByte("bcdefgopqstvxEFGTUX", s[i+1]) >= 0 {
+			pass.Reportf(call.Pos(), "%s call has possible formatting directive %s", funcName(pass.TypesInfo, call, fn), s[i:i+2])
+			return
+		}
+	}
+}
+
+// count returns n things, such as "1 arg" or "2 args".
+func count(n int, thing string) string {
+	if n == 1 {
+		return "1 " + thing
+	}
+	return strconv.Itoa(n) + " " + thing + "s"
+}
+
+func runShadow(pass *Pass) {
+	info := pass.TypesInfo
+
+	// Record where each variable is used.
+	uses := make(map[types.Object][]token.Pos)
+	for id, obj := range info.Uses {
+		if _, ok := obj.(*types.Var); ok {
+			uses[obj] = append(uses[obj], id.Pos())
+		}
+	}
+
+	check := func(id *ast.Ident, rhs ast.Expr) {
+		obj, ok := info.Defs[id].(*types.Var)
+		if !ok || id.Name == "_" || obj.Parent() == nil || obj.Parent().Parent() == nil {
+			return
+		}
+		_, shadowed := obj.Parent().Parent().LookupParent(id.Name, id.Pos())
+		svar, ok := shadowed.(*types.Var)
+		if !ok || svar.Pkg() != pass.Pkg || svar.Parent() == types.Universe {
+			return
+		}
+		// x := x is a common way to make a copy.
+		if rid, ok := unparen(rhs).(*ast.Ident); ok && info.Uses[rid] == svar {
+			return
+		}
+		if !types.Identical(obj.Type(), svar.Type()) {
+			return
+		}
+		// Only report a shadowed variable that is used
+		// after the shadowing scope, where the shadowing
+		// declaration might have meant to set it.
+		end := obj.Parent().End()
+		for _, pos := range uses[svar] {
+			if pos > end {
+				pass.Reportf(id.Pos(), "declaration of %q shadows declaration at line %d", id.Name, pass.Fset.Position(svar.Pos()).Line)
+				return
+			}
+		}
+	}
+
+	for _, f := range pass.Files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.AssignStmt:
+				if n.Tok != token.DEFINE {
+					break
+				}
+				for i, lhs := range n.Lhs {
+					id, ok := lhs.(*ast.Ident)
+					if !ok {
+						continue
+					}
+					var rhs ast.Expr
+					if len(n.Lhs) == len(n.Rhs) {
+						rhs = n.Rhs[i]
+					}
+					check(id, rhs)
+				}
+			case *ast.DeclStmt:
+				gen, ok := n.Decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.VAR {
+					break
+				}
+				for _, spec := range gen.Specs {
+					vs := spec.(*ast.ValueSpec)
+					for i, id := range vs.Names {
+						var rhs ast.Expr
+						if len(vs.Names) == len(vs.Values) {
+							rhs = vs.Values[i]
+						}
+						check(id, rhs)
+					}
+				}
+			}
+			return true
+		})
+	}
+}
+
+func runUnreachable(pass *Pass) {
+	u := &unreachable{pass: pass}
+	for _, f := range pass.Files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.BlockStmt:
+				u.list(n.List)
+			case *ast.CaseClause:
+				u.list(n.Body)
+			case *ast.CommClause:
+				u.list(n.Body)
+			}
+			return true
+		})
+	}
+}
+
+// unreachable finds unreachable statements.
+type unreachable struct {
+	pass *Pass
+}
+
+// list reports the first unreachable statement in list, if any.
+// A labeled statement may be the target of a goto, so it is
+// reachable, as is an empty statement, which does nothing.
+func (u *unreachable) list(list []ast.Stmt) {
+	reachable := true
+	for _, s := range list {
+		switch s.(type) {
+		case *ast.LabeledStmt:
+			reachable = true
+		case *ast.EmptyStmt:
+			continue
+		}
+		if !reachable {
+			u.pass.Reportf(s.Pos(), "unreachable code")
+			return
+		}
+		if u.terminates(s, "") {
+			reachable = false
+		}
+		if b, ok := s.(*ast.BranchStmt); ok && (b.Tok == token.BREAK || b.Tok == token.CONTINUE) {
+			reachable = false
+		}
+	}
+}
+
+// terminates reports whether s is a terminating statement, as
+// defined by the spec. If s is labeled, label is the label name.
+func (u *unreachable) terminates(s ast.Stmt, label string) bool {
+	switch s := s.(type) {
+	case *ast.LabeledStmt:
+		return u.terminates(s.Stmt, s.Label.Name)
+
+	case *ast.ExprStmt:
+		if call, ok := unparen(s.X).(*ast.CallExpr); ok {
+			if id, ok := unparen(call.Fun).(*ast.Ident); ok {
+				if b, ok := u.pass.TypesInfo.Uses[id].(*types.Builtin); ok && b.Name() == "panic" {
+					return true
+				}
+			}
+		}
+
+	case *ast.ReturnStmt:
+		return true
+
+	case *ast.BranchStmt:
+		return s.Tok == token.GOTO || s.Tok == token.FALLTHROUGH
+
+	case *ast.BlockStmt:
+		return u.terminatesList(s.List, "")
+
+	case *ast.IfStmt:
+		return s.Else != nil && u.terminates(s.Body, "") && u.terminates(s.Else, "")
+
+	case *ast.SwitchStmt:
+		return u.terminatesSwitch(s.Body, label)
+
+	case *ast.TypeSwitchStmt:
+		return u.terminatesSwitch(s.Body, label)
+
+	case *ast.SelectStmt:
+		for _, s := range s.Body.List {
+			cc := s.(*ast.CommClause)
+			if !u.terminatesList(cc.Body, "") || vetHasBreakList(cc.Body, label, true) {
+				return false
+			}
+		}
+		return true
+
+	case *ast.ForStmt:
+		return s.Cond == nil && !vetHasBreak(s.Body, label, true)
+	}
+	return false
+}
+
+func (u *unreachable) terminatesList(list []ast.Stmt, label string) bool {
+	for i := len(list) - 1; i >= 0; i-- {
+		if _, ok := list[i].(*ast.EmptyStmt); !ok {
+			return u.terminates(list[i], label)
+		}
+	}
+	return false
+}
+
+func (u *unreachable) terminatesSwitch(body *ast.BlockStmt, label string) bool {
+	hasDefault := false
+	for _, s := range body.List {
+		cc := s.(*ast.CaseClause)
+		if cc.List == nil {
+			hasDefault = true
+		}
+		if !u.terminatesList(cc.Body, "") || vetHasBreakList(cc.Body, label, true) {
+			return false
+		}
+	}
+	return hasDefault
+}
+
+// vetHasBreak reports whether s is or contains a break statement
+// referring to the statement labeled label or, if implicit is set,
+// to the closest enclosing breakable statement.
+func vetHasBreak(s ast.Stmt, label string, implicit bool) bool {
+	switch s := s.(type) {
+	case *ast.LabeledStmt:
+		return vetHasBreak(s.Stmt, label, implicit)
+	case *ast.BranchStmt:
+		if s.Tok == token.BREAK {
+			if s.Label == nil {
+				return implicit
+			}
+			return s.Label.Name == label
+		}
+	case *ast.BlockStmt:
+		return vetHasBreakList(s.List, label, implicit)
+	case *ast.IfStmt:
+		return vetHasBreak(s.Body, label, implicit) || s.Else != nil && vetHasBreak(s.Else, label, implicit)
+	case *ast.CaseClause:
+		return vetHasBreakList(s.Body, label, implicit)
+	case *ast.CommClause:
+		return vetHasBreakList(s.Body, label, implicit)
+	case *ast.SwitchStmt:
+		return label != "" && vetHasBreak(s.Body, label, false)
+	case *ast.TypeSwitchStmt:
+		return label != "" && vetHasBreak(s.Body, label, false)
+	case *ast.SelectStmt:
+		return label != "" && vetHasBreak(s.Body, label, false)
+	case *ast.ForStmt:
+		return label != "" && vetHasBreak(s.Body, label, false)
+	case *ast.RangeStmt:
+		return label != "" && vetHasBreak(s.Body, label, false)
+	}
+	return false
+}
+
+func vetHasBreakList(list []ast.Stmt, label string, implicit bool) bool {
+	for _, s := range list {
+		if vetHasBreak(s, label, implicit) {
+			return true
+		}
+	}
+	return false
+}
+
+// unusedFuncs are the functions whose results should be used.
+var unusedFuncs = map[string]bool{
+	"context.WithCancel":   true,
+	"context.WithDeadline": true,
+	"context.WithTimeout":  true,
+	"context.WithValue":    true,
+	"errors.New":           true,
+	"fmt.Errorf":           true,
+	"fmt.Sprint":           true,
+	"fmt.Sprintf":          true,
+	"fmt.Sprintln":         true,
+	"sort.Reverse":         true,
+}
+
+func runUnusedResult(pass *Pass) {
+	for _, f := range pass.Files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			es, ok := n.(*ast.ExprStmt)
+			if !ok {
+				return true
+			}
+			call, ok := unparen(es.X).(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			fn := callee(pass.TypesInfo, call)
+			if fn == nil {
+				return true
+			}
+			sig := fn.Type().(*types.Signature)
+			if sig.Recv() == nil {
+				if fn.Pkg() != nil && unusedFuncs[fn.Pkg().Path()+"."+fn.Name()] {
+					pass.Reportf(call.Pos(), "result of %s call not used", funcName(pass.TypesInfo, call, fn))
+				}
+				return true
+			}
+			// A String or Error method only computes a string.
+			if (fn.Name() == "String" || fn.Name() == "Error") && sig.Params().Len() == 0 && sig.Results().Len() == 1 {
+				if b, ok := sig.Results().At(0).Type().(*types.Basic); ok && b.Kind() == types.String {
+					pass.Reportf(call.Pos(), "result of %s call not used", funcName(pass.TypesInfo, call, fn))
+				}
+			}
+			return true
+		})
+	}
+}
@@ -786,11 +786,12 @@ func (p *parser) parseDotsType() *ast.Ellipsis {
 }
 
 type field struct {
-	name *ast.Ident
-	typ  ast.Expr
+	name     *ast.Ident
+	typ      ast.Expr
+	contract bool // typ is a contract expression constraining earlier type parameters
 }
 
-func (p *parser) parseParamDeclOrNil() (f field) {
+func (p *parser) parseParamDeclOrNil(mode paramMode) (f field) {
 	if p.trace {
 		defer un(trace(p, "ParamDeclOrNil"))
 	}
@@ -798,6 +799,16 @@ func (p *parser) parseParamDeclOrNil() (f field) {
 	switch p.tok {
 	case token.IDENT:
 		f.name = p.parseIdent()
+		if mode&contractsOk != 0 && (p.tok == token.LPAREN || p.tok == token.PERIOD) {
+			// contract expression: [PackageName "."] ContractName "(" TypeList ")"
+			if p.tok == token.LPAREN {
+				p.resolve(f.name)
+			}
+			f.typ = p.parseTypeInstance(p.parseTypeName(f.name))
+			f.name = nil
+			f.contract = true
+			break
+		}
 		switch p.tok {
 		case token.IDENT, token.MUL, token.ARROW, token.FUNC, token.CHAN, token.MAP, token.STRUCT, token.INTERFACE, token.LPAREN:
 			// name type
@@ -840,12 +851,23 @@ func (p *parser) parseParameterList(scope *ast.Scope, mode paramMode) (params []
 	pos := p.pos
 	var list []field
 	var named int // number of parameters that have an explicit name and type
+	var contracts int
 
 	for p.tok != token.RPAREN && p.tok != token.EOF {
-		par := p.parseParamDeclOrNil()
+		// In a type parameter list, once a type parameter has a
+		// bound, an identifier followed by "(" or "." starts a
+		// contract expression rather than a type parameter name
+		// with a parenthesized bound.
+		m := mode
+		if named == 0 {
+			m &^= contractsOk
+		}
+		par := p.parseParamDeclOrNil(m)
 		if par.name != nil || par.typ != nil {
 			list = append(list, par)
-			if par.name != nil && par.typ != nil {
+			if par.contract {
+				contracts++
+			} else if par.name != nil && par.typ != nil {
 				named++
 			}
 		}
@@ -869,12 +891,14 @@ func (p *parser) parseParameterList(scope *ast.Scope, mode paramMode) (params []
 				par.name = nil
 			}
 		}
-	} else if named != len(list) {
+	} else if named+contracts != len(list) {
 		// some named => all must be named
 		ok := true
 		var typ ast.Expr
 		for i := len(list) - 1; i >= 0; i-- {
-			if par := &list[i]; par.typ != nil {
+			if par := &list[i]; par.contract {
+				continue
+			} else if par.typ != nil {
 				typ = par.typ
 				if par.name == nil {
 					ok = false
@@ -918,6 +942,14 @@ func (p *parser) parseParameterList(scope *ast.Scope, mode paramMode) (params []
 		names = nil
 	}
 	for _, par := range list {
+		if par.contract {
+			if len(names) > 0 {
+				addParams()
+			}
+			typ = nil
+			params = append(params, &ast.Field{Type: par.typ})
+			continue
+		}
 		if par.typ != typ {
 			if len(names) > 0 {
 				addParams()
@@ -938,11 +970,13 @@ func (p *parser) parseTypeParams(scope *ast.Scope) *ast.FieldList {
 	}
 
 	p.expect(token.TYPE)
-	fields := p.parseParameterList(scope, 0)
+	fields := p.parseParameterList(scope, contractsOk)
 	// determine which form we have (list of type parameters with optional
-	// contract, or type parameters, all with interfaces as type bounds)
+	// contract, or type parameters, all with interfaces as type bounds);
+	// a field without names that is not an identifier is a contract
+	// expression constraining type parameters declared before it
 	for _, f := range fields {
-		if len(f.Names) == 0 {
+		if _, isIdent := f.Type.(*ast.Ident); len(f.Names) == 0 && isIdent {
 			assert(f.Type != nil, "expected non-nil type")
 			f.Names = []*ast.Ident{f.Type.(*ast.Ident)}
 			f.Type = nil
@@ -957,6 +991,7 @@ type paramMode int
 const (
 	typeParamsOk paramMode = 1 << iota
 	variadicOk
+	contractsOk
 )
 
 func (p *parser) parseParameters(scope *ast.Scope, mode paramMode, context string) (tparams, params *ast.FieldList) {
@@ -79,6 +79,9 @@ var valids = []string{
 	`package p; func (T) _(type A, B)(a A) B`,
 	`package p; func (T) _(type A, B C)(a A) B`,
 	`package p; func (T) _(type A, B C(A, B))(a A) B`,
+	`package p; func _(type A, B C1(A), C2(B))(a A) B`,
+	`package p; func _(type A C1, B C2(A, B), q.C3(A, int))(a A) B`,
+	`package p; type _(type A, B C(A, B), D([]A, *B)) struct{}`,
 	`package p; type _ interface { _(type A, B)(a A) B }`,
 	`package p; type _ interface { _(type A, B C)(a A) B }`,
 	`package p; type _ interface { _(type A, B C(A, B))(a A) B }`,
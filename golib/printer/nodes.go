@@ -366,7 +366,14 @@ func (p *printer) parameters(isTypeParam bool, fields *ast.FieldList) {
 			}
 			// parameter type
 			if par.Type != nil {
-				p.expr(stripParensAlways(par.Type))
+				typ := stripParensAlways(par.Type)
+				if _, ok := typ.(*ast.CallExpr); ok && len(par.Names) == 0 && !isTypeParam {
+					// An unnamed parameter of instantiated type T(A)
+					// must stay parenthesized; (T(A)) would declare
+					// parameter T of type A.
+					typ = &ast.ParenExpr{Lparen: par.Type.Pos(), X: typ, Rparen: par.Type.End() - 1}
+				}
+				p.expr(typ)
 			}
 			prevLine = parLineEnd
 		}
@@ -421,6 +428,21 @@ func identListSize(list []*ast.Ident, maxSize int) (size int) {
 }
 
 func (p *printer) isOneLineFieldList(list []*ast.Field) bool {
+	if len(list) > 1 && isTypeList(list) {
+		// a single list of types in an interface
+		const maxSize = 30
+		size := len("type")
+		for _, f := range list {
+			if f.Comment != nil {
+				return false
+			}
+			size += 2 + p.nodeSize(f.Type, maxSize) // blank or ", " before type
+			if size > maxSize {
+				return false
+			}
+		}
+		return true
+	}
 	if len(list) != 1 {
 		return false // allow only one field
 	}
@@ -438,6 +460,20 @@ func (p *printer) isOneLineFieldList(list []*ast.Field) bool {
 	return namesSize+typeSize <= maxSize
 }
 
+// isTypeList reports whether the interface fields in list are
+// the types of a single type list, which share one "type" name.
+func isTypeList(list []*ast.Field) bool {
+	if len(list[0].Names) != 1 || list[0].Names[0].Name != "type" {
+		return false
+	}
+	for _, f := range list[1:] {
+		if len(f.Names) != 1 || f.Names[0] != list[0].Names[0] {
+			return false
+		}
+	}
+	return true
+}
+
 func (p *printer) setLineComment(text string) {
 	p.setComment(&ast.CommentGroup{List: []*ast.Comment{{Slash: token.NoPos, Text: text}}})
 }
@@ -448,6 +484,11 @@ func (p *printer) fieldList(fields *ast.FieldList, isStruct, isIncomplete bool)
 	rbrace := fields.Closing
 	hasComments := isIncomplete || p.commentBefore(p.posFor(rbrace))
 	srcIsOneLine := lbrace.IsValid() && rbrace.IsValid() && p.lineFor(lbrace) == p.lineFor(rbrace)
+	if len(list) == 0 && !lbrace.IsValid() && !rbrace.IsValid() {
+		// a synthesized empty struct/interface has no
+		// source line breaks to preserve
+		srcIsOneLine = true
+	}
 
 	if !hasComments && srcIsOneLine {
 		// possibly a one-line struct/interface
@@ -478,9 +519,14 @@ func (p *printer) fieldList(fields *ast.FieldList, isStruct, isIncomplete bool)
 					name := f.Names[0] // "type" or method name
 					p.expr(name)
 					if name.Name == "type" {
-						// type list type
+						// type list types
 						p.print(blank)
-						p.expr(f.Type)
+						for i, f := range list {
+							if i > 0 {
+								p.print(token.COMMA, blank)
+							}
+							p.expr(f.Type)
+						}
 					} else {
 						// method
 						p.signature(f.Type.(*ast.FuncType)) // don't print "func"
@@ -1637,7 +1683,7 @@ func (p *printer) genDecl(d *ast.GenDecl) {
 	// Contract declarations rely on the pseudo-keyword (identifier) "contract";
 	// in the AST the respective token is ast.IDENT. Catch and correct this here.
 	if d.Tok == token.IDENT {
-		p.print(&ast.Ident{NamePos: d.Pos(), Name: "contract"})
+		p.print(d.Pos(), &ast.Ident{NamePos: d.Pos(), Name: "contract"})
 	} else {
 		p.print(d.Pos(), d.Tok)
 	}
@@ -1810,13 +1856,21 @@ func (p *printer) funcDecl(d *ast.FuncDecl) {
 	// different line (all whitespace preceding the FUNC is emitted only when the
 	// FUNC is emitted).
 	startCol := p.out.Column - len("func ")
+	startLine := p.out.Line
 	if d.Recv != nil {
 		p.parameters(false, d.Recv) // method: print receiver
 		p.print(blank)
 	}
 	p.expr(d.Name)
 	p.signature(d.Type)
-	p.funcBody(p.distanceFrom(d.Pos(), startCol), vtab, d.Body)
+	headerSize := p.distanceFrom(d.Pos(), startCol)
+	if p.out.Line != startLine {
+		// The header was broken across lines, as for a type
+		// parameter list with a long interface: format the
+		// body as it would be once the source is formatted.
+		headerSize = infinity
+	}
+	p.funcBody(headerSize, vtab, d.Body)
 }
 
 func (p *printer) decl(decl ast.Decl) {
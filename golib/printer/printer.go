@@ -71,10 +71,11 @@ type printer struct {
 	// white space). If there's a difference and SourcePos is set in
 	// ConfigMode, //line directives are used in the output to restore
 	// original source positions for a reader.
-	pos     token.Position // current position in AST (source) space
-	out     token.Position // current position in output space
-	last    token.Position // value of pos after calling writeString
-	linePtr *int           // if set, record out.Line for the next token in *linePtr
+	pos      token.Position // current position in AST (source) space
+	posExact bool           // set if pos is the source position of the next item, not an estimate
+	out      token.Position // current position in output space
+	last     token.Position // value of pos after calling writeString
+	linePtr  *int           // if set, record out.Line for the next token in *linePtr
 
 	// The list of all source comments, in order of appearance.
 	comments        []*ast.CommentGroup // may be nil
@@ -204,11 +205,31 @@ func (p *printer) lineFor(pos token.Pos) int {
 }
 
 // writeLineDirective writes a //line directive if necessary.
+// A column is only included if pos is an actual source position;
+// positions estimated for tokens without one have no meaningful column.
 func (p *printer) writeLineDirective(pos token.Position) {
-	if pos.IsValid() && (p.out.Line != pos.Line || p.out.Filename != pos.Filename) {
-		p.output = append(p.output, tabwriter.Escape) // protect '\n' in //line from tabwriter interpretation
-		p.output = append(p.output, fmt.Sprintf("//line %s:%d\n", pos.Filename, pos.Line)...)
-		p.output = append(p.output, tabwriter.Escape)
+	if pos.IsValid() && pos.Filename != "" && (p.out.Line != pos.Line || p.out.Filename != pos.Filename) {
+		if p.Config.Mode&SourceColumn != 0 {
+			// The column of a //line directive applies to the first
+			// character of the following line, which is the indentation
+			// written next. The newline is not escaped so that the
+			// tabwriter keeps that indentation intact.
+			indent := p.Config.Indent + p.indent
+			if p.Config.Mode&(RawFormat|TabIndent|UseSpaces) == UseSpaces {
+				indent *= p.Config.Tabwidth
+			}
+			d := fmt.Sprintf("//line %s:%d", pos.Filename, pos.Line)
+			if col := pos.Column - indent; p.posExact && col > 0 {
+				d += fmt.Sprintf(":%d", col)
+			}
+			p.output = append(p.output, tabwriter.Escape)
+			p.output = append(p.output, d...)
+			p.output = append(p.output, tabwriter.Escape, '\n')
+		} else {
+			p.output = append(p.output, tabwriter.Escape) // protect '\n' in //line from tabwriter interpretation
+			p.output = append(p.output, fmt.Sprintf("//line %s:%d\n", pos.Filename, pos.Line)...)
+			p.output = append(p.output, tabwriter.Escape)
+		}
 		// p.out must match the //line directive
 		p.out.Filename = pos.Filename
 		p.out.Line = pos.Line
@@ -639,6 +660,11 @@ func (p *printer) writeComment(comment *ast.Comment) {
 	text := comment.Text
 	pos := p.posFor(comment.Pos())
 
+	// comments carry their own positions; restore the
+	// state for the next item when done
+	defer func(exact bool) { p.posExact = exact }(p.posExact)
+	p.posExact = pos.IsValid()
+
 	const linePrefix = "//line "
 	if strings.HasPrefix(text, linePrefix) && (!pos.IsValid() || pos.Column == 1) {
 		// Possibly a //-style line directive.
@@ -677,6 +703,7 @@ func (p *printer) writeComment(comment *ast.Comment) {
 		if i > 0 {
 			p.writeByte('\f', 1)
 			pos = p.pos
+			p.posExact = false
 		}
 		if len(line) > 0 {
 			p.writeString(pos, trimRight(line), true)
@@ -962,6 +989,7 @@ func (p *printer) print(args ...interface{}) {
 		case token.Pos:
 			if x.IsValid() {
 				p.pos = p.posFor(x) // accurate position of next item
+				p.posExact = true
 			}
 			continue
 
@@ -1007,6 +1035,7 @@ func (p *printer) print(args ...interface{}) {
 		}
 
 		p.writeString(next, data, isLit)
+		p.posExact = false
 		p.impliedSemi = impliedSemi
 	}
 }
@@ -1280,6 +1309,7 @@ const (
 	TabIndent                  // use tabs for indentation independent of UseSpaces
 	UseSpaces                  // use spaces instead of tabs for alignment
 	SourcePos                  // emit //line directives to preserve original source positions
+	SourceColumn               // include columns in //line directives; only used with SourcePos
 )
 
 // A Config node controls the output of Fprint.
@@ -489,6 +489,122 @@ func g() {
 	}
 }
 
+// Verify that the SourceColumn mode adds columns to //line directives.
+func TestSourceColumn(t *testing.T) {
+	const orig = `
+package p   // line 2
+func f() {
+	x := 1 // line 4
+
+
+	  _ = x // line 7
+}
+`
+
+	const want = `//line src.go:2:1
+package p
+
+//line src.go:3:1
+func f() {
+	x := 1
+
+//line src.go:7:3
+	_ = x
+}
+`
+
+	// parse original
+	f1, err := parser.ParseFile(fset, "src.go", orig, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// pretty-print original
+	var buf bytes.Buffer
+	err = (&Config{Mode: UseSpaces | TabIndent | SourcePos | SourceColumn, Tabwidth: 8}).Fprint(&buf, fset, f1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+
+	// compare original with desired output
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s\n", got, want)
+	}
+}
+
+// Verify that the SourceColumn mode omits columns for nodes
+// without source positions, whose positions are only estimated,
+// and that such nodes are laid out compactly.
+func TestSourceColumnSynthesized(t *testing.T) {
+	const orig = `
+package p
+func f() {
+	x := 1
+
+
+	  _ = x
+}
+`
+
+	const want = `//line src.go:2:1
+package p
+
+//line src.go:3:1
+func f() {
+	x := 1
+
+//line src.go:7:3
+	_ = x
+//line src.go:7
+	if true {
+//line src.go:7
+		x = 2
+//line src.go:7
+		_ = struct{}{}
+//line src.go:7
+	}
+}
+`
+
+	// parse original
+	f1, err := parser.ParseFile(fset, "src.go", orig, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// append a statement without positions
+	body := f1.Decls[0].(*ast.FuncDecl).Body
+	body.List = append(body.List, &ast.IfStmt{
+		Cond: ast.NewIdent("true"),
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			&ast.AssignStmt{
+				Lhs: []ast.Expr{ast.NewIdent("x")},
+				Tok: token.ASSIGN,
+				Rhs: []ast.Expr{&ast.BasicLit{Kind: token.INT, Value: "2"}},
+			},
+			&ast.AssignStmt{
+				Lhs: []ast.Expr{ast.NewIdent("_")},
+				Tok: token.ASSIGN,
+				Rhs: []ast.Expr{&ast.CompositeLit{Type: &ast.StructType{Fields: &ast.FieldList{}}}},
+			},
+		}},
+	})
+
+	// pretty-print modified original
+	var buf bytes.Buffer
+	err = (&Config{Mode: UseSpaces | TabIndent | SourcePos | SourceColumn, Tabwidth: 8}).Fprint(&buf, fset, f1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+
+	// compare original with desired output
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s\n", got, want)
+	}
+}
+
 var decls = []string{
 	`import "fmt"`,
 	"const pi = 3.1415\nconst e = 2.71828\n\nvar x = pi",
@@ -171,6 +171,13 @@ type Info struct {
 	// of the function called.
 	Inferred map[*ast.CallExpr]Inferred
 
+	// Instances maps identifiers denoting generic types or functions
+	// to the type arguments and instantiated type of each of their
+	// instantiations, whether the type arguments are explicit, as in
+	// List(int) or Max(int), or inferred, as in the call Max(1, 2).
+	// For a qualified identifier, the key is the selector.
+	Instances map[*ast.Ident]Instance
+
 	// Defs maps identifiers to the objects they define (including
 	// package names, dots "." of dot-imports, and blank "_" identifiers).
 	// For identifiers that do not denote objects (e.g., the package name
@@ -334,6 +341,13 @@ type Inferred struct {
 	Sig   *Signature
 }
 
+// Instance reports the type arguments and instantiated type
+// for an instantiation of a generic type or function.
+type Instance struct {
+	TypeArgs []Type
+	Type     Type
+}
+
 // An Initializer describes a package-level variable, or a list of variables in case
 // of a multi-valued initialization expression, and the corresponding initialization
 // expression.
@@ -430,6 +430,150 @@ func TestInferredInfo(t *testing.T) {
 	}
 }
 
+func TestInstancesInfo(t *testing.T) {
+	var tests = []struct {
+		src   string
+		name  string
+		targs []string
+		typ   string
+	}{
+		// explicit type arguments
+		{`package p0; type T(type P) struct{ f P }; var _ T(int)`,
+			`T`,
+			[]string{`int`},
+			`p0.T(int)`,
+		},
+		{`package p1; func f(type P)(P) P; var _ = f(string)`,
+			`f`,
+			[]string{`string`},
+			`func(string) string`,
+		},
+		{`package p2; type T(type K, V) struct{ k K; v V }; func _(m T(string, bool)) {}`,
+			`T`,
+			[]string{`string`, `bool`},
+			`p2.T(string, bool)`,
+		},
+
+		// inferred type arguments
+		{`package q0; func f(type P)(P); func _() { f(42) }`,
+			`f`,
+			[]string{`int`},
+			`func(int)`,
+		},
+		{`package q1; func f(type A, B)(A, []B) B; func _() { _ = (f)(1.2, []byte{}) }`,
+			`f`,
+			[]string{`float64`, `byte`},
+			`func(float64, []byte) byte`,
+		},
+		{`package q2; type T struct{}; func (T) m(type P)(P) P; func _(x T) { x.m(42) }`,
+			`m`,
+			[]string{`int`},
+			`func(int) int`,
+		},
+	}
+
+	for _, test := range tests {
+		info := Info{Instances: make(map[*ast.Ident]Instance)}
+		name, err := mayTypecheck(t, "InstancesInfo", test.src, &info)
+		if err != nil {
+			t.Errorf("package %s: %v", name, err)
+			continue
+		}
+
+		// look for the instance of test.name
+		var inst *Instance
+		for id, x := range info.Instances {
+			if id.Name == test.name {
+				x := x
+				inst = &x
+				break
+			}
+		}
+		if inst == nil {
+			t.Errorf("package %s: no instance found for %s", name, test.name)
+			continue
+		}
+
+		// check that type arguments are correct
+		if len(inst.TypeArgs) != len(test.targs) {
+			t.Errorf("package %s: got %d type arguments; want %d", name, len(inst.TypeArgs), len(test.targs))
+			continue
+		}
+		for i, targ := range inst.TypeArgs {
+			if got := targ.String(); got != test.targs[i] {
+				t.Errorf("package %s, %d. type argument: got %s; want %s", name, i, got, test.targs[i])
+			}
+		}
+
+		// check that the instantiated type is correct
+		if got := inst.Type.String(); got != test.typ {
+			t.Errorf("package %s: got %s; want %s", name, got, test.typ)
+		}
+	}
+}
+
+func TestInstantiate(t *testing.T) {
+	const src = `package p
+
+type T(type P) struct{ f P }
+
+func f(type P)(P) []P
+
+contract stringer(T) {
+	T String() string
+}
+
+type S(type P stringer) struct{ f P }
+
+type myString string
+
+func (myString) String() string { return "" }
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conf Config
+	pkg, err := conf.Check(f.Name.Name, fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lookup := func(name string) Type { return pkg.Scope().Lookup(name).Type() }
+	myString := lookup("myString")
+
+	for _, test := range []struct {
+		orig     string
+		targs    []Type
+		validate bool
+		want     string // type or error
+	}{
+		{"T", []Type{Typ[Int]}, true, "p.T(int)"},
+		{"f", []Type{Typ[String]}, true, "func(string) []string"},
+		{"S", []Type{myString}, true, "p.S(p.myString)"},
+		{"S", []Type{Typ[Int]}, true, "int does not satisfy p.stringer(P) (missing method String)"},
+		{"S", []Type{Typ[Int]}, false, "p.S(int)"},
+		{"T", []Type{Typ[Int], Typ[Int]}, true, "got 2 type arguments but p.T(type P₁) has 1 type parameters"},
+		{"myString", []Type{Typ[Int]}, true, "p.myString is not a generic type or function"},
+	} {
+		got, err := Instantiate(lookup(test.orig), test.targs, test.validate)
+		var s string
+		if err != nil {
+			s = err.Error()
+		} else {
+			s = got.String()
+		}
+		if s != test.want {
+			t.Errorf("Instantiate(%s, %v, %v): got %s; want %s", test.orig, test.targs, test.validate, s, test.want)
+		}
+	}
+
+	// The generic function is left untouched.
+	if sig := lookup("f").(*Signature); len(sig.TParams()) != 1 {
+		t.Errorf("Instantiate modified the signature of f: %s", sig)
+	}
+}
+
 func TestDefsInfo(t *testing.T) {
 	var tests = []struct {
 		src  string
@@ -63,7 +63,7 @@ func (check *Checker) call(x *operand, e *ast.CallExpr) exprKind {
 
 	default:
 		// function/method call
-		sig := x.typ.Signature()
+		sig, _ := coreType(x.typ).(*Signature)
 		if sig == nil {
 			check.invalidOp(x.pos(), "cannot call non-function %s", x)
 			x.mode = invalid
@@ -104,6 +104,7 @@ func (check *Checker) call(x *operand, e *ast.CallExpr) exprKind {
 			// instantiate function signature
 			res := check.instantiate(x.pos(), sig, targs, poslist).(*Signature)
 			assert(res.tparams == nil) // signature is not generic anymore
+			check.recordInstance(e.Fun, targs, res)
 			x.typ = res
 			x.mode = value
 			x.expr = e
@@ -317,6 +318,7 @@ func (check *Checker) arguments(call *ast.CallExpr, sig *Signature, args []*oper
 		rsig = check.instantiate(call.Pos(), sig, targs, nil).(*Signature)
 		assert(rsig.tparams == nil) // signature is not generic anymore
 		check.recordInferred(call, targs, rsig)
+		check.recordInstance(call.Fun, targs, rsig)
 
 		// Optimization: Only if the parameter list was adjusted do we
 		// need to compute it from the adjusted list; otherwise we can
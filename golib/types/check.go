@@ -402,6 +402,30 @@ func (check *Checker) recordInferred(call *ast.CallExpr, targs []Type, sig *Sign
 	}
 }
 
+// recordInstance records the instantiation of the generic type or
+// function denoted by x, if x is a (possibly qualified or parenthesized)
+// identifier.
+func (check *Checker) recordInstance(x ast.Expr, targs []Type, typ Type) {
+	assert(typ != nil)
+	m := check.Instances
+	if m == nil {
+		return
+	}
+	for {
+		switch e := x.(type) {
+		case *ast.Ident:
+			m[e] = Instance{targs, typ}
+			return
+		case *ast.SelectorExpr:
+			x = e.Sel
+		case *ast.ParenExpr:
+			x = e.X
+		default:
+			return
+		}
+	}
+}
+
 func (check *Checker) recordDef(id *ast.Ident, obj Object) {
 	assert(id != nil)
 	if m := check.Defs; m != nil {
@@ -105,12 +105,16 @@ var tests = [][]string{
 	{"testdata/typeinst.go2"},
 	{"testdata/typeinst2.go2"},
 	{"testdata/contracts.go2"},
+	{"testdata/ptrcontracts.go2"},
+	{"testdata/coretypes.go2"},
+	{"testdata/multicontracts.go2"},
 	{"testdata/issues.go2"},
 	{"testdata/todos.go2"},
 
 	// Go 2 examples from design doc
 	{"testdata/slices.go2"},
 	{"testdata/chans.go2"},
+	{"testdata/graph.go2"},
 	{"testdata/map.go2"},
 	{"testdata/map2.go2"},
 	{"testdata/linalg.go2"},
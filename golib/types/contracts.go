@@ -33,9 +33,6 @@ func (check *Checker) contractDecl(obj *Contract, cdecl *ast.ContractSpec) {
 
 	// collect constraints
 	for _, c := range cdecl.Constraints {
-		if c.Star.IsValid() {
-			check.errorf(c.Star, "pointer designation for type parameters not yet supported (* is ignored)")
-		}
 		if c.Param != nil {
 			// If a type name is present, it must be one of the contract's type parameters.
 			pos := c.Param.Pos()
@@ -91,8 +88,15 @@ func (check *Checker) contractDecl(obj *Contract, cdecl *ast.ContractSpec) {
 				}
 				// add receiver to signature
 				// (TODO(gri) verify that this matches what we do elsewhere, e.g., in NewInterfaceType)
+				// With pointer designation (*P m()), the method is in the method set of *P
+				// only: like a method with a pointer receiver, it can be called on a value
+				// of type P only if the value is addressable.
 				assert(sig.recv == nil)
-				sig.recv = NewVar(pos, check.pkg, "_", ifaceName)
+				var recv Type = ifaceName
+				if c.Star.IsValid() {
+					recv = NewPointer(ifaceName)
+				}
+				sig.recv = NewVar(pos, check.pkg, "_", recv)
 				// add the method
 				mname := c.MNames[0]
 				m := NewFunc(mname.Pos(), check.pkg, mname.Name, sig)
@@ -120,19 +124,16 @@ func (check *Checker) contractDecl(obj *Contract, cdecl *ast.ContractSpec) {
 				continue
 			}
 
-			// If the type parameters are constraint via contracts, ensure that each type
-			// parameter is used at most once. Create a new map for each embedded contract
-			// to check this correspondence (since we may have multiple embedded contracts).
-			// Eventually, we may be able to relax this constraint and remove the need for
-			// this map.
-			unused := make(map[*TypeParam]bool, len(tparams))
+			// The embedded contract's bounds are added to the bounds of the (incoming)
+			// type parameters of this contract used as contract arguments.
+			incoming := make(map[*TypeParam]bool, len(tparams))
 			for _, tname := range tparams {
-				unused[tname.typ.(*TypeParam)] = true
+				incoming[tname.typ.(*TypeParam)] = true
 			}
 
 			// Handle contract lookup here so we don't need to set up a special contract mode
 			// for operands just to carry its information through in form of some contract Type.
-			if eobj, targs, valid := check.contractExpr(econtr, unused); eobj != nil {
+			if eobj, targs, valid := check.contractExpr(econtr, incoming); eobj != nil {
 				// we have a (possibly invalid) contract expression
 				if !valid {
 					continue
@@ -143,11 +144,15 @@ func (check *Checker) contractDecl(obj *Contract, cdecl *ast.ContractSpec) {
 				// with the outer bound's type parameters, and because they are embedded, there
 				// is no need to keep them in instantiated form; in fact it will lead to problems
 				// if the outer bound is instantiated again later. We can just keep the embeds
-				// instead.
+				// instead. A type parameter may be used multiple times as contract argument,
+				// but its (combined) bound must be embedded only once.
 				for _, targ := range targs {
-					tpar := targ.(*TypeParam)
+					tpar, _ := targ.(*TypeParam)
+					if tpar == nil || !incoming[tpar] || tpar.bound == Type(&emptyInterface) {
+						continue // not a type parameter of this contract, or bound already embedded
+					}
 					iface := bounds[tpar.index].underlying.(*Interface)
-					embed := tpar.Bound() // don't use Named form of tpar.bound
+					embed := tpar.bound.Interface() // don't use Named form of tpar.bound
 					iface.embeddeds = append(iface.embeddeds, embed)
 					check.posMap[iface] = append(check.posMap[iface], econtr.Pos()) // satisfy completeInterface requirements
 					// check.contractExpr assigned a type bound to its incoming type arguments,
@@ -584,7 +584,11 @@ func (check *Checker) typeDecl(obj *TypeName, tdecl *ast.TypeSpec, def *Named) {
 		if tdecl.TParams != nil {
 			check.openScope(tdecl, "type parameters")
 			defer check.closeScope()
-			named.tparams = check.collectTypeParams(tdecl.TParams)
+			// Set the type parameters of named before collecting their
+			// bounds so that the bounds may refer to named itself, as in
+			// type T(type P T(P)) interface{ ... }.
+			named.tparams = check.declareTypeParamList(tdecl.TParams)
+			check.collectTypeParamBounds(named.tparams, tdecl.TParams)
 		}
 
 		// determine underlying type of named
@@ -611,6 +615,14 @@ func (check *Checker) typeDecl(obj *TypeName, tdecl *ast.TypeSpec, def *Named) {
 }
 
 func (check *Checker) collectTypeParams(list *ast.FieldList) (tparams []*TypeName) {
+	tparams = check.declareTypeParamList(list)
+	check.collectTypeParamBounds(tparams, list)
+	return
+}
+
+// declareTypeParamList declares the type parameters of list, with empty
+// interface as type bound.
+func (check *Checker) declareTypeParamList(list *ast.FieldList) (tparams []*TypeName) {
 	// Declare type parameters up-front, with empty interface as type bound.
 	// If we use interfaces as type bounds, the scope of type parameters starts at
 	// the beginning of the type parameter list (so we can have mutually recursive
@@ -620,19 +632,17 @@ func (check *Checker) collectTypeParams(list *ast.FieldList) (tparams []*TypeNam
 	for _, f := range list.List {
 		tparams = check.declareTypeParams(tparams, f.Names)
 	}
+	return
+}
 
-	// If the type parameters are constraint via contracts, ensure that each type
-	// parameter is used at most once. Create a map to check this correspondence.
-	// Eventually, we may be able to relax this constraint and remove the need for
-	// this map.
-	unused := make(map[*TypeParam]bool, len(tparams))
+// collectTypeParamBounds sets the type bounds of the type parameters tparams
+// declared by list.
+func (check *Checker) collectTypeParamBounds(tparams []*TypeName, list *ast.FieldList) {
+	// Contract expressions may only set the bounds of the type parameters
+	// declared by this list (the incoming type parameters).
+	incoming := make(map[*TypeParam]bool, len(tparams))
 	for _, tname := range tparams {
-		unused[tname.typ.(*TypeParam)] = true
-	}
-
-	setBoundAt := func(at int, bound Type) {
-		assert(IsInterface(bound))
-		tparams[at].typ.(*TypeParam).bound = bound
+		incoming[tname.typ.(*TypeParam)] = true
 	}
 
 	index := 0
@@ -644,7 +654,7 @@ func (check *Checker) collectTypeParams(list *ast.FieldList) (tparams []*TypeNam
 		// If f.Type denotes a contract, handle everything here so we don't
 		// need to set up a special contract mode for operands just to carry
 		// its information through in form of some contract Type.
-		if obj, targs, valid := check.contractExpr(f.Type, unused); obj != nil {
+		if obj, targs, valid := check.contractExpr(f.Type, incoming); obj != nil {
 			// we have a (possibly invalid) contract expression
 			if !valid {
 				goto next
@@ -653,6 +663,10 @@ func (check *Checker) collectTypeParams(list *ast.FieldList) (tparams []*TypeNam
 			if targs == nil {
 				// obj denotes a valid uninstantiated contract =>
 				// use the declared type parameters as "arguments"
+				if len(f.Names) == 0 {
+					check.errorf(f.Type.Pos(), "contract %s requires type arguments", f.Type)
+					goto next
+				}
 				if len(f.Names) != len(obj.TParams) {
 					check.errorf(f.Type.Pos(), "%d type parameters but contract expects %d", len(f.Names), len(obj.TParams))
 					goto next
@@ -665,43 +679,73 @@ func (check *Checker) collectTypeParams(list *ast.FieldList) (tparams []*TypeNam
 				}
 				for i, name := range f.Names {
 					bound := obj.Bounds[i]
-					setBoundAt(index+i, check.instantiate(name.Pos(), bound, targs, nil))
+					check.addBound(name.Pos(), tparams[index+i].typ.(*TypeParam), check.instantiate(name.Pos(), bound, targs, nil))
 				}
 			}
 			goto next
 		}
 
+		// Only contract expressions may appear without type parameter names.
+		if len(f.Names) == 0 {
+			check.errorf(f.Type.Pos(), "%s is not a contract", f.Type)
+			goto next
+		}
+
 		// otherwise, bound must be an interface
-		if bound := expand(check.typ(f.Type)); IsInterface(bound) {
-			for i, _ := range f.Names {
-				setBoundAt(index+i, bound)
+		switch bound := check.typ(f.Type).(type) {
+		case *instance:
+			// Don't expand an instantiated (parameterized) interface bound yet:
+			// with mutually recursive bounds, as in
+			//
+			//	type Node(type N NodeFace(N, E), E EdgeFace(N, E)) ...
+			//
+			// checking the type arguments requires the bounds of type parameters
+			// that are not set up yet. The bound is expanded when it is used.
+			list := tparams[index : index+len(f.Names)]
+			for _, tname := range list {
+				check.addBound(f.Type.Pos(), tname.typ.(*TypeParam), bound)
+			}
+			pos := f.Type.Pos()
+			check.later(func() {
+				if typ := bound.expand(); !IsInterface(typ) {
+					if typ != Typ[Invalid] {
+						check.errorf(pos, "%s is not an interface or contract", typ)
+					}
+					for _, tname := range list {
+						tname.typ.(*TypeParam).bound = &emptyInterface
+					}
+				}
+			})
+		default:
+			if IsInterface(bound) {
+				for _, tname := range tparams[index : index+len(f.Names)] {
+					check.addBound(f.Type.Pos(), tname.typ.(*TypeParam), bound)
+				}
+			} else if bound != Typ[Invalid] {
+				check.errorf(f.Type.Pos(), "%s is not an interface or contract", bound)
 			}
-		} else if bound != Typ[Invalid] {
-			check.errorf(f.Type.Pos(), "%s is not an interface or contract", bound)
 		}
 
 	next:
 		index += len(f.Names)
 	}
-
-	return
 }
 
 // contractExpr returns the contract obj of a contract name x = C or
 // the contract obj and type arguments targs of an instantiated contract
 // expression x = C(T1, T2, ...), and whether the expression is valid.
-// The set unused contains all (outer, incoming) type parameters that
-// have not yet been used in a contract expression. It must be set prior
-// to calling contractExpr and is updated by contractExpr.
+// The set incoming contains the (incoming) type parameters whose type
+// bounds may be set by the contract expression.
 //
 // If x denotes a contract, the result obj is that contract; otherwise
 // obj == nil and the remaining results are undefined. If the contract
 // exists but the contract or the type arguments (if any) have errors
 // valid is false.
 // If x is a valid instantiated contract expression, targs is the list
-// of (incomming) type parameters used as arguments for the contract,
-// with their type bounds set according to the contract.
-func (check *Checker) contractExpr(x ast.Expr, unused map[*TypeParam]bool) (obj *Contract, targs []Type, valid bool) {
+// of types used as arguments for the contract. The contract's bounds
+// are added to the type bounds of the incoming type parameters among
+// them; all other type arguments must satisfy their respective bounds.
+func (check *Checker) contractExpr(x ast.Expr, incoming map[*TypeParam]bool) (obj *Contract, targs []Type, valid bool) {
 	// permit any parenthesized expression
 	x = unparen(x)
 
@@ -716,6 +760,7 @@ func (check *Checker) contractExpr(x ast.Expr, unused map[*TypeParam]bool) (obj
 	case *ast.Ident:
 		// local contract
 		if obj, _ = check.lookup(x.Name).(*Contract); obj != nil {
+			check.recordUse(x, obj)
 			// set up contract if not yet done
 			if obj.typ == nil {
 				check.objDecl(obj, nil)
@@ -741,8 +786,8 @@ func (check *Checker) contractExpr(x ast.Expr, unused map[*TypeParam]bool) (obj
 				} else if !exp.Exported() {
 					check.errorf(x.Pos(), "%s not exported by packge %s", x, pkg.name)
 					return
-				} else {
-					obj, _ = exp.(*Contract)
+				} else if obj, _ = exp.(*Contract); obj != nil {
+					check.recordUse(x.Sel, obj)
 				}
 			}
 		}
@@ -767,32 +812,33 @@ func (check *Checker) contractExpr(x ast.Expr, unused map[*TypeParam]bool) (obj
 			check.use(call.Args...)
 			return
 		}
-		// For now, a contract type argument must be one of the (incoming)
-		// type parameters, and each of these type parameters may be used
-		// at most once.
-		for _, arg := range call.Args {
-			targ := check.typ(arg)
-			if tparam, _ := targ.(*TypeParam); tparam != nil {
-				if ok, found := unused[tparam]; ok {
-					unused[tparam] = false
-					targs = append(targs, targ)
-				} else if found {
-					check.errorf(arg.Pos(), "%s used multiple times (not supported due to implementation restriction)", arg)
-				} else {
-					check.errorf(arg.Pos(), "%s is not an incoming type parameter (not supported due to implementation restriction)", arg)
-				}
-			} else if targ != Typ[Invalid] {
-				check.errorf(arg.Pos(), "%s is not a type parameter (not supported due to implementation restriction)", arg)
+		targs = make([]Type, len(call.Args))
+		invalid := false
+		for i, arg := range call.Args {
+			targs[i] = check.typ(arg)
+			if targs[i] == Typ[Invalid] {
+				invalid = true
 			}
 		}
-		if len(targs) != len(call.Args) {
+		if invalid {
 			return // some arguments are invalid
 		}
-		// Use contract's matching type parameter bound, instantiate
-		// it with the actual type arguments targs, and set the bound
-		// for the type parameter.
+		// Use contract's matching type parameter bound and instantiate
+		// it with the actual type arguments targs. Incoming type parameters
+		// get the bound added to their type bound; any other type argument
+		// must satisfy the bound. The latter check is delayed until the type
+		// parameters' bounds are complete.
 		for i, bound := range obj.Bounds {
-			targs[i].(*TypeParam).bound = check.instantiate(call.Args[i].Pos(), bound, targs, nil).(*Named)
+			pos := call.Args[i].Pos()
+			targ := targs[i]
+			ibound := check.instantiate(pos, bound, targs, nil).(*Named)
+			if tpar, _ := targ.(*TypeParam); tpar != nil && incoming[tpar] {
+				check.addBound(pos, tpar, ibound)
+				continue
+			}
+			check.later(func() {
+				check.satisfiesBound(pos, targ, ibound, nil)
+			})
 		}
 	}
 
@@ -800,6 +846,28 @@ func (check *Checker) contractExpr(x ast.Expr, unused map[*TypeParam]bool) (obj
 	return
 }
 
+// addBound adds bound to the type bound of the type parameter tpar. If tpar
+// already has a (non-empty) bound, the new bound is the interface embedding
+// both; i.e., the type argument for tpar must satisfy each of them.
+// A bound that is a type instance is not expanded (see collectTypeParamBounds).
+func (check *Checker) addBound(pos token.Pos, tpar *TypeParam, bound Type) {
+	if _, ok := bound.(*instance); !ok {
+		assert(IsInterface(bound))
+	}
+	if tpar.bound == Type(&emptyInterface) {
+		tpar.bound = bound
+		return
+	}
+	iface := &Interface{embeddeds: []Type{tpar.bound, bound}}
+	check.posMap[iface] = []token.Pos{pos, pos} // satisfy completeInterface requirements
+	tpar.bound = iface
+	// complete iface (and report type lists without types in common)
+	// once all embedded bounds are set up
+	check.later(func() {
+		check.completeInterface(pos, iface)
+	})
+}
+
 func (check *Checker) declareTypeParams(tparams []*TypeName, names []*ast.Ident) []*TypeName {
 	for _, name := range names {
 		tpar := NewTypeName(name.Pos(), check.pkg, name.Name, nil)
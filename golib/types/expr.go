@@ -94,7 +94,7 @@ func (check *Checker) unary(x *operand, e *ast.UnaryExpr, op token.Token) {
 		return
 
 	case token.ARROW:
-		typ := x.typ.Chan()
+		typ, _ := coreType(x.typ).(*Chan)
 		if typ == nil {
 			check.invalidOp(x.pos(), "cannot receive from non-channel %s", x)
 			x.mode = invalid
@@ -1314,9 +1314,16 @@ func (check *Checker) exprInternal(x *operand, e ast.Expr, hint Type) exprKind {
 			goto Error
 		}
 
+		// A value of type parameter type is indexed as a value
+		// of its core type, if it has one.
+		utyp := coreType(x.typ)
+		if utyp == nil {
+			utyp = x.typ.Under()
+		}
+
 		valid := false
 		length := int64(-1) // valid if >= 0
-		switch typ := x.typ.Under().(type) {
+		switch typ := utyp.(type) {
 		case *Basic:
 			if isString(typ) {
 				valid = true
@@ -1561,7 +1568,7 @@ func (check *Checker) exprInternal(x *operand, e ast.Expr, hint Type) exprKind {
 		case typexpr:
 			x.typ = &Pointer{base: x.typ}
 		default:
-			if typ := x.typ.Pointer(); typ != nil {
+			if typ, _ := coreType(x.typ).(*Pointer); typ != nil {
 				x.mode = variable
 				x.typ = typ.base
 			} else {
@@ -87,10 +87,14 @@ func (check *Checker) rawLookupFieldOrMethod(T Type, addressable bool, pkg *Pack
 	// If we have a type parameter, ignore isPtr otherwise we would
 	// return immediately below since the type parameter bound is an
 	// interface. This is needed for methods on variables that are
-	// pointers to values of type parameter type.
+	// pointers to values of type parameter type. The indirection is
+	// kept in tparPtr: the methods of a bound declared with pointer
+	// designation (*P m()) are in the method set of pointers.
 	// TODO(gri) Should this be done in derefUnpack?
+	tparPtr := false
 	if tpar, _ := typ.(*TypeParam); tpar != nil {
 		typ = tpar.bound
+		tparPtr = isPtr
 		isPtr = false
 	}
 
@@ -100,7 +104,7 @@ func (check *Checker) rawLookupFieldOrMethod(T Type, addressable bool, pkg *Pack
 	}
 
 	// Start with typ as single entry at shallowest depth.
-	current := []embeddedType{{typ, nil, isPtr, false}}
+	current := []embeddedType{{typ, nil, isPtr || tparPtr, false}}
 
 	// Named types that we have seen already, allocated lazily.
 	// Used to avoid endless searches in case of recursive types.
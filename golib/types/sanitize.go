@@ -9,30 +9,58 @@ func sanitizeInfo(info *Info) {
 
 	// Note: Some map entries are not references.
 	// If modified, they must be assigned back.
+	//
+	// Types and objects are only written if they change,
+	// as they may belong to imported packages that are
+	// used by other type checkers at the same time.
 
 	for e, tv := range info.Types {
-		tv.Type = s.typ(tv.Type)
-		info.Types[e] = tv
+		if typ := s.typ(tv.Type); typ != tv.Type {
+			tv.Type = typ
+			info.Types[e] = tv
+		}
 	}
 
 	for e, inf := range info.Inferred {
+		changed := false
 		for i, targ := range inf.Targs {
-			inf.Targs[i] = s.typ(targ)
+			if typ := s.typ(targ); typ != targ {
+				inf.Targs[i] = typ
+				changed = true
+			}
+		}
+		if sig := s.typ(inf.Sig).(*Signature); sig != inf.Sig {
+			inf.Sig = sig
+			changed = true
+		}
+		if changed {
+			info.Inferred[e] = inf
 		}
-		inf.Sig = s.typ(inf.Sig).(*Signature)
-		info.Inferred[e] = inf
 	}
 
-	for _, obj := range info.Defs {
-		if obj != nil {
-			obj.setType(s.typ(obj.Type()))
+	for e, inst := range info.Instances {
+		changed := false
+		for i, targ := range inst.TypeArgs {
+			if typ := s.typ(targ); typ != targ {
+				inst.TypeArgs[i] = typ
+				changed = true
+			}
+		}
+		if typ := s.typ(inst.Type); typ != inst.Type {
+			inst.Type = typ
+			changed = true
+		}
+		if changed {
+			info.Instances[e] = inst
 		}
 	}
 
+	for _, obj := range info.Defs {
+		s.object(obj)
+	}
+
 	for _, obj := range info.Uses {
-		if obj != nil {
-			obj.setType(s.typ(obj.Type()))
-		}
+		s.object(obj)
 	}
 
 	// TODO(gri) sanitize as needed
@@ -55,16 +83,22 @@ func (s sanitizer) typ(typ Type) Type {
 		// nothing to do
 
 	case *Array:
-		t.elem = s.typ(t.elem)
+		if elem := s.typ(t.elem); elem != t.elem {
+			t.elem = elem
+		}
 
 	case *Slice:
-		t.elem = s.typ(t.elem)
+		if elem := s.typ(t.elem); elem != t.elem {
+			t.elem = elem
+		}
 
 	case *Struct:
 		s.varList(t.fields)
 
 	case *Pointer:
-		t.base = s.typ(t.base)
+		if base := s.typ(t.base); base != t.base {
+			t.base = base
+		}
 
 	case *Tuple:
 		s.tuple(t)
@@ -82,20 +116,32 @@ func (s sanitizer) typ(typ Type) Type {
 		s.typeList(t.allTypes)
 
 	case *Map:
-		t.key = s.typ(t.key)
-		t.elem = s.typ(t.elem)
+		if key := s.typ(t.key); key != t.key {
+			t.key = key
+		}
+		if elem := s.typ(t.elem); elem != t.elem {
+			t.elem = elem
+		}
 
 	case *Chan:
-		t.elem = s.typ(t.elem)
+		if elem := s.typ(t.elem); elem != t.elem {
+			t.elem = elem
+		}
 
 	case *Named:
-		t.orig = s.typ(t.orig)
-		t.underlying = s.typ(t.underlying)
+		if orig := s.typ(t.orig); orig != t.orig {
+			t.orig = orig
+		}
+		if under := s.typ(t.underlying); under != t.underlying {
+			t.underlying = under
+		}
 		s.typeList(t.targs)
 		s.funcList(t.methods)
 
 	case *TypeParam:
-		t.bound = s.typ(t.bound)
+		if bound := s.typ(t.bound); bound != t.bound {
+			t.bound = bound
+		}
 
 	case *instance:
 		typ = t.expand()
@@ -108,9 +154,19 @@ func (s sanitizer) typ(typ Type) Type {
 	return typ
 }
 
+func (s sanitizer) object(obj Object) {
+	if obj != nil {
+		if typ := s.typ(obj.Type()); typ != obj.Type() {
+			obj.setType(typ)
+		}
+	}
+}
+
 func (s sanitizer) var_(v *Var) {
 	if v != nil {
-		v.typ = s.typ(v.typ)
+		if typ := s.typ(v.typ); typ != v.typ {
+			v.typ = typ
+		}
 	}
 }
 
@@ -128,7 +184,9 @@ func (s sanitizer) tuple(t *Tuple) {
 
 func (s sanitizer) func_(f *Func) {
 	if f != nil {
-		f.typ = s.typ(f.typ)
+		if typ := s.typ(f.typ); typ != f.typ {
+			f.typ = typ
+		}
 	}
 }
 
@@ -140,6 +198,8 @@ func (s sanitizer) funcList(list []*Func) {
 
 func (s sanitizer) typeList(list []Type) {
 	for i, t := range list {
-		list[i] = s.typ(t)
+		if typ := s.typ(t); typ != t {
+			list[i] = typ
+		}
 	}
 }
@@ -350,7 +350,7 @@ func (check *Checker) stmt(ctxt stmtContext, s ast.Stmt) {
 			return
 		}
 
-		tch := ch.typ.Chan()
+		tch, _ := coreType(ch.typ).(*Chan)
 		if tch == nil {
 			check.invalidOp(s.Arrow, "cannot send to non-chan type %s", ch.typ)
 			return
@@ -10,6 +10,7 @@ package types
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/tdakkota/go2go/golib/token"
 )
@@ -52,7 +53,78 @@ func (m *substMap) lookup(typ *TypeParam) Type {
 	return typ
 }
 
+// Instantiate instantiates the generic type or function orig with the
+// type arguments targs. orig must be a generic *Named type, or a
+// *Signature with type parameters; the result is the *Named type or
+// *Signature with the type parameters replaced by targs. If validate
+// is set, Instantiate also checks that each type argument satisfies
+// the bound of its type parameter, and reports an error for the first
+// one that doesn't.
+//
+// Each call of Instantiate creates new instantiated types, distinct
+// from those of other calls and of the type checker.
+func Instantiate(orig Type, targs []Type, validate bool) (Type, error) {
+	var tparams []*TypeName
+	switch t := orig.(type) {
+	case *Named:
+		if isGeneric(t) {
+			tparams = t.tparams
+		}
+	case *Signature:
+		tparams = t.tparams
+	}
+	if len(tparams) == 0 {
+		return nil, fmt.Errorf("%s is not a generic type or function", orig)
+	}
+	if len(targs) != len(tparams) {
+		return nil, fmt.Errorf("got %d type arguments but %s has %d type parameters", len(targs), orig, len(tparams))
+	}
+
+	var firstErr error
+	conf := &Config{Error: func(err error) {
+		if firstErr == nil {
+			firstErr = errors.New(err.(Error).Msg) // no position to report
+		}
+	}}
+	check := NewChecker(conf, nil, nil, nil)
+
+	targs = append([]Type(nil), targs...) // makeSubstMap expands targs in place
+	smap := makeSubstMap(tparams, targs)
+	if validate {
+		for i, tname := range tparams {
+			if !check.satisfies(token.NoPos, targs[i], tname.typ.(*TypeParam), smap) {
+				return nil, firstErr
+			}
+		}
+	}
+
+	res := check.subst(token.NoPos, orig, smap)
+	if sig, _ := res.(*Signature); sig != nil {
+		// As for check.instantiate, the result is not generic anymore;
+		// copy it if subst didn't, so that orig is left untouched.
+		if sig == orig {
+			copy := *sig
+			sig = &copy
+		}
+		sig.tparams = nil
+		res = sig
+	}
+	return res, firstErr
+}
+
 func (check *Checker) instantiate(pos token.Pos, typ Type, targs []Type, poslist []token.Pos) (res Type) {
+	return check.instantiate0(pos, typ, targs, poslist, nil)
+}
+
+// instantiate0 is like instantiate, but if expanded is not nil, it is
+// called with the instantiated type before the type arguments are checked
+// against the type bounds. With (mutually) recursive type bounds, as in
+//
+//	type NodeFace(type N NodeFace(N, E), E EdgeFace(N, E)) interface{ ... }
+//
+// the bounds check may require the instantiated type itself (see
+// instance.expand).
+func (check *Checker) instantiate0(pos token.Pos, typ Type, targs []Type, poslist []token.Pos, expanded func(Type)) (res Type) {
 	if check.conf.Trace {
 		check.trace(pos, "-- instantiating %s with %s", typ, typeListString(targs))
 		check.indent++
@@ -111,85 +183,134 @@ func (check *Checker) instantiate(pos token.Pos, typ Type, targs []Type, poslist
 	}
 
 	smap := makeSubstMap(tparams, targs)
+	if expanded != nil {
+		// provide the result before checking bounds
+		res = check.subst(pos, typ, smap)
+		expanded(res)
+	}
 
 	// check bounds
 	for i, tname := range tparams {
-		tpar := tname.typ.(*TypeParam)
-		iface := tpar.Bound()
-		if iface.Empty() {
-			continue // no type bound
-		}
-
-		targ := targs[i]
-
 		// best position for error reporting
 		pos := pos
 		if i < len(poslist) {
 			pos = poslist[i]
 		}
 
-		// The type parameter bound is parameterized with the same type parameters
-		// as the instantiated type; before we can use it for bounds checking we
-		// need to instantiate it with the type arguments with which we instantiate
-		// the parameterized type.
-		iface = check.subst(pos, iface, smap).(*Interface)
-
-		// targ must implement iface (methods)
-		//
-		// Assume targ is addressable, per the draft design: "In a generic function
-		// body all method calls will be pointer method calls. If necessary, the
-		// function body will insert temporary variables, not seen by the user, in
-		// order to get an addressable variable to use to call the method."
-		//
-		// TODO(gri) Instead of the addressable (= true) flag, could we encode the
-		// same information by making targ a pointer type (and then get rid of the
-		// need for that extra flag)?
-		if m, _ := check.missingMethod(targ, true, iface, true); m != nil {
-			// TODO(gri) needs to print updated name to avoid major confusion in error message!
-			//           (print warning for now)
-			// check.softErrorf(pos, "%s does not satisfy %s (warning: name not updated) = %s (missing method %s)", targ, tpar.bound, iface, m)
-			if m.name == "==" {
-				// We don't want to report "missing method ==".
-				check.softErrorf(pos, "%s does not satisfy comparable", targ)
-			} else {
-				check.softErrorf(pos, "%s does not satisfy %s (missing method %s)", targ, tpar.bound, m.name)
-			}
+		// stop checking bounds after the first error
+		if !check.satisfies(pos, targs[i], tname.typ.(*TypeParam), smap) {
 			break
 		}
+	}
+
+	if expanded == nil {
+		res = check.subst(pos, typ, smap)
+	}
+	return res
+}
 
-		// targ's underlying type must also be one of the interface types listed, if any
-		if len(iface.allTypes) == 0 {
-			break // nothing to do
+// satisfies reports whether the type argument targ satisfies the bound of the
+// type parameter tpar, and reports an error at pos if it doesn't. smap maps
+// the type parameters of the instantiated type or function to the type
+// arguments, to instantiate the bound. If the bound combines several bounds
+// (e.g., because the type parameter is constrained by multiple contracts),
+// targ must satisfy each of them and errors mention the unsatisfied one.
+func (check *Checker) satisfies(pos token.Pos, targ Type, tpar *TypeParam, smap *substMap) bool {
+	for _, bound := range boundList(tpar.bound) {
+		if !check.satisfiesBound(pos, targ, bound, smap) {
+			return false
 		}
-		// len(iface.allTypes) > 0
-
-		// If targ is itself a type parameter, each of its possible types, but at least one, must be in the
-		// list of iface types (i.e., the targ type list must be a non-empty subset of the iface types).
-		if targ := targ.TypeParam(); targ != nil {
-			targBound := targ.Bound()
-			if len(targBound.allTypes) == 0 {
-				check.softErrorf(pos, "%s does not satisfy %s (%s has no type constraints)", targ, tpar.bound, targ)
-				break
-			}
-			for _, t := range targBound.allTypes {
-				if !iface.includes(t.Under()) {
-					// TODO(gri) match this error message with the one below (or vice versa)
-					check.softErrorf(pos, "%s does not satisfy %s (%s type constraint %s not found in %s)", targ, tpar.bound, targ, t, iface.allTypes)
-					break
-				}
-			}
-			break
+	}
+	return true
+}
+
+// boundList returns the list of bounds combined in the type bound bound:
+// if bound is an unnamed interface that only embeds two or more interfaces
+// (as constructed by Checker.addBound), the result are the (recursively
+// flattened) embedded interfaces; otherwise it is bound itself.
+func boundList(bound Type) []Type {
+	if iface, _ := bound.(*Interface); iface != nil && len(iface.methods) == 0 && len(iface.types) == 0 && len(iface.embeddeds) > 1 {
+		var list []Type
+		for _, e := range iface.embeddeds {
+			list = append(list, boundList(e)...)
 		}
+		return list
+	}
+	return []Type{bound}
+}
 
-		// Otherwise, targ's underlying type must also be one of the interface types listed, if any.
-		// TODO(gri) must it be the underlying type, or should it just be the type? (spec question)
-		if !iface.includes(targ.Under()) {
-			check.softErrorf(pos, "%s does not satisfy %s (%s not found in %s)", targ, tpar.bound, targ.Under(), iface.allTypes)
-			break
+// satisfiesBound reports whether the type argument targ satisfies the type
+// bound bound, and reports an error at pos if it doesn't. The bound is
+// instantiated with smap before checking; smap may be nil.
+func (check *Checker) satisfiesBound(pos token.Pos, targ Type, bound Type, smap *substMap) bool {
+	iface := bound.Interface()
+	check.completeInterface(pos, iface)
+	if iface.Empty() {
+		return true // no type bound
+	}
+
+	// The type parameter bound is parameterized with the same type parameters
+	// as the instantiated type; before we can use it for bounds checking we
+	// need to instantiate it with the type arguments with which we instantiate
+	// the parameterized type.
+	if smap != nil {
+		iface = check.subst(pos, iface, smap).(*Interface)
+	}
+
+	// targ must implement iface (methods)
+	//
+	// Assume targ is addressable, per the draft design: "In a generic function
+	// body all method calls will be pointer method calls. If necessary, the
+	// function body will insert temporary variables, not seen by the user, in
+	// order to get an addressable variable to use to call the method."
+	//
+	// TODO(gri) Instead of the addressable (= true) flag, could we encode the
+	// same information by making targ a pointer type (and then get rid of the
+	// need for that extra flag)?
+	if m, _ := check.missingMethod(targ, true, iface, true); m != nil {
+		// TODO(gri) needs to print updated name to avoid major confusion in error message!
+		//           (print warning for now)
+		// check.softErrorf(pos, "%s does not satisfy %s (warning: name not updated) = %s (missing method %s)", targ, bound, iface, m)
+		if m.name == "==" {
+			// We don't want to report "missing method ==".
+			check.softErrorf(pos, "%s does not satisfy comparable", targ)
+		} else {
+			check.softErrorf(pos, "%s does not satisfy %s (missing method %s)", targ, bound, m.name)
 		}
+		return false
 	}
 
-	return check.subst(pos, typ, smap)
+	// targ's underlying type must also be one of the interface types listed, if any
+	if len(iface.allTypes) == 0 {
+		return true // nothing to do
+	}
+	// len(iface.allTypes) > 0
+
+	// If targ is itself a type parameter, each of its possible types, but at least one, must be in the
+	// list of iface types (i.e., the targ type list must be a non-empty subset of the iface types).
+	if targ := targ.TypeParam(); targ != nil {
+		targBound := targ.Bound()
+		if len(targBound.allTypes) == 0 {
+			check.softErrorf(pos, "%s does not satisfy %s (%s has no type constraints)", targ, bound, targ)
+			return false
+		}
+		for _, t := range targBound.allTypes {
+			if !iface.includes(t.Under()) {
+				// TODO(gri) match this error message with the one below (or vice versa)
+				check.softErrorf(pos, "%s does not satisfy %s (%s type constraint %s not found in %s)", targ, bound, targ, t, iface.allTypes)
+				return false
+			}
+		}
+		return true
+	}
+
+	// Otherwise, targ's underlying type must also be one of the interface types listed, if any.
+	// TODO(gri) must it be the underlying type, or should it just be the type? (spec question)
+	if !iface.includes(targ.Under()) {
+		check.softErrorf(pos, "%s does not satisfy %s (%s not found in %s)", targ, bound, targ.Under(), iface.allTypes)
+		return false
+	}
+	return true
 }
 
 // subst returns the type typ with its type parameters tpars replaced by
@@ -277,7 +398,13 @@ func (subst *subster) typ(typ Type) Type {
 		embeddeds, ecopied := subst.typeList(t.embeddeds)
 		if mcopied || tcopied || ecopied {
 			iface := &Interface{methods: methods, types: types, embeddeds: embeddeds}
-			subst.check.posMap[iface] = subst.check.posMap[t] // satisfy completeInterface requirement
+			// satisfy completeInterface requirement
+			// (t may be from an imported package and have no positions here)
+			if pos, ok := subst.check.posMap[t]; ok {
+				subst.check.posMap[iface] = pos
+			} else {
+				subst.check.posMap[iface] = make([]token.Pos, len(embeddeds))
+			}
 			subst.check.completeInterface(token.NoPos, iface)
 			return iface
 		}
@@ -466,6 +466,19 @@ func (t *Interface) includes(typ Type) bool {
 	return false
 }
 
+// intersect returns the types of the type list x that are also in the type list y.
+func intersect(x, y []Type) (res []Type) {
+	for _, t := range x {
+		for _, u := range y {
+			if Identical(t, u) {
+				res = append(res, t)
+				break
+			}
+		}
+	}
+	return
+}
+
 // Complete computes the interface's method set. It must be called by users of
 // NewInterfaceType and NewInterface after the interface's embedded types are
 // fully defined and before using the interface type in any way other than to
@@ -500,6 +513,7 @@ func (t *Interface) Complete() *Interface {
 
 	var types []Type
 	types = append(types, t.types...)
+	restricted := len(types) > 0
 
 	for _, typ := range t.embeddeds {
 		typ := typ.Interface()
@@ -507,7 +521,15 @@ func (t *Interface) Complete() *Interface {
 		for _, m := range typ.allMethods {
 			addMethod(m, false)
 		}
-		types = append(types, typ.types...)
+		if len(typ.allTypes) == 0 {
+			continue
+		}
+		if restricted {
+			types = intersect(types, typ.allTypes)
+		} else {
+			types = append(types, typ.allTypes...)
+			restricted = true
+		}
 	}
 
 	for i := 0; i < len(todo); i += 2 {
@@ -688,6 +710,46 @@ func (t *TypeParam) Bound() *Interface {
 	return iface
 }
 
+// coreType returns the core type of typ. For a type that is not a type
+// parameter, it is the underlying type. For a type parameter, it is the
+// underlying type shared by all the types in the type list of its bound:
+// operations such as indexing, channel operations, pointer indirection
+// and calls are permitted on values of type parameter type as on values
+// of the core type. Channel types may also differ in their direction if
+// only one of them is restricted; the core type is then the restricted
+// channel type. The result is nil if there is no core type.
+func coreType(typ Type) Type {
+	tpar, _ := typ.Under().(*TypeParam)
+	if tpar == nil {
+		return typ.Under()
+	}
+	var core Type
+	for _, t := range tpar.Bound().allTypes {
+		u := t.Under()
+		if _, ok := u.(*TypeParam); ok {
+			return nil // type parameters in type lists have no core type
+		}
+		if core == nil || Identical(core, u) {
+			core = u
+			continue
+		}
+		c1, _ := core.(*Chan)
+		c2, _ := u.(*Chan)
+		if c1 == nil || c2 == nil || !Identical(c1.elem, c2.elem) {
+			return nil
+		}
+		switch {
+		case c1.dir == SendRecv:
+			core = c2
+		case c2.dir == SendRecv:
+			// keep c1
+		default:
+			return nil // send-only and receive-only channels
+		}
+	}
+	return core
+}
+
 // An instance represents an instantiated generic type syntactically
 // (without expanding the instantiation). Type instances appear only
 // during type-checking and are replaced by their fully instantiated
@@ -722,7 +784,9 @@ func (t *instance) TypeParam() *TypeParam { return t.Under().TypeParam() }
 func (t *instance) expand() Type {
 	v := t.value
 	if v == nil {
-		v = t.check.instantiate(t.pos, t.base, t.targs, t.poslist)
+		// Set t.value before the type arguments are checked against
+		// the type bounds, which may require t itself.
+		v = t.check.instantiate0(t.pos, t.base, t.targs, t.poslist, func(v Type) { t.value = v })
 		if v == nil {
 			v = Typ[Invalid]
 		}
@@ -446,6 +446,8 @@ func (check *Checker) typInternal(e ast.Expr, def *Named) (T Type) {
 			typ.poslist[i] = arg.Pos()
 		}
 
+		check.recordInstance(e.Fun, typ.targs, typ)
+
 		// make sure we check instantiation works at least once
 		// and that the resulting type is valid
 		check.atEnd(func() {
@@ -828,9 +830,13 @@ func (check *Checker) completeInterface(pos token.Pos, ityp *Interface) {
 	}
 
 	// collect types
+	// The type list of the interface is the intersection of its own type list
+	// and the type lists of its embedded interfaces; an interface without type
+	// list doesn't restrict the types.
 	// TODO(gri) report error for multiple explicitly declared identical types
 	var types []Type
 	types = append(types, ityp.types...)
+	restricted := len(types) > 0
 
 	posList := check.posMap[ityp]
 	for i, typ := range ityp.embeddeds {
@@ -847,7 +853,17 @@ func (check *Checker) completeInterface(pos token.Pos, ityp *Interface) {
 		for _, m := range etyp.allMethods {
 			addMethod(pos, m, false) // use embedding position pos rather than m.pos
 		}
-		types = append(types, etyp.allTypes...)
+		if len(etyp.allTypes) == 0 {
+			continue
+		}
+		if !restricted {
+			types = append(types, etyp.allTypes...)
+			restricted = true
+			continue
+		}
+		if types = intersect(types, etyp.allTypes); len(types) == 0 {
+			check.errorf(pos, "%s has no type in common with the other type constraints", typ)
+		}
 	}
 
 	if methods != nil {